@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"movie-distrbution/distribution"
+)
+
+// auditEntry is one line of the audit log: a command that changed the state
+// and the record of every distributor it changed, before and after
+type auditEntry struct {
+	Time    time.Time     `json:"time"`
+	Actor   string        `json:"actor"`
+	Command string        `json:"command"`
+	Args    []string      `json:"args,omitempty"`
+	Changes []auditChange `json:"changes"`
+
+	// Undone is set on the entries of undo commands to the number of
+	// earlier entries they reverted
+	Undone int `json:"undone,omitempty"`
+}
+
+// auditChange is one distributor's record before and after a command; Before
+// is nil for an added distributor and After for a removed one, so a rename
+// shows as the old name removed and the new one added
+type auditChange struct {
+	Distributor string                        `json:"distributor"`
+	Before      *distribution.DistributorData `json:"before"`
+	After       *distribution.DistributorData `json:"after"`
+}
+
+// auditLog appends entries to the -audit-log file for one actor
+type auditLog struct {
+	path  string
+	actor string
+}
+
+// openAuditLog returns the audit log selected by opts, or nil when auditing
+// is off. The actor comes from -actor, then $DISTRIBUTION_ACTOR, then the
+// login name.
+func openAuditLog(opts *options) *auditLog {
+	if opts.auditLog == "" {
+		return nil
+	}
+	actor := opts.actor
+	for _, variable := range []string{"DISTRIBUTION_ACTOR", "USER", "USERNAME"} {
+		if actor == "" {
+			actor = os.Getenv(variable)
+		}
+	}
+	return &auditLog{path: opts.auditLog, actor: actor}
+}
+
+// auditSnapshot holds every distributor's record encoded as JSON, which both
+// copies it away from the live rule maps and lets records be compared
+type auditSnapshot map[string][]byte
+
+func takeAuditSnapshot(system *distribution.DistributionSystem) (auditSnapshot, error) {
+	snapshot := make(auditSnapshot)
+	for _, record := range system.Records() {
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		snapshot[record.Name] = encoded
+	}
+	return snapshot, nil
+}
+
+// record appends entry, which describes the command that ran, with the
+// changes between before and the current state. Commands that changed
+// nothing leave no entry.
+func (a *auditLog) record(system *distribution.DistributionSystem, before auditSnapshot, entry auditEntry) error {
+	changes, err := changesSince(system, before)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	entry.Time, entry.Actor, entry.Changes = time.Now().UTC(), a.actor, changes
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// changesSince returns the record of every distributor that changed since
+// the snapshot before, sorted by name
+func changesSince(system *distribution.DistributionSystem, before auditSnapshot) ([]auditChange, error) {
+	after, err := takeAuditSnapshot(system)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+
+	var changes []auditChange
+	for _, name := range sortedKeys(names) {
+		if string(before[name]) == string(after[name]) {
+			continue
+		}
+		change := auditChange{Distributor: name}
+		if change.Before, err = decodeAuditRecord(before[name]); err != nil {
+			return nil, err
+		}
+		if change.After, err = decodeAuditRecord(after[name]); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func decodeAuditRecord(encoded []byte) (*distribution.DistributorData, error) {
+	if encoded == nil {
+		return nil, nil
+	}
+	var record distribution.DistributorData
+	if err := json.Unmarshal(encoded, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// readAuditLog reads the entries of the audit log at path that touched
+// distributor (any, if empty) and fall within [since, until); zero times
+// leave that end of the range open
+func readAuditLog(path, distributor string, since, until time.Time) ([]auditEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, lineNum, err)
+		}
+		if (!since.IsZero() && entry.Time.Before(since)) || (!until.IsZero() && !entry.Time.Before(until)) {
+			continue
+		}
+		if distributor != "" {
+			var changes []auditChange
+			for _, change := range entry.Changes {
+				if change.Distributor == distributor {
+					changes = append(changes, change)
+				}
+			}
+			if len(changes) == 0 {
+				continue
+			}
+			entry.Changes = changes
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// writeAuditEntries writes audit entries as "text" (or empty), which
+// summarizes each change, or as "json" or "ndjson" with the full records
+func writeAuditEntries(w io.Writer, format string, entries []auditEntry) error {
+	switch format {
+	case "", "text":
+		for _, entry := range entries {
+			actor := entry.Actor
+			if actor == "" {
+				actor = "(unknown)"
+			}
+			fmt.Fprintf(w, "%s %s %s\n", entry.Time.Format(time.RFC3339), actor, entry.Command)
+			for _, change := range entry.Changes {
+				fmt.Fprintf(w, "  %s: %s\n", change.Distributor, describeAuditChange(change))
+			}
+		}
+		return nil
+	case "json":
+		if entries == nil {
+			entries = []auditEntry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(entries)
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return usageErrorf("unsupported format %s", format)
+	}
+}
+
+// describeAuditChange summarizes how a distributor's record changed
+func describeAuditChange(change auditChange) string {
+	switch {
+	case change.Before == nil:
+		if change.After.ParentName != "" {
+			return "added under " + change.After.ParentName
+		}
+		return "added"
+	case change.After == nil:
+		return "removed"
+	}
+
+	var parts []string
+	if change.Before.ParentName != change.After.ParentName {
+		parts = append(parts, fmt.Sprintf("parent %s -> %s", orNone(change.Before.ParentName), orNone(change.After.ParentName)))
+	}
+	parts = append(parts, ruleChanges("include", change.Before.Includes, change.After.Includes)...)
+	parts = append(parts, ruleChanges("exclude", change.Before.Excludes, change.After.Excludes)...)
+	for _, key := range sortedKeys(change.After.Metadata) {
+		if value, had := change.Before.Metadata[key]; !had || value != change.After.Metadata[key] {
+			parts = append(parts, fmt.Sprintf("metadata %s=%s", key, change.After.Metadata[key]))
+		}
+	}
+	for _, key := range sortedKeys(change.Before.Metadata) {
+		if _, kept := change.After.Metadata[key]; !kept {
+			parts = append(parts, "-metadata "+key)
+		}
+	}
+	if change.Before.MaxChildren != change.After.MaxChildren {
+		parts = append(parts, fmt.Sprintf("max children %d -> %d", change.Before.MaxChildren, change.After.MaxChildren))
+	}
+	if len(parts) == 0 {
+		return "changed"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ruleChanges lists the rules added to and removed from a rule set
+func ruleChanges(kind string, before, after map[string]bool) []string {
+	var changes []string
+	for _, region := range sortedKeys(after) {
+		if !before[region] {
+			changes = append(changes, "+"+kind+" "+region)
+		}
+	}
+	for _, region := range sortedKeys(before) {
+		if !after[region] {
+			changes = append(changes, "-"+kind+" "+region)
+		}
+	}
+	return changes
+}
+
+func orNone(name string) string {
+	if name == "" {
+		return "(none)"
+	}
+	return name
+}
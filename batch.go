@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"movie-distrbution/distribution"
+)
+
+// batchResult is the outcome of checking one region of a check-batch run
+type batchResult struct {
+	Region  string `json:"region"`
+	Allowed bool   `json:"allowed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// readBatchRegions reads the regions to check from -region-file, or from
+// standard input when it is empty or "-"
+func readBatchRegions(regionFile string) ([]string, error) {
+	if regionFile == "" || regionFile == "-" {
+		return distribution.ReadRegions(os.Stdin)
+	}
+	return distribution.ReadRegionFile(regionFile)
+}
+
+// checkBatch checks every region for one distributor, passing each result to
+// emit as soon as it is known and stopping at the first error from emit.
+// Invalid regions are reported in their result rather than stopping the
+// batch. Results are taken from and added to the -cache file when one is
+// open.
+func checkBatch(system *distribution.DistributionSystem, opts *options, regions []string, emit func(batchResult) error) error {
+	if !system.HasDistributor(opts.distributorName) {
+		return fmt.Errorf("distributor %s does not exist", opts.distributorName)
+	}
+	for _, region := range regions {
+		if err := emit(checkBatchRegion(system, opts, region)); err != nil {
+			return err
+		}
+	}
+	if opts.cache != nil {
+		if err := opts.cache.save(); err != nil {
+			return fmt.Errorf("writing cache: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkBatchRegion checks one region of a check-batch run
+func checkBatchRegion(system *distribution.DistributionSystem, opts *options, region string) batchResult {
+	if opts.cache != nil {
+		if cached, hit := opts.cache.lookup(opts.distributorName, region); hit {
+			return batchResult{Region: region, Allowed: cached.Allowed}
+		}
+	}
+	allowed, err := system.CheckPermission(opts.distributorName, region)
+	if err != nil {
+		return batchResult{Region: region, Error: err.Error()}
+	}
+	if opts.cache != nil {
+		location, _ := system.Location(region)
+		opts.cache.store(opts.distributorName, region, CachedCheck{Allowed: allowed, Location: *location})
+	}
+	return batchResult{Region: region, Allowed: allowed}
+}
+
+// streamBatchResults runs checkBatch writing each result to w as an ndjson
+// line the moment it is known, for consumers reading a long batch as it
+// runs. Standard output is unbuffered, so every line is written through as
+// it is encoded.
+func streamBatchResults(w io.Writer, system *distribution.DistributionSystem, opts *options, regions []string) error {
+	encoder := json.NewEncoder(w)
+	return checkBatch(system, opts, regions, func(result batchResult) error {
+		return encoder.Encode(result)
+	})
+}
+
+// writeBatchResults writes check-batch results as "text" (or empty), "json"
+// or "csv"; "ndjson" is written by streamBatchResults instead. Text output
+// ends with a summary line; the other formats carry only the results so they
+// can be consumed as they are.
+func writeBatchResults(w io.Writer, style outputStyle, format string, results []batchResult) error {
+	switch format {
+	case "", "text":
+		allowed, denied, invalid := 0, 0, 0
+		for _, result := range results {
+			switch {
+			case result.Error != "":
+				invalid++
+				fmt.Fprintf(w, "  %s: %s\n", result.Region, style.highlight(false, "error: "+result.Error))
+			case result.Allowed:
+				allowed++
+				fmt.Fprintf(w, "  %s: %s\n", result.Region, style.outcome(true))
+			default:
+				denied++
+				fmt.Fprintf(w, "  %s: %s\n", result.Region, style.outcome(false))
+			}
+		}
+		fmt.Fprintf(w, "Checked %d regions: %d allowed, %d denied, %d invalid\n", len(results), allowed, denied, invalid)
+		return nil
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(results)
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"Region", "Allowed", "Error"}); err != nil {
+			return err
+		}
+		for _, result := range results {
+			if err := writer.Write([]string{result.Region, strconv.FormatBool(result.Allowed), result.Error}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return usageErrorf("unsupported format %s", format)
+	}
+}
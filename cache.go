@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"movie-distrbution/distribution"
+)
+
+// CachedCheck is a permission check result kept in the on-disk cache, along
+// with the resolved location so the result can be printed without loading
+// the locations CSV
+type CachedCheck struct {
+	Allowed  bool
+	Location distribution.Location
+}
+
+// permissionCache stores check results across runs. It is only valid for the
+// exact input files it was built from, identified by InputsHash, and, when
+// rules have validity bounds, until the next one is reached.
+type permissionCache struct {
+	path       string
+	dirty      bool
+	InputsHash string
+	ValidUntil *time.Time `json:",omitempty"`
+	Results    map[string]CachedCheck
+}
+
+// openPermissionCache reads the cache at path. If the file does not exist or
+// was built from different inputs, an empty cache for the current inputs is
+// returned instead.
+func openPermissionCache(path string, inputs ...string) (*permissionCache, error) {
+	hash, err := hashInputs(inputs...)
+	if err != nil {
+		return nil, err
+	}
+	cache := &permissionCache{path: path, InputsHash: hash, Results: make(map[string]CachedCheck)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored permissionCache
+	if err := json.Unmarshal(data, &stored); err != nil || stored.InputsHash != hash || stored.Results == nil ||
+		(stored.ValidUntil != nil && !time.Now().Before(*stored.ValidUntil)) {
+		// Stale or unreadable caches are rebuilt rather than reported
+		return cache, nil
+	}
+	cache.Results = stored.Results
+	cache.ValidUntil = stored.ValidUntil
+	return cache, nil
+}
+
+// hashInputs returns a combined SHA-256 of the named files' contents. Empty
+// names are skipped so optional inputs such as the alias file can be passed
+// unconditionally.
+func hashInputs(filenames ...string) (string, error) {
+	sum := sha256.New()
+	for _, filename := range filenames {
+		if filename == "" {
+			continue
+		}
+		file, err := os.Open(filename)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(sum, file)
+		file.Close()
+		if err != nil {
+			return "", err
+		}
+		// Separate the files so moving bytes between them changes the hash
+		sum.Write([]byte{0})
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+func cacheKey(distributorName, region string) string {
+	return distributorName + "|" + region
+}
+
+// lookup returns the cached result of checking region for a distributor
+func (c *permissionCache) lookup(distributorName, region string) (CachedCheck, bool) {
+	result, exists := c.Results[cacheKey(distributorName, region)]
+	return result, exists
+}
+
+// store records a check result to be written by save
+func (c *permissionCache) store(distributorName, region string, result CachedCheck) {
+	c.Results[cacheKey(distributorName, region)] = result
+	c.dirty = true
+}
+
+// expireAt limits the cached results to before t, when a rule starts or
+// stops applying
+func (c *permissionCache) expireAt(t time.Time) {
+	if c.ValidUntil == nil || t.Before(*c.ValidUntil) {
+		c.ValidUntil = &t
+		c.dirty = true
+	}
+}
+
+// save writes the cache back to disk if anything was stored
+func (c *permissionCache) save() error {
+	if !c.dirty {
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".cache-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
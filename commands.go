@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// commandInfo describes a command for help, completion and the checks made
+// before any data is loaded
+type commandInfo struct {
+	name    string
+	summary string
+
+	// required lists the flags the command cannot run without; "a|b"
+	// means either flag will do
+	required []string
+}
+
+// commands lists every command in the order -cmd documents them
+var commands = []commandInfo{
+	{"add-distributor", "Add a distributor, optionally under a parent", []string{"distributor"}},
+	{"add-permission", "Include or exclude a region for a distributor", []string{"distributor", "region|region-file"}},
+	{"check", "Check whether a distributor may distribute in a region", []string{"distributor", "region"}},
+	{"list", "List all distributors", nil},
+	{"convert-format", "Convert the state file between JSON, YAML and gob", []string{"out|format"}},
+	{"rule-set", "Show the rule set a distributor inherits from its ancestors", []string{"distributor"}},
+	{"verify", "Verify the state file", nil},
+	{"validate-dir", "Verify every state file in a directory", []string{"dir"}},
+	{"carve-out", "Compute (and optionally add) the exclude that removes a region from coverage", []string{"distributor", "region"}},
+	{"dangling-parents", "Report distributors whose parent no longer exists, optionally fixing them", nil},
+	{"depth-distribution", "Summarize distributors and rules per hierarchy depth", nil},
+	{"check-as-if-parent", "Check a permission as if the distributor had a different parent", []string{"distributor", "region"}},
+	{"asymmetry-check", "Find child includes that a parent exclude makes ineffective", nil},
+	{"overlap-matrix", "Count the regions every pair of distributors can both serve", nil},
+	{"check-location-keys", "Check the locations CSV for key collisions between records and levels", nil},
+	{"province-coverage", "Show the share of each province's cities a distributor covers", []string{"distributor"}},
+	{"apply", "Converge distributors on a declarative policy file", []string{"file"}},
+	{"self-contradiction", "Find regions both included and excluded by one distributor", nil},
+	{"region-report", "Show every distributor's decision and reason for one region", []string{"region"}},
+	{"normalize", "Rewrite the state file in canonical sorted form", nil},
+	{"set-metadata", "Tag a distributor with metadata used by conditional permissions", []string{"distributor", "key"}},
+	{"uncovered-regions", "List regions no distributor can serve, grouped by country", nil},
+	{"bundle", "Package the locations CSV and state into a zip bundle", []string{"out|bundle"}},
+	{"self-test", "Verify permission results are stable and agree with a reference evaluation", nil},
+	{"optimize", "Remove redundant rules", nil},
+	{"describe", "Describe a distributor's configuration as Markdown", []string{"distributor"}},
+	{"country-reach", "Count the distributors that can serve a country, per province", []string{"country"}},
+	{"country-fence", "Check a distributor never serves outside its licensed countries", []string{"distributor", "countries"}},
+	{"bulk-exclude", "Exclude a region from every distributor matching a name pattern or parent", []string{"region"}},
+	{"run-script", "Run the command lines of a script file in order", []string{"file"}},
+	{"near-duplicate", "Find unresolved region codes that are likely typos of another rule", nil},
+	{"inherited-only", "List the regions a distributor serves only through its ancestors' includes", []string{"distributor"}},
+	{"set-max-children", "Limit a distributor's direct children", []string{"distributor"}},
+	{"capacity-report", "Compare each parent's children against its limit", nil},
+	{"coverage-diff", "Show the regions each distributor gains and loses compared with another state file", []string{"against"}},
+	{"check-name-collisions", "Find distributor names that differ only in case", nil},
+	{"subtree-policy", "Flatten the coverage of a distributor and its descendants into one policy", []string{"distributor", "out"}},
+	{"country-exclusive", "List the distributors that serve exactly one whole country and nothing else", nil},
+	{"explain", "Explain which rule decided a permission check at each level of the parent chain", []string{"distributor", "region"}},
+	{"csv-completeness", "Check every city's province and country keys resolve with consistent names", nil},
+	{"set-strategy", "Choose how conflicting rules are resolved", []string{"strategy"}},
+	{"sizing", "Estimate the memory taken by the loaded locations and distributors", nil},
+	{"export-since", "Export only the distributors changed or deleted since a previous export", []string{"against"}},
+	{"review-quarantine", "List quarantined includes, or approve or drop a distributor's", nil},
+	{"effective-regions", "List every city a distributor can actually distribute in", []string{"distributor"}},
+	{"serve", "Serve the permission engine over HTTP", nil},
+	{"remove-distributor", "Remove a distributor", []string{"distributor"}},
+	{"remove-permission", "Remove an include or exclude from a distributor", []string{"distributor", "region"}},
+	{"check-batch", "Check many regions for a distributor", []string{"distributor"}},
+	{"shell", "Load the data once and enter commands interactively", nil},
+	{"find-region", "Find region codes by name, tolerating typos", []string{"name"}},
+	{"who-can", "List every distributor that can serve a region", []string{"region"}},
+	{"tree", "Show the distributor hierarchy", nil},
+	{"rename-distributor", "Rename a distributor", []string{"distributor", "new-name"}},
+	{"move-distributor", "Move a distributor under another parent", []string{"distributor"}},
+	{"audit", "Query the audit log by distributor or time range", []string{"audit-log"}},
+	{"undo", "Revert the last N audited changes", []string{"audit-log"}},
+	{"import", "Import contracts, creating distributors and adding their rules", []string{"file"}},
+	{"export", "Export a distributor and its ancestors as contracts", []string{"distributor"}},
+	{"expiring", "List permissions about to expire", nil},
+	{"diff", "Compare the regions two distributors can serve", []string{"distributor", "against"}},
+	{"simulate", "Show how proposed permission changes would change effective regions, without saving them", []string{"file"}},
+}
+
+// commandGroups maps "noun verb" subcommands onto the commands they stand
+// for, so "permission add" runs add-permission
+var commandGroups = map[string]map[string]string{
+	"distributor": {
+		"add":    "add-distributor",
+		"remove": "remove-distributor",
+		"rename": "rename-distributor",
+		"move":   "move-distributor",
+	},
+	"permission": {
+		"add":    "add-permission",
+		"remove": "remove-permission",
+	},
+}
+
+// lookupCommand returns the description of a command
+func lookupCommand(name string) (commandInfo, bool) {
+	for _, command := range commands {
+		if command.name == name {
+			return command, true
+		}
+	}
+	return commandInfo{}, false
+}
+
+func commandNames() []string {
+	names := make([]string, len(commands))
+	for i, command := range commands {
+		names[i] = command.name
+	}
+	return names
+}
+
+// resolveSubcommand turns a leading subcommand in args, such as "check" or
+// "permission add", into the -cmd flag the rest of the CLI reads. Arguments
+// starting with a flag are returned unchanged.
+func resolveSubcommand(args []string) ([]string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return args, nil
+	}
+	if verbs, isGroup := commandGroups[args[0]]; isGroup {
+		if len(args) < 2 || verbs[args[1]] == "" {
+			return nil, fmt.Errorf("%s needs one of: %s", args[0], strings.Join(sortedKeys(verbs), ", "))
+		}
+		return append([]string{"-cmd=" + verbs[args[1]]}, args[2:]...), nil
+	}
+	if _, exists := lookupCommand(args[0]); !exists {
+		return nil, fmt.Errorf("unknown command %q", args[0])
+	}
+	return append([]string{"-cmd=" + args[0]}, args[1:]...), nil
+}
+
+// checkRequired reports the first required flag of the command that was
+// left empty, before any data is loaded
+func checkRequired(fs *flag.FlagSet, name string) error {
+	command, exists := lookupCommand(name)
+	if !exists {
+		return nil
+	}
+	for _, required := range command.required {
+		alternatives := strings.Split(required, "|")
+		given := false
+		for _, flagName := range alternatives {
+			if f := fs.Lookup(flagName); f != nil && f.Value.String() != "" {
+				given = true
+			}
+		}
+		if !given {
+			return fmt.Errorf("%s requires -%s (see help %s)", name, strings.Join(alternatives, " or -"), name)
+		}
+	}
+	return nil
+}
+
+// usageFlagPattern finds the flags used in a usage example
+var usageFlagPattern = regexp.MustCompile(`(?:^|[\s\[])-([a-z][a-z-]*)`)
+
+// writeCommandHelp describes one command: its summary, its examples from the
+// full usage rewritten as subcommands, and the flags those examples use
+func writeCommandHelp(w io.Writer, fs *flag.FlagSet, name string) error {
+	command, exists := lookupCommand(name)
+	if !exists {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	fmt.Fprintf(w, "%s: %s\n", command.name, command.summary)
+
+	var usage bytes.Buffer
+	writeUsage(&usage)
+	invocation := "-cmd=" + name
+	var examples []string
+	for _, line := range strings.Split(usage.String(), "\n") {
+		if rest, found := strings.CutPrefix(strings.TrimSpace(line), "go run main.go "+invocation); found && (rest == "" || rest[0] == ' ') {
+			examples = append(examples, "go run main.go "+name+rest)
+		}
+	}
+	if len(examples) > 0 {
+		fmt.Fprintln(w, "\nUsage:")
+		for _, example := range examples {
+			fmt.Fprintf(w, "   %s\n", example)
+		}
+	}
+
+	if len(command.required) > 0 {
+		var required []string
+		for _, flagNames := range command.required {
+			required = append(required, "-"+strings.ReplaceAll(flagNames, "|", " or -"))
+		}
+		fmt.Fprintf(w, "\nRequired: %s\n", strings.Join(required, ", "))
+	}
+
+	seen := make(map[string]bool)
+	var flags []*flag.Flag
+	for _, example := range examples {
+		for _, match := range usageFlagPattern.FindAllStringSubmatch(example, -1) {
+			if f := fs.Lookup(match[1]); f != nil && !seen[f.Name] {
+				seen[f.Name] = true
+				flags = append(flags, f)
+			}
+		}
+	}
+	if len(flags) > 0 {
+		fmt.Fprintln(w, "\nFlags:")
+		for _, f := range flags {
+			fmt.Fprintf(w, "  -%s\n    \t%s\n", f.Name, f.Usage)
+		}
+	}
+	return nil
+}
+
+// runHelp prints the full usage, or the help of the command named in args
+func runHelp(fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		printUsage()
+		return nil
+	}
+	if verbs, isGroup := commandGroups[args[0]]; isGroup && len(args) > 1 && verbs[args[1]] != "" {
+		return writeCommandHelp(os.Stdout, fs, verbs[args[1]])
+	}
+	return writeCommandHelp(os.Stdout, fs, args[0])
+}
+
+// writeCompletion prints a shell completion script for program, completing
+// command names first and flag names after them
+func writeCompletion(w io.Writer, fs *flag.FlagSet, shell, program string) error {
+	program = filepath.Base(program)
+	words := append([]string{"help", "completion"}, commandNames()...)
+	words = append(words, sortedKeys(commandGroups)...)
+	var flags []string
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, "-"+f.Name)
+	})
+	function := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(program)
+
+	var groupCases strings.Builder
+	for _, group := range sortedKeys(commandGroups) {
+		fmt.Fprintf(&groupCases, "        %s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n",
+			group, strings.Join(sortedKeys(commandGroups[group]), " "))
+	}
+
+	switch shell {
+	case "zsh":
+		fmt.Fprintf(w, "#compdef %s\nautoload -U +X bashcompinit && bashcompinit\n", program)
+	case "bash":
+	default:
+		return errors.New("unsupported shell " + shell + " (available: bash, zsh)")
+	}
+	fmt.Fprintf(w, `%[1]s() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W %[2]q -- "$cur"))
+        return
+    fi
+    if [ "$COMP_CWORD" -eq 2 ]; then
+        case "${COMP_WORDS[1]}" in
+%[3]s        help) COMPREPLY=($(compgen -W %[2]q -- "$cur")); return ;;
+        completion) COMPREPLY=($(compgen -W "bash zsh" -- "$cur")); return ;;
+        esac
+    fi
+    COMPREPLY=($(compgen -W %[4]q -- "$cur"))
+}
+complete -F %[1]s %[5]s
+`, function, strings.Join(words, " "), groupCases.String(), strings.Join(flags, " "), program)
+	return nil
+}
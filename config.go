@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigName is the config file looked for in the home directory when
+// -config is not given
+const defaultConfigName = ".distribrc"
+
+// configPath returns the config file named by -config in args, or
+// ~/.distribrc. explicit is false for the default, which may be missing.
+// Flags are scanned by hand because the config has to be applied before
+// the command line is parsed, so the command line can override it.
+func configPath(args []string) (path string, explicit bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config" {
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+		}
+		return value, true
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(home, defaultConfigName), false
+}
+
+// loadConfig reads a YAML config file of flag defaults, such as
+//
+//	csv: /srv/geo/cities.csv
+//	data: /srv/distribution/distributors.gob
+//	format: json
+//
+// Keys are flag names and lists are joined with commas. The data file's
+// extension picks the storage format, as it does on the command line. A
+// missing default config is not an error; a missing -config file is.
+func loadConfig(path string, explicit bool) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	defaults := make(map[string]string)
+	for key, value := range raw {
+		name := strings.TrimLeft(key, "-")
+		if name == "config" {
+			return nil, fmt.Errorf("%s: a config file cannot name another config file", path)
+		}
+		switch value := value.(type) {
+		case nil:
+			defaults[name] = ""
+		case []interface{}:
+			parts := make([]string, len(value))
+			for i, part := range value {
+				parts[i] = fmt.Sprint(part)
+			}
+			defaults[name] = strings.Join(parts, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("%s: %s must be a single value or a list", path, key)
+		default:
+			defaults[name] = fmt.Sprint(value)
+		}
+	}
+	return defaults, nil
+}
+
+// applyConfig sets the flags named in defaults on fs before the command line
+// is parsed, in sorted order so errors are reported consistently
+func applyConfig(fs *flag.FlagSet, defaults map[string]string) error {
+	for _, name := range sortedKeys(defaults) {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown flag %q", name)
+		}
+		if err := fs.Set(name, defaults[name]); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
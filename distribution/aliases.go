@@ -0,0 +1,92 @@
+package distribution
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// LoadAliases reads a two-column CSV of alias,canonical region codes. An alias
+// may name a country (UK,GB), a province-country pair or a full city key, and
+// is applied to that suffix of any region code. Lines starting with # are
+// ignored. Aliases must be loaded before the location data they apply to.
+func (ds *DistributionSystem) LoadAliases(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		alias, canonical := normalizeRegion(record[0]), normalizeRegion(record[1])
+		if strings.Count(alias, "-") != strings.Count(canonical, "-") {
+			return fmt.Errorf("alias %s and canonical code %s are at different levels", alias, canonical)
+		}
+		ds.aliases[alias] = canonical
+	}
+	return nil
+}
+
+// CanonicalRegion normalizes a region code and rewrites it using the alias
+// table, resolving the country first, then the province and finally the city
+func (ds *DistributionSystem) CanonicalRegion(region string) string {
+	region = normalizeRegion(region)
+	if len(ds.aliases) == 0 {
+		return region
+	}
+
+	parts := strings.Split(region, "-")
+	for i := len(parts) - 1; i >= 0; i-- {
+		suffix := strings.Join(parts[i:], "-")
+		if canonical, exists := ds.aliases[suffix]; exists {
+			parts = append(parts[:i], strings.Split(canonical, "-")...)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// normalizeRegion trims the whitespace around a region code and each of its
+// parts and upper-cases it, so codes such as " in" and "Ka - In" from
+// upstream feeds match the stored KA-IN
+func normalizeRegion(region string) string {
+	region = strings.ToUpper(strings.TrimSpace(region))
+	if strings.IndexFunc(region, unicode.IsSpace) < 0 {
+		return region
+	}
+	parts := strings.Split(region, "-")
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+	}
+	return strings.Join(parts, "-")
+}
+
+// canonicalizeLocation rewrites the codes of a location loaded from CSV to
+// their normalized, canonical form
+func (ds *DistributionSystem) canonicalizeLocation(location *Location) {
+	location.CountryCode = normalizeRegion(location.CountryCode)
+	location.ProvinceCode = normalizeRegion(location.ProvinceCode)
+	location.CityCode = normalizeRegion(location.CityCode)
+	if len(ds.aliases) == 0 {
+		return
+	}
+
+	location.CountryCode = ds.CanonicalRegion(location.CountryCode)
+	province := ds.CanonicalRegion(location.ProvinceCode + "-" + location.CountryCode)
+	location.ProvinceCode = strings.Split(province, "-")[0]
+	city := ds.CanonicalRegion(location.CityCode + "-" + location.ProvinceCode + "-" + location.CountryCode)
+	location.CityCode = strings.Split(city, "-")[0]
+}
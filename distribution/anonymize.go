@@ -0,0 +1,51 @@
+package distribution
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+)
+
+// Pseudonym returns a stable anonymous name for a distributor
+func Pseudonym(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return "DIST_" + hex.EncodeToString(sum[:5])
+}
+
+// Anonymized returns a copy of the system in which every distributor has been
+// renamed to its pseudonym, keeping the hierarchy and permissions intact. The
+// returned map resolves pseudonyms back to the real names.
+func (ds *DistributionSystem) Anonymized() (*DistributionSystem, map[string]string) {
+	anon := ds.emptyWithLocations()
+	mapping := make(map[string]string)
+
+	for name, dist := range ds.distributors {
+		alias := Pseudonym(name)
+		mapping[alias] = name
+
+		anon.distributors[alias] = dist.copyAs(alias)
+	}
+
+	for name, dist := range ds.distributors {
+		if dist.Parent != nil {
+			anon.distributors[Pseudonym(name)].Parent = anon.distributors[Pseudonym(dist.Parent.Name)]
+		}
+	}
+
+	return anon, mapping
+}
+
+// WriteAnonymizationMap saves the pseudonym to real name mapping as JSON so
+// the owner of the data can de-anonymize shared reports
+func WriteAnonymizationMap(filename string, mapping map[string]string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(mapping)
+}
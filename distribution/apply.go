@@ -0,0 +1,231 @@
+package distribution
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyEntry declares the intended rules of one distributor. Parent is only
+// used when the distributor does not exist yet and has to be created.
+type PolicyEntry struct {
+	Parent   string   `yaml:"parent"`
+	Includes []string `yaml:"includes"`
+	Excludes []string `yaml:"excludes"`
+}
+
+// Policy maps distributor names to their intended rules
+type Policy map[string]PolicyEntry
+
+// PlanStep is a single change needed to converge on a policy
+type PlanStep struct {
+	Action      string // "create", "add", "remove" or "set-metadata"
+	Distributor string
+	Parent      string // for "create"
+	Region      string // for "add" and "remove"
+	IsInclude   bool
+	When        string   // metadata predicate gating an "add", if any
+	Validity    Validity // time span of an "add", if bounded
+	Priority    int      // priority of an "add", if not 0
+	Key, Value  string   // for "set-metadata"
+}
+
+func (step PlanStep) String() string {
+	kind := "exclude"
+	if step.IsInclude {
+		kind = "include"
+	}
+	switch step.Action {
+	case "create":
+		if step.Parent == "" {
+			return fmt.Sprintf("+ create %s", step.Distributor)
+		}
+		return fmt.Sprintf("+ create %s (parent %s)", step.Distributor, step.Parent)
+	case "add":
+		suffix := ""
+		if step.When != "" {
+			suffix += " when " + step.When
+		}
+		if !step.Validity.IsZero() {
+			suffix += " " + step.Validity.String()
+		}
+		if step.Priority != 0 {
+			suffix += fmt.Sprintf(" priority %d", step.Priority)
+		}
+		return fmt.Sprintf("+ %s %s %s%s", step.Distributor, kind, step.Region, suffix)
+	case "set-metadata":
+		return fmt.Sprintf("~ %s %s=%s", step.Distributor, step.Key, step.Value)
+	default:
+		return fmt.Sprintf("- %s %s %s", step.Distributor, kind, step.Region)
+	}
+}
+
+// LoadPolicy reads a policy file, as YAML if it has a .yaml or .yml
+// extension and as JSON otherwise
+func LoadPolicy(filename string) (Policy, error) {
+	var policy Policy
+	if err := decodeFile(filename, &policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// decodeFile decodes a JSON or YAML document into v, choosing the format by
+// extension as StateFormat does
+func decodeFile(filename string, v interface{}) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if StateFormat(filename) == "yaml" {
+		return yaml.NewDecoder(file).Decode(v)
+	}
+	return json.NewDecoder(file).Decode(v)
+}
+
+// PlanPolicy computes the steps needed to bring the distributors named in the
+// policy to their declared state. Distributors the policy does not mention
+// are left alone. Steps are ordered so that parents are created and granted
+// their includes before their children, and so that excludes are lifted
+// before includes are added.
+func (ds *DistributionSystem) PlanPolicy(policy Policy) ([]PlanStep, error) {
+	order, err := ds.policyOrder(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []PlanStep
+	for _, name := range order {
+		if _, exists := ds.distributors[name]; !exists {
+			plan = append(plan, PlanStep{Action: "create", Distributor: name, Parent: policy[name].Parent})
+		}
+	}
+
+	for _, name := range order {
+		entry := policy[name]
+		current := NewDistributor(name, nil)
+		if existing, exists := ds.distributors[name]; exists {
+			current = existing
+		}
+		includes := ds.canonicalSet(entry.Includes)
+		excludes := ds.canonicalSet(entry.Excludes)
+
+		for _, region := range sortedKeys(current.Excludes) {
+			if !excludes[region] {
+				plan = append(plan, PlanStep{Action: "remove", Distributor: name, Region: region})
+			}
+		}
+		for _, region := range sortedKeys(includes) {
+			if !current.Includes[region] {
+				plan = append(plan, PlanStep{Action: "add", Distributor: name, Region: region, IsInclude: true})
+			}
+		}
+		for _, region := range sortedKeys(excludes) {
+			if !current.Excludes[region] {
+				plan = append(plan, PlanStep{Action: "add", Distributor: name, Region: region})
+			}
+		}
+		for _, region := range sortedKeys(current.Includes) {
+			if !includes[region] {
+				plan = append(plan, PlanStep{Action: "remove", Distributor: name, Region: region, IsInclude: true})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// ApplyPlan executes a plan. It is rehearsed on a clone first so that either
+// every step succeeds or the system is left untouched.
+func (ds *DistributionSystem) ApplyPlan(plan []PlanStep) error {
+	if err := ds.Clone().applySteps(plan); err != nil {
+		return err
+	}
+	return ds.applySteps(plan)
+}
+
+func (ds *DistributionSystem) applySteps(plan []PlanStep) error {
+	for _, step := range plan {
+		var err error
+		switch step.Action {
+		case "create":
+			err = ds.AddDistributor(step.Distributor, step.Parent)
+		case "add":
+			err = ds.AddConditionalPermission(step.Distributor, step.Region, step.IsInclude, step.When)
+			if err == nil && !step.Validity.IsZero() {
+				err = ds.SetRuleValidity(step.Distributor, step.Region, step.IsInclude, step.Validity)
+			}
+			if err == nil && step.Priority != 0 {
+				err = ds.SetRulePriority(step.Distributor, step.Region, step.IsInclude, step.Priority)
+			}
+		case "remove":
+			err = ds.RemovePermission(step.Distributor, step.Region, step.IsInclude)
+		case "set-metadata":
+			err = ds.SetMetadata(step.Distributor, step.Key, step.Value)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", step, err)
+		}
+	}
+	return nil
+}
+
+// policyOrder returns the policy's distributor names with every parent ahead
+// of its children, considering both existing and to-be-created distributors
+func (ds *DistributionSystem) policyOrder(policy Policy) ([]string, error) {
+	names := make([]string, 0, len(policy))
+	for name := range policy {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parentOf := func(name string) string {
+		if existing, exists := ds.distributors[name]; exists {
+			if existing.Parent != nil {
+				return existing.Parent.Name
+			}
+			return ""
+		}
+		return policy[name].Parent
+	}
+
+	var order []string
+	placed := make(map[string]bool)
+	for len(order) < len(names) {
+		progress := false
+		for _, name := range names {
+			if placed[name] {
+				continue
+			}
+			parent := parentOf(name)
+			if _, inPolicy := policy[parent]; parent != "" && inPolicy && !placed[parent] {
+				continue
+			}
+			if _, exists := ds.distributors[parent]; parent != "" && !exists {
+				if _, inPolicy := policy[parent]; !inPolicy {
+					return nil, fmt.Errorf("parent distributor %s of %s does not exist", parent, name)
+				}
+			}
+			order = append(order, name)
+			placed[name] = true
+			progress = true
+		}
+		if !progress {
+			return nil, fmt.Errorf("policy parents form a cycle")
+		}
+	}
+	return order, nil
+}
+
+// canonicalSet converts a list of region codes into a set of canonical codes
+func (ds *DistributionSystem) canonicalSet(regions []string) map[string]bool {
+	set := make(map[string]bool, len(regions))
+	for _, region := range regions {
+		set[ds.CanonicalRegion(region)] = true
+	}
+	return set
+}
@@ -0,0 +1,74 @@
+package distribution
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SetBackups makes SaveState keep the given number of previous versions of
+// the state file, named like distributors.1.json (the most recent) through
+// distributors.N.json. Zero, the default, keeps none.
+func (ds *DistributionSystem) SetBackups(n int) error {
+	if n < 0 {
+		return fmt.Errorf("backup count must not be negative, got %d", n)
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.backups = n
+	return nil
+}
+
+// backupName returns the name of the nth backup of filename, keeping the
+// extension last so the backup loads in the same format
+func backupName(filename string, n int) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(filename, ext), n, ext)
+}
+
+// rotateBackups shifts the existing backups of filename up by one, dropping
+// the oldest, and makes the current file the first backup. The current file
+// stays in place so a crash during the rotation never loses it.
+func rotateBackups(filename string, keep int) error {
+	// LoadState creates a missing state file empty; that is not worth a
+	// backup
+	if stat, err := os.Stat(filename); errors.Is(err, fs.ErrNotExist) || (err == nil && stat.Size() == 0) {
+		return nil
+	}
+	for n := keep - 1; n >= 1; n-- {
+		if err := os.Rename(backupName(filename, n), backupName(filename, n+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	first := backupName(filename, 1)
+	if err := os.Remove(first); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Link(filename, first); err == nil {
+		return nil
+	}
+	// Not every file system supports hard links
+	return copyFile(filename, first)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,208 @@
+// Package boltstore keeps the state of a distribution system in a bbolt
+// database file, with a key per distributor and per location. Unlike the
+// sqlitestore package it needs no cgo.
+package boltstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+
+	"movie-distrbution/distribution"
+)
+
+var (
+	// settingsBucket holds the strategy and the fingerprint of the stored
+	// locations
+	settingsBucket = []byte("settings")
+	// distributorsBucket maps each distributor's name to its data as JSON
+	distributorsBucket = []byte("distributors")
+	// locationsBucket maps each city's codes, country first, to the city as
+	// JSON, so iterating it yields the cities in order
+	locationsBucket = []byte("locations")
+
+	strategyKey  = []byte("strategy")
+	locationsKey = []byte("locations")
+)
+
+// Store is a distribution.LocationStore backed by a bbolt database. bbolt
+// locks the whole file while it is open, so the store opens it for each load
+// or save only, and other processes can use it in between. Each save
+// replaces the stored state in one transaction.
+type Store struct {
+	path    string
+	timeout time.Duration
+}
+
+// Open opens the database at path, creating it and its buckets if needed.
+// timeout bounds each wait for another process holding the database open;
+// a zero timeout fails at once.
+func Open(path string, timeout time.Duration) (*Store, error) {
+	// bbolt waits forever on a zero timeout
+	if timeout <= 0 {
+		timeout = time.Nanosecond
+	}
+	store := &Store{path: path, timeout: timeout}
+	err := store.update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{settingsBucket, distributorsBucket, locationsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return store, nil
+}
+
+func (s *Store) String() string {
+	return "bolt:" + s.path
+}
+
+// Close releases nothing, since the database is only open during a load or
+// save
+func (s *Store) Close() error {
+	return nil
+}
+
+// view runs fn in a read transaction, holding the database open for reading
+// only, which other readers may do at the same time
+func (s *Store) view(fn func(tx *bolt.Tx) error) error {
+	db, err := bolt.Open(s.path, 0644, &bolt.Options{Timeout: s.timeout, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(fn)
+}
+
+// update runs fn in a read-write transaction
+func (s *Store) update(fn func(tx *bolt.Tx) error) error {
+	db, err := bolt.Open(s.path, 0644, &bolt.Options{Timeout: s.timeout})
+	if err != nil {
+		return err
+	}
+	if err := db.Update(fn); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+// Load reads the state in one read transaction
+func (s *Store) Load() (distribution.State, error) {
+	state := distribution.State{Distributors: make(map[string]distribution.DistributorData)}
+	err := s.view(func(tx *bolt.Tx) error {
+		state.Strategy = string(tx.Bucket(settingsBucket).Get(strategyKey))
+		return tx.Bucket(distributorsBucket).ForEach(func(name, value []byte) error {
+			var data distribution.DistributorData
+			if err := json.Unmarshal(value, &data); err != nil {
+				return fmt.Errorf("distributor %s: %w", name, err)
+			}
+			state.Distributors[string(name)] = data
+			return nil
+		})
+	})
+	return state, err
+}
+
+// Save replaces the stored state with state in one transaction
+func (s *Store) Save(state distribution.State) error {
+	return s.update(func(tx *bolt.Tx) error {
+		settings := tx.Bucket(settingsBucket)
+		var err error
+		if state.Strategy == "" {
+			err = settings.Delete(strategyKey)
+		} else {
+			err = settings.Put(strategyKey, []byte(state.Strategy))
+		}
+		if err != nil {
+			return err
+		}
+
+		distributors, err := recreateBucket(tx, distributorsBucket)
+		if err != nil {
+			return err
+		}
+		for name, data := range state.Distributors {
+			value, err := json.Marshal(data)
+			if err != nil {
+				return fmt.Errorf("distributor %s: %w", name, err)
+			}
+			if err := distributors.Put([]byte(name), value); err != nil {
+				return fmt.Errorf("distributor %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// LoadLocations returns the stored locations sorted by country, province and
+// city code
+func (s *Store) LoadLocations() ([]distribution.Location, error) {
+	var locations []distribution.Location
+	err := s.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(locationsBucket).ForEach(func(key, value []byte) error {
+			var location distribution.Location
+			if err := json.Unmarshal(value, &location); err != nil {
+				return fmt.Errorf("location %q: %w", key, err)
+			}
+			locations = append(locations, location)
+			return nil
+		})
+	})
+	return locations, err
+}
+
+// SaveLocations replaces the stored locations in one transaction. Locations
+// identical to those stored, as recognized by their fingerprint, are not
+// written again.
+func (s *Store) SaveLocations(locations []distribution.Location) error {
+	fingerprint := distribution.LocationsFingerprint(locations)
+	unchanged := false
+	err := s.view(func(tx *bolt.Tx) error {
+		unchanged = string(tx.Bucket(settingsBucket).Get(locationsKey)) == fingerprint
+		return nil
+	})
+	if err != nil || unchanged {
+		return err
+	}
+
+	return s.update(func(tx *bolt.Tx) error {
+		bucket, err := recreateBucket(tx, locationsBucket)
+		if err != nil {
+			return err
+		}
+		for _, location := range locations {
+			value, err := json.Marshal(location)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(locationKey(location), value); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(settingsBucket).Put(locationsKey, []byte(fingerprint))
+	})
+}
+
+// locationKey orders locations by country, province and city code. The codes
+// are joined by a zero byte, which sorts before any character of a code.
+func locationKey(location distribution.Location) []byte {
+	return []byte(strings.Join([]string{location.CountryCode, location.ProvinceCode, location.CityCode}, "\x00"))
+}
+
+// recreateBucket empties the named bucket by replacing it with a new one
+func recreateBucket(tx *bolt.Tx, name []byte) (*bolt.Bucket, error) {
+	if err := tx.DeleteBucket(name); err != nil && !errors.Is(err, berrors.ErrBucketNotFound) {
+		return nil, err
+	}
+	return tx.CreateBucket(name)
+}
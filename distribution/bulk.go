@@ -0,0 +1,70 @@
+package distribution
+
+import (
+	"fmt"
+	"path"
+)
+
+// BulkResult is the outcome of a bulk operation for one distributor
+type BulkResult struct {
+	Distributor string
+	Err         error
+}
+
+// SelectDistributors returns the sorted names of distributors whose name
+// matches the glob pattern filter and, if parent is set, whose parent is
+// parent. Empty selectors match everything.
+func (ds *DistributionSystem) SelectDistributors(filter, parent string) ([]string, error) {
+	if parent != "" {
+		if _, exists := ds.distributors[parent]; !exists {
+			return nil, fmt.Errorf("parent distributor %s does not exist", parent)
+		}
+	}
+
+	var selected []string
+	for _, name := range ds.distributorNames() {
+		if filter != "" {
+			matched, err := path.Match(filter, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter %q: %v", filter, err)
+			}
+			if !matched {
+				continue
+			}
+		}
+		if parent != "" {
+			dist := ds.distributors[name]
+			if dist.Parent == nil || dist.Parent.Name != parent {
+				continue
+			}
+		}
+		selected = append(selected, name)
+	}
+	return selected, nil
+}
+
+// BulkExclude adds an exclude for region to every distributor selected by
+// filter and parent, recording the result for each one. A failure for one
+// distributor does not stop the others.
+func (ds *DistributionSystem) BulkExclude(filter, parent, region string) ([]BulkResult, error) {
+	if filter == "" && parent == "" {
+		return nil, fmt.Errorf("a filter or parent selector is required")
+	}
+
+	selected, err := ds.SelectDistributors(filter, parent)
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no distributors match the selection")
+	}
+
+	results := make([]BulkResult, 0, len(selected))
+	for _, name := range selected {
+		results = append(results, BulkResult{
+			Distributor: name,
+			Err:         ds.AddPermission(name, region, false),
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,121 @@
+package distribution
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractBundle unpacks the locations CSV and the state file from a zip
+// bundle into dir and returns their paths. Members may sit in any folder of
+// the archive; the first .csv file and the first state file (.json, .gob,
+// .yaml or .yml) are used.
+func ExtractBundle(bundlePath, dir string) (csvPath, dataPath string, err error) {
+	archive, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		return "", "", err
+	}
+	defer archive.Close()
+
+	for _, member := range archive.File {
+		if member.FileInfo().IsDir() {
+			continue
+		}
+		// Only the base name is used so that paths in the archive can never
+		// escape the extraction directory
+		base := path.Base(member.Name)
+		switch ext := strings.ToLower(path.Ext(base)); {
+		case ext == ".csv" && csvPath == "":
+			csvPath = filepath.Join(dir, base)
+			err = extractMember(member, csvPath)
+		case (ext == ".json" || ext == ".gob" || ext == ".yaml" || ext == ".yml") && dataPath == "":
+			dataPath = filepath.Join(dir, base)
+			err = extractMember(member, dataPath)
+		}
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if csvPath == "" || dataPath == "" {
+		return "", "", fmt.Errorf("bundle %s must contain a .csv locations file and a .json, .gob or .yaml state file", bundlePath)
+	}
+	return csvPath, dataPath, nil
+}
+
+func extractMember(member *zip.File, dest string) error {
+	src, err := member.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// WriteBundle packages the locations CSV and state file into a zip bundle.
+// The archive is written next to its destination and renamed into place so
+// an existing bundle is never left half written.
+func WriteBundle(bundlePath, csvPath, dataPath string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(bundlePath), ".bundle-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	archive := zip.NewWriter(tmp)
+	for _, file := range []string{csvPath, dataPath} {
+		if err := addBundleMember(archive, file); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), bundlePath)
+}
+
+func addBundleMember(archive *zip.Writer, filename string) error {
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Method = zip.Deflate
+
+	dst, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,75 @@
+package distribution
+
+import "fmt"
+
+// ParentCapacity compares how many direct children a distributor has with
+// its MaxChildren limit
+type ParentCapacity struct {
+	Name        string
+	Children    int
+	MaxChildren int // 0 means unlimited
+}
+
+// Exceeded reports whether the distributor has more children than allowed,
+// which can happen when a limit is lowered by editing the state file
+func (c ParentCapacity) Exceeded() bool {
+	return c.MaxChildren > 0 && c.Children > c.MaxChildren
+}
+
+// childCounts returns how many direct children each distributor has
+func (ds *DistributionSystem) childCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, dist := range ds.distributors {
+		if dist.Parent != nil {
+			counts[dist.Parent.Name]++
+		}
+	}
+	return counts
+}
+
+// checkCapacity fails if parent has already reached its MaxChildren limit
+func (ds *DistributionSystem) checkCapacity(parent *Distributor) error {
+	if parent.MaxChildren == 0 {
+		return nil
+	}
+	if children := ds.childCounts()[parent.Name]; children >= parent.MaxChildren {
+		return fmt.Errorf("distributor %s already has %d of at most %d children", parent.Name, children, parent.MaxChildren)
+	}
+	return nil
+}
+
+// SetMaxChildren sets the limit on a distributor's direct children; 0 removes
+// the limit. A limit below the current number of children is rejected.
+func (ds *DistributionSystem) SetMaxChildren(name string, maxChildren int) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	distributor, exists := ds.distributors[name]
+	if !exists {
+		return fmt.Errorf("distributor %s does not exist", name)
+	}
+	if maxChildren < 0 {
+		return fmt.Errorf("max children must not be negative, got %d", maxChildren)
+	}
+	if children := ds.childCounts()[name]; maxChildren > 0 && children > maxChildren {
+		return fmt.Errorf("distributor %s already has %d children", name, children)
+	}
+
+	distributor.MaxChildren = maxChildren
+	return nil
+}
+
+// CapacityReport lists every distributor that has children or a child limit,
+// sorted by name
+func (ds *DistributionSystem) CapacityReport() []ParentCapacity {
+	counts := ds.childCounts()
+	var report []ParentCapacity
+	for _, name := range ds.distributorNames() {
+		dist := ds.distributors[name]
+		if counts[name] == 0 && dist.MaxChildren == 0 {
+			continue
+		}
+		report = append(report, ParentCapacity{Name: name, Children: counts[name], MaxChildren: dist.MaxChildren})
+	}
+	return report
+}
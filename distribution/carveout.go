@@ -0,0 +1,43 @@
+package distribution
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CarveOut works out how to stop a distributor from serving region without
+// touching the rest of its coverage. It returns the distributor's own includes
+// that currently grant some or all of the region, and the exclude that would
+// deny exactly that region. An empty exclude means there is nothing to carve out.
+func (ds *DistributionSystem) CarveOut(name, region string) (granting []string, exclude string, err error) {
+	distributor, exists := ds.distributors[name]
+	if !exists {
+		return nil, "", fmt.Errorf("distributor %s does not exist", name)
+	}
+
+	if !ds.ValidateRegion(region) {
+		return nil, "", fmt.Errorf("invalid region code: %s", region)
+	}
+
+	parts := strings.Split(region, "-")
+	for _, excluded := range sortedKeys(distributor.Excludes) {
+		if isSubregion(parts, strings.Split(excluded, "-")) {
+			return nil, "", nil
+		}
+	}
+
+	// An include grants the region when it covers it entirely, or part of
+	// it when it sits inside it. Either way excluding the region itself is
+	// the narrowest rule that removes it and nothing else.
+	for _, included := range sortedKeys(distributor.Includes) {
+		includedParts := strings.Split(included, "-")
+		if isSubregion(parts, includedParts) || isSubregion(includedParts, parts) {
+			granting = append(granting, included)
+		}
+	}
+	if len(granting) == 0 {
+		return nil, "", nil
+	}
+
+	return granting, region, nil
+}
@@ -0,0 +1,107 @@
+package distribution
+
+import "fmt"
+
+// Clone returns a deep copy of the distributor hierarchy and permissions.
+// Location data and aliases are shared since they are never modified after
+// loading.
+func (ds *DistributionSystem) Clone() *DistributionSystem {
+	clone := ds.emptyWithLocations()
+	clone.aliases = ds.aliases
+	clone.caseSensitiveNames = ds.caseSensitiveNames
+	clone.strategy = ds.strategy
+	clone.clock = ds.clock
+
+	for name, dist := range ds.distributors {
+		clone.distributors[name] = dist.copyAs(name)
+	}
+
+	for name, dist := range ds.distributors {
+		if dist.Parent != nil {
+			clone.distributors[name].Parent = clone.distributors[dist.Parent.Name]
+		}
+	}
+
+	for name, parentName := range ds.unresolvedParents {
+		clone.unresolvedParents[name] = parentName
+	}
+
+	return clone
+}
+
+// CheckPermissionAsIfParent answers whether a distributor would have
+// permission for a region if its parent were hypotheticalParent, without
+// modifying the system
+func (ds *DistributionSystem) CheckPermissionAsIfParent(name, region, hypotheticalParent string) (bool, error) {
+	clone := ds.Clone()
+	if err := clone.SetParent(name, hypotheticalParent); err != nil {
+		return false, err
+	}
+	return clone.CheckPermission(name, region)
+}
+
+// PruneTo drops every distributor except the named ones and their ancestors,
+// which are kept so permissions still resolve correctly
+func (ds *DistributionSystem) PruneTo(names []string) error {
+	keep := make(map[string]bool)
+	for _, name := range names {
+		distributor, exists := ds.distributors[name]
+		if !exists {
+			return fmt.Errorf("distributor %s does not exist", name)
+		}
+		for d := distributor; d != nil && !keep[d.Name]; d = d.Parent {
+			keep[d.Name] = true
+		}
+	}
+
+	for name := range ds.distributors {
+		if !keep[name] {
+			delete(ds.distributors, name)
+			delete(ds.unresolvedParents, name)
+		}
+	}
+	return nil
+}
+
+// copyAs returns a deep copy of a distributor's own data under a new name.
+// The parent link is left for the caller to resolve.
+func (d *Distributor) copyAs(name string) *Distributor {
+	copied := NewDistributor(name, nil)
+	copied.Locations = d.Locations
+	copied.subregions = d.subregions
+	copied.MaxChildren = d.MaxChildren
+	copied.strategy = d.strategy
+	copied.clock = d.clock
+	for region, value := range d.Includes {
+		copied.Includes[region] = value
+	}
+	for region, value := range d.Excludes {
+		copied.Excludes[region] = value
+	}
+	for key, value := range d.Metadata {
+		copied.Metadata[key] = value
+	}
+	for region, when := range d.IncludeConditions {
+		copied.IncludeConditions[region] = when
+	}
+	for region, when := range d.ExcludeConditions {
+		copied.ExcludeConditions[region] = when
+	}
+	for region, validity := range d.IncludeValidity {
+		copied.IncludeValidity[region] = validity
+	}
+	for region, validity := range d.ExcludeValidity {
+		copied.ExcludeValidity[region] = validity
+	}
+	for region, priority := range d.IncludePriority {
+		copied.IncludePriority[region] = priority
+	}
+	for region, priority := range d.ExcludePriority {
+		copied.ExcludePriority[region] = priority
+	}
+	for region, value := range d.Quarantined {
+		copied.Quarantined[region] = value
+	}
+	copied.reindexRules()
+	return copied
+}
@@ -0,0 +1,130 @@
+package distribution
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentUse runs CheckPermissions and the other methods documented
+// as safe for concurrent use against writers changing the same
+// distributors. Run with -race to check the locking.
+func TestConcurrentUse(t *testing.T) {
+	ds := newTestSystem(t)
+	names := []string{"P", "C1", "C2", "C3"}
+	addChain(t, ds, names[:1], include("P", "IN"), include("P", "US"))
+	for _, name := range names[1:] {
+		if err := ds.AddDistributor(name, "P"); err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.AddPermission(name, "IN", true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Never in force, but checking TN-IN for C2 reads the metadata the
+	// writers change
+	if err := ds.AddConditionalPermission("C2", "TN-IN", false, "tier=2"); err != nil {
+		t.Fatal(err)
+	}
+
+	const rounds = 200
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	// start releases every goroutine at once so that they overlap
+	start := make(chan struct{})
+	run := func(task func(i int) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := 0; i < rounds; i++ {
+				if err := task(i); err != nil {
+					errs <- err
+					return
+				}
+				// Interleave the calls even on a single CPU
+				runtime.Gosched()
+			}
+		}()
+	}
+
+	// Writers toggle rules and settings that the readers' results depend on
+	run(func(i int) error {
+		name := names[1+i%3]
+		if err := ds.AddPermission(name, "KA-IN", false); err != nil {
+			return err
+		}
+		return ds.RemovePermission(name, "KA-IN", false)
+	})
+	run(func(i int) error {
+		if err := ds.AddPermission("C1", "CA-US", true); err != nil {
+			return err
+		}
+		return ds.RemovePermission("C1", "CA-US", true)
+	})
+	run(func(i int) error {
+		return ds.SetMetadata("C2", "tier", fmt.Sprint(i%2))
+	})
+	run(func(i int) error {
+		return ds.SetMaxChildren("P", 4+i%2)
+	})
+	run(func(int) error {
+		// Adding a child checks P's limit
+		if err := ds.AddDistributor("T", "P"); err != nil {
+			return err
+		}
+		_, _, err := ds.RemoveDistributor("T", false, false, false)
+		return err
+	})
+
+	// Readers check that every call still succeeds and never sees a
+	// permission the parent chain does not allow
+	run(func(int) error {
+		allowed, err := ds.CheckPermissions(names, "BLR-KA-IN")
+		if err != nil {
+			return err
+		}
+		if !allowed[0] {
+			return fmt.Errorf("CheckPermissions: P lost BLR-KA-IN")
+		}
+		return nil
+	})
+	run(func(int) error {
+		for _, region := range []string{"GGN-HR-IN", "MDU-TN-IN"} {
+			allowed, err := ds.CheckPermissions(names, region)
+			if err != nil {
+				return err
+			}
+			for i, ok := range allowed {
+				if !ok {
+					return fmt.Errorf("CheckPermissions: %s lost %s", names[i], region)
+				}
+			}
+		}
+		return nil
+	})
+	run(func(i int) error {
+		_, err := ds.Explain(names[i%len(names)], "KA-IN")
+		return err
+	})
+	run(func(i int) error {
+		_, err := ds.EffectiveRegions(names[i%len(names)])
+		return err
+	})
+	run(func(i int) error {
+		_, err := ds.EffectiveRegionsAt(names[i%len(names)], "province")
+		return err
+	})
+	run(func(int) error {
+		_, err := ds.WhoCan("MYS-KA-IN")
+		return err
+	})
+
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
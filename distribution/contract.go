@@ -0,0 +1,311 @@
+package distribution
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Contract is one distribution contract: the distributor it grants rights
+// to, the distributor it is granted through and the regions it covers
+type Contract struct {
+	Distributor string            `json:"distributor" yaml:"distributor"`
+	Parent      string            `json:"parent,omitempty" yaml:"parent,omitempty"`
+	Includes    []string          `json:"includes" yaml:"includes"`
+	Excludes    []string          `json:"excludes,omitempty" yaml:"excludes,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	// IncludeConditions and ExcludeConditions map a rule's region to the
+	// metadata predicate that must hold for the rule to apply
+	IncludeConditions map[string]string `json:"includeConditions,omitempty" yaml:"includeConditions,omitempty"`
+	ExcludeConditions map[string]string `json:"excludeConditions,omitempty" yaml:"excludeConditions,omitempty"`
+
+	// IncludeValidity and ExcludeValidity bound when a rule applies
+	IncludeValidity map[string]Validity `json:"includeValidity,omitempty" yaml:"includeValidity,omitempty"`
+	ExcludeValidity map[string]Validity `json:"excludeValidity,omitempty" yaml:"excludeValidity,omitempty"`
+
+	// IncludePriority and ExcludePriority rank rules under the priority
+	// strategy
+	IncludePriority map[string]int `json:"includePriority,omitempty" yaml:"includePriority,omitempty"`
+	ExcludePriority map[string]int `json:"excludePriority,omitempty" yaml:"excludePriority,omitempty"`
+}
+
+// LoadContracts reads a contract definition file, as YAML if it has a .yaml
+// or .yml extension and as JSON otherwise. The document is either a single
+// contract or a list of contracts under "contracts".
+func LoadContracts(filename string) ([]Contract, error) {
+	var definition struct {
+		Contract  `yaml:",inline"`
+		Contracts []Contract `json:"contracts" yaml:"contracts"`
+	}
+	if err := decodeFile(filename, &definition); err != nil {
+		return nil, err
+	}
+	switch {
+	case definition.Distributor != "" && len(definition.Contracts) > 0:
+		return nil, errors.New("a contract file holds either one contract or a contracts list, not both")
+	case definition.Distributor != "":
+		return []Contract{definition.Contract}, nil
+	case len(definition.Contracts) == 0:
+		return nil, errors.New("no contracts defined")
+	}
+	return definition.Contracts, nil
+}
+
+// expandPatternKey returns a copy of m in which the value for pattern, if
+// any, is set for each of the regions it matched instead
+func expandPatternKey[V any](m map[string]V, pattern string, matches []string) map[string]V {
+	value, exists := m[pattern]
+	if !exists {
+		return m
+	}
+	expanded := make(map[string]V, len(m)+len(matches))
+	for key, v := range m {
+		if key != pattern {
+			expanded[key] = v
+		}
+	}
+	for _, region := range matches {
+		expanded[region] = value
+	}
+	return expanded
+}
+
+// PlanContracts computes the steps that import contracts: creating missing
+// distributors and adding the rules and metadata they declare. Unlike
+// PlanPolicy it never removes anything, so rules the contracts do not
+// mention are kept. Region patterns such as *-TN-IN are replaced by the
+// regions they match, along with any condition, validity or priority given
+// for them.
+// A contract naming a different parent than an existing
+// distributor has is rejected rather than moving it.
+func (ds *DistributionSystem) PlanContracts(contracts []Contract) ([]PlanStep, error) {
+	// Report every invalid region at once so a long contract can be fixed
+	// in one pass
+	var invalid []string
+	contracts = append([]Contract{}, contracts...)
+	for i := range contracts {
+		contract := &contracts[i]
+		for _, set := range []struct {
+			regions    *[]string
+			conditions *map[string]string
+			validity   *map[string]Validity
+			priority   *map[string]int
+		}{
+			{&contract.Includes, &contract.IncludeConditions, &contract.IncludeValidity, &contract.IncludePriority},
+			{&contract.Excludes, &contract.ExcludeConditions, &contract.ExcludeValidity, &contract.ExcludePriority},
+		} {
+			var regions []string
+			for _, region := range *set.regions {
+				if !IsRegionPattern(region) {
+					if !ds.ValidateRegion(ds.CanonicalRegion(region)) {
+						invalid = append(invalid, fmt.Sprintf("contract %d (%s): %s", i+1, contract.Distributor, region))
+					}
+					regions = append(regions, region)
+					continue
+				}
+				matches, err := ds.MatchRegions(region)
+				if err != nil {
+					invalid = append(invalid, fmt.Sprintf("contract %d (%s): %v", i+1, contract.Distributor, err))
+					continue
+				}
+				regions = append(regions, matches...)
+				// A condition, validity or priority given for a pattern
+				// applies to every region it matched
+				*set.conditions = expandPatternKey(*set.conditions, region, matches)
+				*set.validity = expandPatternKey(*set.validity, region, matches)
+				*set.priority = expandPatternKey(*set.priority, region, matches)
+			}
+			*set.regions = regions
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("invalid region codes: %s", strings.Join(invalid, "; "))
+	}
+
+	conditions := make(map[string]map[bool]map[string]string)
+	validities := make(map[string]map[bool]map[string]Validity)
+	priorities := make(map[string]map[bool]map[string]int)
+	for i, contract := range contracts {
+		conditionsByKind := map[bool]map[string]string{true: {}, false: {}}
+		validityByKind := map[bool]map[string]Validity{true: {}, false: {}}
+		priorityByKind := map[bool]map[string]int{true: {}, false: {}}
+		for _, set := range []struct {
+			isInclude  bool
+			regions    []string
+			conditions map[string]string
+			validity   map[string]Validity
+			priority   map[string]int
+		}{
+			{true, contract.Includes, contract.IncludeConditions, contract.IncludeValidity, contract.IncludePriority},
+			{false, contract.Excludes, contract.ExcludeConditions, contract.ExcludeValidity, contract.ExcludePriority},
+		} {
+			rules := ds.canonicalSet(set.regions)
+			for region, when := range set.conditions {
+				region = ds.CanonicalRegion(region)
+				if !rules[region] {
+					return nil, fmt.Errorf("contract %d (%s): condition on %s, which is not one of its rules", i+1, contract.Distributor, region)
+				}
+				if _, _, _, err := parsePredicate(when); err != nil {
+					return nil, fmt.Errorf("contract %d (%s): %w", i+1, contract.Distributor, err)
+				}
+				conditionsByKind[set.isInclude][region] = when
+			}
+			for region, validity := range set.validity {
+				region = ds.CanonicalRegion(region)
+				if !rules[region] {
+					return nil, fmt.Errorf("contract %d (%s): validity on %s, which is not one of its rules", i+1, contract.Distributor, region)
+				}
+				if validity.ValidFrom != nil && validity.ValidUntil != nil && !validity.ValidUntil.After(*validity.ValidFrom) {
+					return nil, fmt.Errorf("contract %d (%s): validity of %s ends before it starts", i+1, contract.Distributor, region)
+				}
+				validityByKind[set.isInclude][region] = validity
+			}
+			for region, priority := range set.priority {
+				region = ds.CanonicalRegion(region)
+				if !rules[region] {
+					return nil, fmt.Errorf("contract %d (%s): priority on %s, which is not one of its rules", i+1, contract.Distributor, region)
+				}
+				priorityByKind[set.isInclude][region] = priority
+			}
+		}
+		conditions[contract.Distributor] = conditionsByKind
+		validities[contract.Distributor] = validityByKind
+		priorities[contract.Distributor] = priorityByKind
+	}
+
+	policy := make(Policy, len(contracts))
+	metadata := make(map[string]map[string]string)
+	for i, contract := range contracts {
+		name := contract.Distributor
+		if name == "" {
+			return nil, fmt.Errorf("contract %d: distributor name is required", i+1)
+		}
+		if _, seen := policy[name]; seen {
+			return nil, fmt.Errorf("contract %d: distributor %s has more than one contract", i+1, name)
+		}
+		entry := PolicyEntry{Parent: contract.Parent, Includes: contract.Includes, Excludes: contract.Excludes}
+		if existing, exists := ds.distributors[name]; exists {
+			current := ""
+			if existing.Parent != nil {
+				current = existing.Parent.Name
+			}
+			if contract.Parent != current {
+				return nil, fmt.Errorf("contract %d: %s has parent %q, not %q", i+1, name, current, contract.Parent)
+			}
+			// Keeping the existing rules in the policy stops PlanPolicy from
+			// removing them
+			entry.Includes = append(sortedKeys(existing.Includes), entry.Includes...)
+			entry.Excludes = append(sortedKeys(existing.Excludes), entry.Excludes...)
+		}
+		policy[name] = entry
+		metadata[name] = contract.Metadata
+	}
+
+	plan, err := ds.PlanPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	for i := range plan {
+		if step := &plan[i]; step.Action == "add" {
+			step.When = conditions[step.Distributor][step.IsInclude][step.Region]
+			step.Validity = validities[step.Distributor][step.IsInclude][step.Region]
+			step.Priority = priorities[step.Distributor][step.IsInclude][step.Region]
+		}
+	}
+
+	// Metadata is set right after the distributors are created, before any
+	// rule whose condition or whose children's checks depend on it
+	var tagging []PlanStep
+	for _, name := range sortedKeys(metadata) {
+		var current map[string]string
+		if existing, exists := ds.distributors[name]; exists {
+			current = existing.Metadata
+		}
+		for _, key := range sortedKeys(metadata[name]) {
+			if value := metadata[name][key]; current[key] != value {
+				tagging = append(tagging, PlanStep{Action: "set-metadata", Distributor: name, Key: key, Value: value})
+			}
+		}
+	}
+	created := 0
+	for created < len(plan) && plan[created].Action == "create" {
+		created++
+	}
+	return append(append(plan[:created:created], tagging...), plan[created:]...), nil
+}
+
+// ExportContract returns the contracts that recreate a distributor with an
+// import: one for each of its ancestors, from the root down, and one for the
+// distributor itself, each with its own rules, conditions, validity,
+// priorities and metadata
+func (ds *DistributionSystem) ExportContract(name string) ([]Contract, error) {
+	distributor, exists := ds.distributors[name]
+	if !exists {
+		return nil, fmt.Errorf("distributor %s does not exist", name)
+	}
+	if parentName, unresolved := ds.unresolvedParents[name]; unresolved {
+		return nil, fmt.Errorf("distributor %s has a missing parent %s", name, parentName)
+	}
+
+	var contracts []Contract
+	for d := distributor; d != nil; d = d.Parent {
+		contract := Contract{
+			Distributor:       d.Name,
+			Includes:          sortedKeys(d.Includes),
+			Excludes:          sortedKeys(d.Excludes),
+			Metadata:          copyNonEmpty(d.Metadata),
+			IncludeConditions: copyNonEmpty(d.IncludeConditions),
+			ExcludeConditions: copyNonEmpty(d.ExcludeConditions),
+			IncludeValidity:   copyNonEmpty(d.IncludeValidity),
+			ExcludeValidity:   copyNonEmpty(d.ExcludeValidity),
+			IncludePriority:   copyNonEmpty(d.IncludePriority),
+			ExcludePriority:   copyNonEmpty(d.ExcludePriority),
+		}
+		if d.Parent != nil {
+			contract.Parent = d.Parent.Name
+		}
+		contracts = append([]Contract{contract}, contracts...)
+	}
+	return contracts, nil
+}
+
+// copyNonEmpty copies a map, returning nil for an empty one so it is left
+// out of the exported contract
+func copyNonEmpty[V any](m map[string]V) map[string]V {
+	if len(m) == 0 {
+		return nil
+	}
+	copied := make(map[string]V, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
+
+// WriteContracts writes contracts as a contract definition file that
+// LoadContracts reads back, in "yaml" or "json"
+func WriteContracts(w io.Writer, contracts []Contract, format string) error {
+	definition := struct {
+		Contracts []Contract `json:"contracts" yaml:"contracts"`
+	}{contracts}
+	switch format {
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(definition); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(definition)
+	default:
+		return fmt.Errorf("unsupported format %s", format)
+	}
+}
@@ -0,0 +1,423 @@
+package distribution
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CityKey returns the city-province-country code of a location
+func CityKey(location *Location) string {
+	return fmt.Sprintf("%s-%s-%s", location.CityCode, location.ProvinceCode, location.CountryCode)
+}
+
+// RegionKey returns the region code of a location at its own level, such as
+// KA-IN for a province, the way region codes are stored
+func RegionKey(location *Location) string {
+	switch {
+	case location.CityCode != "":
+		return CityKey(location)
+	case location.ProvinceCode != "":
+		return location.ProvinceCode + "-" + location.CountryCode
+	default:
+		return location.CountryCode
+	}
+}
+
+// EffectiveRegions returns every city-level location the distributor can
+// distribute in, taking its includes, excludes and parent chain into account.
+// Results are sorted by country, province and city code.
+func (ds *DistributionSystem) EffectiveRegions(distributorName string) ([]*Location, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.effectiveRegions(distributorName)
+}
+
+func (ds *DistributionSystem) effectiveRegions(distributorName string) ([]*Location, error) {
+	regions := []*Location{}
+	err := ds.walkEffectiveRegions(distributorName, func(location *Location) error {
+		regions = append(regions, location)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+// WalkEffectiveRegions calls visit with each location EffectiveRegions would
+// return, in the same order, as soon as it is found to be permitted, so a
+// caller can stream them out. It stops at the first error from visit and
+// returns it. visit runs under the system's read lock and must not change
+// the system.
+func (ds *DistributionSystem) WalkEffectiveRegions(distributorName string, visit func(*Location) error) error {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.walkEffectiveRegions(distributorName, visit)
+}
+
+func (ds *DistributionSystem) walkEffectiveRegions(distributorName string, visit func(*Location) error) error {
+	distributor, exists := ds.distributors[distributorName]
+	if !exists {
+		return fmt.Errorf("distributor %s does not exist", distributorName)
+	}
+
+	cities := ds.cities()
+	sortLocations(cities)
+	for i, location := range cities {
+		if !distributor.HasPermission(CityKey(location)) {
+			continue
+		}
+		if err := visit(location); err != nil {
+			ds.countScanned(i + 1)
+			return err
+		}
+	}
+	ds.countScanned(len(cities))
+	return nil
+}
+
+// cities returns every city-level location exactly once, in no particular order
+func (ds *DistributionSystem) cities() []*Location {
+	var cities []*Location
+	for _, location := range ds.cityIndex {
+		cities = append(cities, location)
+	}
+	return cities
+}
+
+// sortLocations orders locations by country, then province, then city code
+func sortLocations(locations []*Location) {
+	sort.Slice(locations, func(i, j int) bool {
+		a, b := locations[i], locations[j]
+		if a.CountryCode != b.CountryCode {
+			return a.CountryCode < b.CountryCode
+		}
+		if a.ProvinceCode != b.ProvinceCode {
+			return a.ProvinceCode < b.ProvinceCode
+		}
+		return a.CityCode < b.CityCode
+	})
+}
+
+// effectiveRegionSet returns the city keys a distributor can serve as a set
+func (ds *DistributionSystem) effectiveRegionSet(distributorName string) (map[string]bool, error) {
+	regions, err := ds.EffectiveRegions(distributorName)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool, len(regions))
+	for _, location := range regions {
+		set[CityKey(location)] = true
+	}
+	return set, nil
+}
+
+// OverlapMatrix computes, for every pair of distributors, how many city-level
+// regions both can serve. The matrix rows and columns follow the returned
+// distributor names, which are sorted.
+func (ds *DistributionSystem) OverlapMatrix() ([]string, [][]int, error) {
+	names := ds.distributorNames()
+	sets := make([]map[string]bool, len(names))
+	for i, name := range names {
+		set, err := ds.effectiveRegionSet(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		sets[i] = set
+	}
+
+	matrix := make([][]int, len(names))
+	for i := range matrix {
+		matrix[i] = make([]int, len(names))
+	}
+
+	// Each worker fills whole rows of the upper triangle and mirrors them,
+	// so no two workers write the same cell
+	rows := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rows {
+				for j := i; j < len(names); j++ {
+					count := intersectionSize(sets[i], sets[j])
+					matrix[i][j] = count
+					matrix[j][i] = count
+				}
+			}
+		}()
+	}
+	for i := range names {
+		rows <- i
+	}
+	close(rows)
+	wg.Wait()
+
+	return names, matrix, nil
+}
+
+// intersectionSize counts the keys present in both sets
+func intersectionSize(a, b map[string]bool) int {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	count := 0
+	for key := range a {
+		if b[key] {
+			count++
+		}
+	}
+	return count
+}
+
+// ProvinceCoverage is the share of a province's cities a distributor can serve
+type ProvinceCoverage struct {
+	Province string
+	Covered  int
+	Total    int
+}
+
+// Ratio returns the covered fraction of the province's cities
+func (pc ProvinceCoverage) Ratio() float64 {
+	if pc.Total == 0 {
+		return 0
+	}
+	return float64(pc.Covered) / float64(pc.Total)
+}
+
+// ProvinceCoverage returns, keyed by province-country code, how many of each
+// province's cities the distributor can serve. Provinces where it serves no
+// city are omitted.
+func (ds *DistributionSystem) ProvinceCoverage(distributorName string) (map[string]ProvinceCoverage, error) {
+	regions, err := ds.EffectiveRegions(distributorName)
+	if err != nil {
+		return nil, err
+	}
+
+	coverage := make(map[string]ProvinceCoverage)
+	for _, location := range regions {
+		key := location.ProvinceCode + "-" + location.CountryCode
+		pc := coverage[key]
+		pc.Province = key
+		pc.Covered++
+		coverage[key] = pc
+	}
+	for _, location := range ds.cities() {
+		key := location.ProvinceCode + "-" + location.CountryCode
+		if pc, exists := coverage[key]; exists {
+			pc.Total++
+			coverage[key] = pc
+		}
+	}
+	return coverage, nil
+}
+
+// RegionCoverage is how many of a province's or country's cities a
+// distributor can serve
+type RegionCoverage struct {
+	Region  string
+	Name    string
+	Covered int
+	Total   int
+}
+
+// EffectiveRegionsAt groups the cities a distributor can serve by province
+// ("province") or country ("country"), returning each region containing at
+// least one of them with how many of its cities are covered, sorted by
+// region code
+func (ds *DistributionSystem) EffectiveRegionsAt(distributorName, level string) ([]RegionCoverage, error) {
+	var regionOf func(*Location) string
+	switch level {
+	case "province":
+		regionOf = func(location *Location) string { return location.ProvinceCode + "-" + location.CountryCode }
+	case "country":
+		regionOf = func(location *Location) string { return location.CountryCode }
+	default:
+		return nil, fmt.Errorf("unsupported level %s (province or country)", level)
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	regions, err := ds.effectiveRegions(distributorName)
+	if err != nil {
+		return nil, err
+	}
+	covered := make(map[string]int)
+	for _, location := range regions {
+		covered[regionOf(location)]++
+	}
+	totals := make(map[string]int)
+	for _, location := range ds.cities() {
+		if region := regionOf(location); covered[region] > 0 {
+			totals[region]++
+		}
+	}
+
+	coverage := make([]RegionCoverage, 0, len(covered))
+	for _, region := range sortedKeys(covered) {
+		coverage = append(coverage, RegionCoverage{
+			Region:  region,
+			Name:    ds.RegionName(region),
+			Covered: covered[region],
+			Total:   totals[region],
+		})
+	}
+	return coverage, nil
+}
+
+// UncoveredRegions returns every city-level location that no distributor can
+// serve, sorted by country, province and city code
+func (ds *DistributionSystem) UncoveredRegions() []*Location {
+	cities := ds.cities()
+	ds.countScanned(len(cities))
+
+	uncovered := []*Location{}
+	for _, location := range cities {
+		key := CityKey(location)
+		covered := false
+		for _, dist := range ds.distributors {
+			if dist.HasPermission(key) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			uncovered = append(uncovered, location)
+		}
+	}
+
+	sortLocations(uncovered)
+	return uncovered
+}
+
+// WhoCan returns the sorted names of every distributor whose effective
+// permissions, including its ancestors', cover region
+func (ds *DistributionSystem) WhoCan(region string) ([]string, error) {
+	able := []string{}
+	err := ds.WalkWhoCan(region, func(name string) error {
+		able = append(able, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return able, nil
+}
+
+// WalkWhoCan calls visit with the name of each distributor WhoCan would
+// return, in the same order, as soon as it is found to cover region, so a
+// caller can stream them out. It stops at the first error from visit and
+// returns it. visit runs under the system's read lock and must not change
+// the system.
+func (ds *DistributionSystem) WalkWhoCan(region string, visit func(string) error) error {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	region = ds.CanonicalRegion(region)
+	if !ds.ValidateRegion(region) {
+		return fmt.Errorf("invalid region code: %s", region)
+	}
+	for _, name := range ds.distributorNames() {
+		if !ds.distributors[name].HasPermission(region) {
+			continue
+		}
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountryReach reports which distributors can serve at least one city in a
+// country, and how many distributors can do so in each of its provinces
+// (keyed by province-country code)
+func (ds *DistributionSystem) CountryReach(country string) ([]string, map[string]int, error) {
+	country = ds.CanonicalRegion(country)
+	if strings.Contains(country, "-") || !ds.ValidateRegion(country) {
+		return nil, nil, fmt.Errorf("invalid country code: %s", country)
+	}
+
+	var cities []*Location
+	perProvince := make(map[string]int)
+	for _, location := range ds.cities() {
+		if location.CountryCode == country {
+			cities = append(cities, location)
+			perProvince[location.ProvinceCode+"-"+location.CountryCode] = 0
+		}
+	}
+
+	var reaching []string
+	for _, name := range ds.distributorNames() {
+		dist := ds.distributors[name]
+		ds.countScanned(len(cities))
+		served := make(map[string]bool)
+		for _, location := range cities {
+			province := location.ProvinceCode + "-" + location.CountryCode
+			if !served[province] && dist.HasPermission(CityKey(location)) {
+				served[province] = true
+			}
+		}
+		if len(served) > 0 {
+			reaching = append(reaching, name)
+		}
+		for province := range served {
+			perProvince[province]++
+		}
+	}
+	return reaching, perProvince, nil
+}
+
+// CountryFence returns the effective regions of a distributor that lie
+// outside the allowed countries
+func (ds *DistributionSystem) CountryFence(distributorName string, allowed []string) ([]*Location, error) {
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, country := range allowed {
+		country = ds.CanonicalRegion(strings.TrimSpace(country))
+		if strings.Contains(country, "-") || !ds.ValidateRegion(country) {
+			return nil, fmt.Errorf("invalid country code: %s", country)
+		}
+		allowedSet[country] = true
+	}
+
+	regions, err := ds.EffectiveRegions(distributorName)
+	if err != nil {
+		return nil, err
+	}
+
+	violations := []*Location{}
+	for _, location := range regions {
+		if !allowedSet[location.CountryCode] {
+			violations = append(violations, location)
+		}
+	}
+	return violations, nil
+}
+
+// CountryExclusive finds the distributors whose effective regions are
+// exactly the cities of one country: all of them and nothing outside it. The
+// result maps each such country to the sorted names of its distributors.
+func (ds *DistributionSystem) CountryExclusive() map[string][]string {
+	citiesPerCountry := make(map[string]int)
+	for _, location := range ds.cities() {
+		citiesPerCountry[location.CountryCode]++
+	}
+
+	exclusive := make(map[string][]string)
+	for _, name := range ds.distributorNames() {
+		regions, _ := ds.EffectiveRegions(name)
+		if len(regions) == 0 {
+			continue
+		}
+		// EffectiveRegions sorts by country, so a single-country set starts
+		// and ends in the same country
+		country := regions[0].CountryCode
+		if regions[len(regions)-1].CountryCode == country && len(regions) == citiesPerCountry[country] {
+			exclusive[country] = append(exclusive[country], name)
+		}
+	}
+	return exclusive
+}
@@ -0,0 +1,95 @@
+package distribution
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWalkEffectiveRegions(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"D"}, include("D", "IN"), exclude("D", "TN-IN"), include("D", "CA-US"))
+
+	want, err := ds.EffectiveRegions("D")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, location := range want {
+		keys = append(keys, CityKey(location))
+	}
+	if wantKeys := []string{"GGN-HR-IN", "BLR-KA-IN", "MYS-KA-IN", "LA-CA-US", "SF-CA-US"}; !reflect.DeepEqual(keys, wantKeys) {
+		t.Fatalf("EffectiveRegions = %v, want %v", keys, wantKeys)
+	}
+
+	var walked []*Location
+	if err := ds.WalkEffectiveRegions("D", func(location *Location) error {
+		walked = append(walked, location)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(walked, want) {
+		t.Errorf("WalkEffectiveRegions visited %v, want %v", walked, want)
+	}
+
+	stop := errors.New("stop")
+	visits := 0
+	err = ds.WalkEffectiveRegions("D", func(*Location) error {
+		visits++
+		if visits == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || visits != 2 {
+		t.Errorf("WalkEffectiveRegions returned %v after %d visits, want %v after 2", err, visits, stop)
+	}
+
+	if err := ds.WalkEffectiveRegions("missing", func(*Location) error { return nil }); err == nil {
+		t.Error("WalkEffectiveRegions accepted an unknown distributor")
+	}
+}
+
+func TestWalkWhoCan(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"P", "C"}, include("P", "IN"), exclude("P", "KA-IN"), include("C", "TN-IN"))
+	addChain(t, ds, []string{"A"}, include("A", "TN-IN"))
+	addChain(t, ds, []string{"B"}, include("B", "US"))
+
+	want, err := ds.WhoCan("cenai-tn-in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wantNames := []string{"A", "C", "P"}; !reflect.DeepEqual(want, wantNames) {
+		t.Fatalf("WhoCan = %v, want %v", want, wantNames)
+	}
+
+	var walked []string
+	if err := ds.WalkWhoCan("cenai-tn-in", func(name string) error {
+		walked = append(walked, name)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(walked, want) {
+		t.Errorf("WalkWhoCan visited %v, want %v", walked, want)
+	}
+
+	stop := errors.New("stop")
+	visits := 0
+	err = ds.WalkWhoCan("CENAI-TN-IN", func(string) error {
+		visits++
+		if visits == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || visits != 2 {
+		t.Errorf("WalkWhoCan returned %v after %d visits, want %v after 2", err, visits, stop)
+	}
+
+	if err := ds.WalkWhoCan("XX", func(string) error { return nil }); err == nil {
+		t.Error("WalkWhoCan accepted an invalid region")
+	}
+}
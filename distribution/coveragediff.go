@@ -0,0 +1,87 @@
+package distribution
+
+import (
+	"fmt"
+	"os"
+)
+
+// CoverageChange lists the regions a distributor gained and lost between a
+// baseline state and the current one
+type CoverageChange struct {
+	Distributor string
+	Gained      []*Location
+	Lost        []*Location
+}
+
+// LoadBaseline loads another state file against the same locations, for
+// comparing two versions of the distributor data. Unlike LoadState it fails
+// when the file does not exist rather than starting from an empty state.
+func (ds *DistributionSystem) LoadBaseline(filename string) (*DistributionSystem, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+	baseline, err := ds.LoadBaselineFrom(NewFileStore(filename))
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", filename, err)
+	}
+	return baseline, nil
+}
+
+// LoadBaselineFrom loads the state saved in store into a new system sharing
+// ds's locations and aliases
+func (ds *DistributionSystem) LoadBaselineFrom(store Store) (*DistributionSystem, error) {
+	baseline := ds.emptyWithLocations()
+	baseline.aliases = ds.aliases
+	if err := baseline.Load(store); err != nil {
+		return nil, err
+	}
+	return baseline, nil
+}
+
+// CoverageDiff runs the permission engine on both systems and reports, for
+// every distributor whose effective regions differ, what changed going from
+// baseline to ds. A distributor present in only one of them gains or loses
+// all of its regions. Results are sorted by distributor name.
+func (ds *DistributionSystem) CoverageDiff(baseline *DistributionSystem) []CoverageChange {
+	names := make(map[string]bool)
+	for name := range ds.distributors {
+		names[name] = true
+	}
+	for name := range baseline.distributors {
+		names[name] = true
+	}
+
+	return ds.coverageChangesOf(baseline, sortedKeys(names))
+}
+
+// coverageChangesOf compares the effective regions of the named distributors
+// in baseline and ds, keeping those that differ in the order given
+func (ds *DistributionSystem) coverageChangesOf(baseline *DistributionSystem, names []string) []CoverageChange {
+	var changes []CoverageChange
+	for _, name := range names {
+		before, _ := baseline.effectiveRegionSet(name)
+		after, _ := ds.effectiveRegionSet(name)
+		change := CoverageChange{
+			Distributor: name,
+			Gained:      ds.locationsMissingFrom(after, before),
+			Lost:        ds.locationsMissingFrom(before, after),
+		}
+		if len(change.Gained) > 0 || len(change.Lost) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// locationsMissingFrom returns the locations of the city keys in set that are
+// not in other, sorted
+func (ds *DistributionSystem) locationsMissingFrom(set, other map[string]bool) []*Location {
+	var missing []*Location
+	for key := range set {
+		if !other[key] {
+			missing = append(missing, ds.cityIndex[key])
+		}
+	}
+	sortLocations(missing)
+	return missing
+}
@@ -0,0 +1,93 @@
+package distribution
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RegionName returns the human-readable name of a region code at its own
+// level, e.g. "Tamil Nadu, India" for a province code
+func (ds *DistributionSystem) RegionName(region string) string {
+	location, exists := ds.Location(region)
+	if !exists {
+		return "unknown region"
+	}
+	return location.Name()
+}
+
+// Describe writes a Markdown summary of a distributor's configuration for
+// human review: its ancestry, metadata, own rules with resolved region names
+// and the rules it inherits from its ancestors
+func (ds *DistributionSystem) Describe(w io.Writer, name string) error {
+	distributor, exists := ds.distributors[name]
+	if !exists {
+		return fmt.Errorf("distributor %s does not exist", name)
+	}
+
+	chain := []string{name}
+	visited := map[*Distributor]bool{distributor: true}
+	for d := distributor.Parent; d != nil && !visited[d]; d = d.Parent {
+		visited[d] = true
+		chain = append(chain, d.Name)
+	}
+
+	parentName := "none"
+	if distributor.Parent != nil {
+		parentName = distributor.Parent.Name
+	}
+
+	fmt.Fprintf(w, "## Distributor %s\n\n", name)
+	fmt.Fprintf(w, "- **Parent:** %s\n", parentName)
+	fmt.Fprintf(w, "- **Ancestry:** %s\n", strings.Join(chain, " < "))
+	if distributor.MaxChildren > 0 {
+		fmt.Fprintf(w, "- **Max children:** %d\n", distributor.MaxChildren)
+	}
+
+	if len(distributor.Metadata) > 0 {
+		fmt.Fprintf(w, "\n### Metadata\n\n")
+		for _, key := range sortedKeys(distributor.Metadata) {
+			fmt.Fprintf(w, "- %s: %s\n", key, distributor.Metadata[key])
+		}
+	}
+
+	ds.describeRules(w, "Includes", distributor, true)
+	ds.describeRules(w, "Excludes", distributor, false)
+
+	if distributor.Parent != nil {
+		fmt.Fprintf(w, "\n### Inherited from ancestors\n\n")
+		inherited := false
+		for _, ancestorName := range chain[1:] {
+			ancestor := ds.distributors[ancestorName]
+			for _, region := range sortedKeys(ancestor.Includes) {
+				inherited = true
+				fmt.Fprintf(w, "- %s includes `%s` — %s%s\n", ancestorName, region, ds.RegionName(region),
+					ancestor.ruleSuffix(true, region))
+			}
+			for _, region := range sortedKeys(ancestor.Excludes) {
+				inherited = true
+				fmt.Fprintf(w, "- %s excludes `%s` — %s%s\n", ancestorName, region, ds.RegionName(region),
+					ancestor.ruleSuffix(false, region))
+			}
+		}
+		if !inherited {
+			fmt.Fprintln(w, "_Ancestors declare no rules._")
+		}
+	}
+	return nil
+}
+
+func (ds *DistributionSystem) describeRules(w io.Writer, title string, distributor *Distributor, isInclude bool) {
+	rules := distributor.Excludes
+	if isInclude {
+		rules = distributor.Includes
+	}
+	fmt.Fprintf(w, "\n### %s\n\n", title)
+	if len(rules) == 0 {
+		fmt.Fprintln(w, "_None._")
+		return
+	}
+	for _, region := range sortedKeys(rules) {
+		fmt.Fprintf(w, "- `%s` — %s%s\n", region, ds.RegionName(region), distributor.ruleSuffix(isInclude, region))
+	}
+}
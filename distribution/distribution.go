@@ -0,0 +1,836 @@
+// Package distribution implements the distributor permission engine: a
+// hierarchy of distributors whose include and exclude rules decide, together
+// with their ancestors', where each may distribute, over a geography of
+// cities, provinces and countries loaded from CSV.
+package distribution
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Location represents a geographical location with both codes and names
+type Location struct {
+	CityCode     string
+	ProvinceCode string
+	CountryCode  string
+	CityName     string
+	ProvinceName string
+	CountryName  string
+}
+
+// Name returns the location's full name from its own level up, such as
+// "Chennai, Tamil Nadu, India" for a city or "Tamil Nadu, India" for a
+// province
+func (l *Location) Name() string {
+	switch {
+	case l.CityCode != "":
+		return fmt.Sprintf("%s, %s, %s", l.CityName, l.ProvinceName, l.CountryName)
+	case l.ProvinceCode != "":
+		return fmt.Sprintf("%s, %s", l.ProvinceName, l.CountryName)
+	}
+	return l.CountryName
+}
+
+// DistributorData represents the data to be persisted
+type DistributorData struct {
+	Name              string              `yaml:"name"`
+	ParentName        string              `yaml:"parentName"`
+	Includes          map[string]bool     `yaml:"includes"`
+	Excludes          map[string]bool     `yaml:"excludes"`
+	Metadata          map[string]string   `json:",omitempty" yaml:"metadata,omitempty"`
+	IncludeConditions map[string]string   `json:",omitempty" yaml:"includeConditions,omitempty"`
+	ExcludeConditions map[string]string   `json:",omitempty" yaml:"excludeConditions,omitempty"`
+	MaxChildren       int                 `json:",omitempty" yaml:"maxChildren,omitempty"`
+	Quarantined       map[string]bool     `json:",omitempty" yaml:"quarantined,omitempty"`
+	IncludeValidity   map[string]Validity `json:",omitempty" yaml:"includeValidity,omitempty"`
+	ExcludeValidity   map[string]Validity `json:",omitempty" yaml:"excludeValidity,omitempty"`
+	IncludePriority   map[string]int      `json:",omitempty" yaml:"includePriority,omitempty"`
+	ExcludePriority   map[string]int      `json:",omitempty" yaml:"excludePriority,omitempty"`
+}
+
+// Distributor represents a distribution entity with its permissions
+type Distributor struct {
+	Name      string
+	Parent    *Distributor
+	Includes  map[string]bool
+	Excludes  map[string]bool
+	Locations map[string]*Location // Maps location codes to full location info
+	Metadata  map[string]string    // Free-form tags such as tier=premium
+
+	// IncludeConditions and ExcludeConditions map a rule's region to the
+	// metadata predicate that must hold for the rule to apply
+	IncludeConditions map[string]string
+	ExcludeConditions map[string]string
+
+	// IncludeValidity and ExcludeValidity map a rule's region to the time
+	// span during which the rule applies; rules without one always apply
+	IncludeValidity map[string]Validity
+	ExcludeValidity map[string]Validity
+
+	// IncludePriority and ExcludePriority map a rule's region to the
+	// priority the priority strategy ranks it by; rules without one have
+	// priority 0
+	IncludePriority map[string]int
+	ExcludePriority map[string]int
+
+	// Quarantined holds includes set aside because they exceed the parent's
+	// permissions; they take no part in permission checks until reviewed
+	Quarantined map[string]bool
+
+	// MaxChildren caps how many direct children the distributor may have;
+	// 0 means unlimited
+	MaxChildren int
+
+	// strategy resolves conflicts between matching rules; nil means the
+	// default strategy
+	strategy ResolutionStrategy
+
+	// clock returns the time rule validity is evaluated at; nil means the
+	// current time
+	clock func() time.Time
+
+	// subregions is the system's index of the loaded regions by the region
+	// directly containing them; nil when there is no location data
+	subregions map[string]map[string]bool
+
+	// innerRules indexes the regions of the distributor's includes and
+	// excludes by each country and province strictly containing them, so
+	// checks of a whole region find the rules inside it without scanning
+	// every rule. It may still hold rules since removed, which readers skip.
+	innerRules map[string]map[string]bool
+}
+
+func NewDistributor(name string, parent *Distributor) *Distributor {
+	return &Distributor{
+		Name:              name,
+		Parent:            parent,
+		Includes:          make(map[string]bool),
+		Excludes:          make(map[string]bool),
+		Locations:         make(map[string]*Location),
+		Metadata:          make(map[string]string),
+		IncludeConditions: make(map[string]string),
+		ExcludeConditions: make(map[string]string),
+		IncludeValidity:   make(map[string]Validity),
+		ExcludeValidity:   make(map[string]Validity),
+		IncludePriority:   make(map[string]int),
+		ExcludePriority:   make(map[string]int),
+		Quarantined:       make(map[string]bool),
+		innerRules:        make(map[string]map[string]bool),
+	}
+}
+
+// DistributionSystem manages all distributors. Adding, removing and checking
+// distributors and permissions, Explain, CheckPermissions, WhoCan,
+// EffectiveRegions, EffectiveRegionsAt, SetMetadata, SetMaxChildren,
+// DistributorNames, SetStrategy and SaveState are safe for concurrent use.
+// Loading, other reports and maintenance operations that walk the whole
+// system, and calls on a Distributor directly, are not and must not overlap
+// with changes.
+type DistributionSystem struct {
+	// mu guards distributors, their rules and the strategy for the methods
+	// documented as safe for concurrent use
+	mu sync.RWMutex
+
+	distributors map[string]*Distributor
+
+	// countryIndex, provinceIndex and cityIndex hold the loaded locations
+	// by country, province-country and city-province-country key
+	countryIndex  map[string]*Location
+	provinceIndex map[string]*Location
+	cityIndex     map[string]*Location
+
+	// subregions maps each country to its provinces and each province to
+	// its cities, for evaluating permissions on a whole region
+	subregions map[string]map[string]bool
+
+	// loadOptions tunes how locations CSVs are read
+	loadOptions LoadOptions
+
+	// aliases maps alternative region codes to their canonical form
+	aliases map[string]string
+
+	// unresolvedParents records parent names from the state file that did
+	// not match any distributor, keyed by the child's name
+	unresolvedParents map[string]string
+
+	// regionsScanned counts regions evaluated by enumerations, for -timing
+	regionsScanned int64
+
+	// caseSensitiveNames allows distributor names that differ only in case
+	caseSensitiveNames bool
+
+	// strategy is the resolution strategy given to every distributor; nil
+	// means the default strategy
+	strategy ResolutionStrategy
+
+	// backups is how many previous versions of the state file SaveState
+	// keeps
+	backups int
+
+	// clock is given to every distributor; nil means the current time
+	clock func() time.Time
+}
+
+// NewDistributionSystem creates a new system instance
+func NewDistributionSystem() *DistributionSystem {
+	return &DistributionSystem{
+		distributors:      make(map[string]*Distributor),
+		countryIndex:      make(map[string]*Location),
+		provinceIndex:     make(map[string]*Location),
+		cityIndex:         make(map[string]*Location),
+		subregions:        make(map[string]map[string]bool),
+		aliases:           make(map[string]string),
+		unresolvedParents: make(map[string]string),
+	}
+}
+
+// LoadLocationData loads geographical data from CSV. When hasHeader is false
+// the first row is treated as data rather than skipped.
+func (ds *DistributionSystem) LoadLocationData(filename string, hasHeader bool) error {
+	return readLocations(filename, hasHeader, ds.loadOptions, func(location *Location) {
+		ds.canonicalizeLocation(location)
+		ds.addLocation(location)
+	})
+}
+
+// addLocation indexes a canonicalized location under its city, province and
+// country keys, down to the level the load options allow, replacing any
+// names already stored under them
+func (ds *DistributionSystem) addLocation(location *Location) {
+	// Keys are joined directly; fmt.Sprintf costs a noticeable share of a
+	// large load
+	provinceKey := location.ProvinceCode + "-" + location.CountryCode
+	countryKey := location.CountryCode
+
+	indexLevel(ds.countryIndex, countryKey, Location{CountryCode: location.CountryCode, CountryName: location.CountryName})
+	if depth := ds.loadOptions.indexDepth(); depth >= 2 {
+		indexLevel(ds.provinceIndex, provinceKey, Location{
+			ProvinceCode: location.ProvinceCode,
+			CountryCode:  location.CountryCode,
+			ProvinceName: location.ProvinceName,
+			CountryName:  location.CountryName,
+		})
+		ds.addSubregion(countryKey, provinceKey)
+		if depth == 3 {
+			cityKey := location.CityCode + "-" + provinceKey
+			ds.cityIndex[cityKey] = location
+			ds.addSubregion(provinceKey, cityKey)
+		}
+	}
+}
+
+// readLocationRecords parses a locations CSV row by row and calls fn for
+// every row, reporting progress as options ask. It warns on stderr when the
+// first row does not look like what hasHeader says.
+func readLocationRecords(filename string, hasHeader bool, options LoadOptions, fn func(*Location)) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+	bufferSize := options.BufferSize
+	if bufferSize == 0 {
+		bufferSize = defaultBufferSize
+	}
+	counter := &progressReader{r: file}
+	buffered := bufio.NewReaderSize(counter, bufferSize)
+	// The CSV reader reads through buffered rather than adding its own buffer
+	reader := csv.NewReader(buffered)
+	reader.ReuseRecord = true
+	// Report about every 1% of the file, and at least every 4 MiB
+	step := max(size/100, 1)
+	step = min(step, 4<<20)
+	var reported int64
+	rows := 0
+
+	first := true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rows++
+		// Bytes still in the buffer have not been parsed yet
+		if consumed := counter.read - int64(buffered.Buffered()); options.Progress != nil && consumed-reported >= step && consumed < size {
+			reported = consumed
+			options.Progress(filename, consumed, size, rows)
+		}
+
+		if first {
+			first = false
+			header := looksLikeHeader(record)
+			if hasHeader && !header {
+				slog.Warn(fmt.Sprintf("first row of %s looks like data but is being skipped as a header", filename), "operation", "load-locations", "file", filename)
+			} else if !hasHeader && header {
+				slog.Warn(fmt.Sprintf("first row of %s looks like a header but is being loaded as data", filename), "operation", "load-locations", "file", filename)
+			}
+			if hasHeader {
+				continue
+			}
+		}
+
+		if len(record) >= 6 {
+			fn(&Location{
+				CityCode:     record[0],
+				ProvinceCode: record[1],
+				CountryCode:  record[2],
+				CityName:     record[3],
+				ProvinceName: record[4],
+				CountryName:  record[5],
+			})
+		}
+	}
+	if options.Progress != nil {
+		options.Progress(filename, counter.read, size, rows)
+	}
+	return nil
+}
+
+// looksLikeHeader reports whether a row is unlikely to be location data,
+// i.e. its code columns are not plain upper-case alphanumerics
+func looksLikeHeader(record []string) bool {
+	if len(record) < 3 {
+		return true
+	}
+	for _, code := range record[:3] {
+		for _, r := range code {
+			if !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// distributorFromData creates a distributor from its persisted record,
+// leaving the parent link for the caller to resolve
+func (ds *DistributionSystem) distributorFromData(name string, data DistributorData) *Distributor {
+	dist := NewDistributor(name, nil)
+	if data.Includes != nil {
+		dist.Includes = data.Includes
+	}
+	if data.Excludes != nil {
+		dist.Excludes = data.Excludes
+	}
+	if data.Metadata != nil {
+		dist.Metadata = data.Metadata
+	}
+	if data.IncludeConditions != nil {
+		dist.IncludeConditions = data.IncludeConditions
+	}
+	if data.ExcludeConditions != nil {
+		dist.ExcludeConditions = data.ExcludeConditions
+	}
+	if data.Quarantined != nil {
+		dist.Quarantined = data.Quarantined
+	}
+	if data.IncludeValidity != nil {
+		dist.IncludeValidity = data.IncludeValidity
+	}
+	if data.ExcludeValidity != nil {
+		dist.ExcludeValidity = data.ExcludeValidity
+	}
+	if data.IncludePriority != nil {
+		dist.IncludePriority = data.IncludePriority
+	}
+	if data.ExcludePriority != nil {
+		dist.ExcludePriority = data.ExcludePriority
+	}
+	dist.MaxChildren = data.MaxChildren
+	dist.strategy = ds.strategy
+	dist.clock = ds.clock
+	dist.Locations = ds.cityIndex
+	dist.subregions = ds.subregions
+	dist.reindexRules()
+	return dist
+}
+
+// Records returns the persisted form of every distributor, sorted by name
+func (ds *DistributionSystem) Records() []DistributorData {
+	data := ds.distributorData()
+	records := make([]DistributorData, 0, len(data))
+	for _, name := range sortedKeys(data) {
+		records = append(records, data[name])
+	}
+	return records
+}
+
+// distributorData converts every distributor to its persisted form
+func (ds *DistributionSystem) distributorData() map[string]DistributorData {
+	distributorsData := make(map[string]DistributorData)
+
+	for name, dist := range ds.distributors {
+		var parentName string
+		if dist.Parent != nil {
+			parentName = dist.Parent.Name
+		}
+
+		distributorsData[name] = DistributorData{
+			Name:              dist.Name,
+			ParentName:        parentName,
+			Includes:          dist.Includes,
+			Excludes:          dist.Excludes,
+			Metadata:          dist.Metadata,
+			IncludeConditions: dist.IncludeConditions,
+			ExcludeConditions: dist.ExcludeConditions,
+			MaxChildren:       dist.MaxChildren,
+			Quarantined:       dist.Quarantined,
+			IncludeValidity:   dist.IncludeValidity,
+			ExcludeValidity:   dist.ExcludeValidity,
+			IncludePriority:   dist.IncludePriority,
+			ExcludePriority:   dist.ExcludePriority,
+		}
+	}
+	return distributorsData
+}
+
+func (d *Distributor) AddPermission(permission string, isInclude bool) error {
+	// An exclude can only narrow what the parent allows, so only includes
+	// need to be checked against the parent
+	if isInclude && d.Parent != nil {
+		if !d.Parent.admits(permission) {
+			return fmt.Errorf("parent distributor does not have permission for: %s", permission)
+		}
+	}
+
+	if isInclude {
+		d.Includes[permission] = true
+	} else {
+		d.Excludes[permission] = true
+	}
+	d.indexRule(permission)
+	return nil
+}
+
+// enclosingRegions returns the keys of every region containing region, from
+// its country down to region itself when it is a city. These are exactly the
+// rules isSubregion matches, so a distributor's rule maps can be probed with
+// at most three lookups instead of being scanned.
+func enclosingRegions(region string) []string {
+	keys := make([]string, 0, 3)
+	country := strings.LastIndexByte(region, '-')
+	keys = append(keys, region[country+1:])
+	if country < 0 {
+		return keys
+	}
+	province := strings.LastIndexByte(region[:country], '-')
+	keys = append(keys, region[province+1:])
+	if province >= 0 && strings.IndexByte(region[:province], '-') < 0 {
+		keys = append(keys, region)
+	}
+	return keys
+}
+
+// matchingRules returns the applicable includes or excludes of the
+// distributor that contain region, coarsest first
+func (d *Distributor) matchingRules(isInclude bool, region string) []string {
+	rules := d.Excludes
+	if isInclude {
+		rules = d.Includes
+	}
+	var matches []string
+	for _, key := range enclosingRegions(region) {
+		if rules[key] && d.ruleApplies(isInclude, key) {
+			matches = append(matches, key)
+		}
+	}
+	return matches
+}
+
+func isSubregion(region1, region2 []string) bool {
+	// If region2 is a country code
+	if len(region2) == 1 {
+		return region1[len(region1)-1] == region2[0]
+	}
+
+	// If region2 is a province-country code
+	if len(region2) == 2 {
+		return len(region1) >= 2 &&
+			region1[len(region1)-2] == region2[0] &&
+			region1[len(region1)-1] == region2[1]
+	}
+
+	// If region2 is a city-province-country code
+	if len(region2) == 3 {
+		return len(region1) == 3 &&
+			region1[0] == region2[0] &&
+			region1[1] == region2[1] &&
+			region1[2] == region2[2]
+	}
+
+	return false
+}
+
+// AddDistributor adds a new distributor to the system
+func (ds *DistributionSystem) AddDistributor(name string, parentName string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if err := ds.checkNameAvailable(name, ""); err != nil {
+		return err
+	}
+
+	var parent *Distributor
+	if parentName != "" {
+		var exists bool
+		parent, exists = ds.distributors[parentName]
+		if !exists {
+			return fmt.Errorf("parent distributor %s does not exist", parentName)
+		}
+		if err := ds.checkCapacity(parent); err != nil {
+			return err
+		}
+	}
+
+	distributor := NewDistributor(name, parent)
+	distributor.strategy = ds.strategy
+	distributor.clock = ds.clock
+	distributor.Locations = ds.cityIndex
+	distributor.subregions = ds.subregions
+	ds.distributors[name] = distributor
+	return nil
+}
+
+// checkNameAvailable fails if name is taken, or differs only in case from a
+// taken name while names are case-insensitive. The distributor named except,
+// if any, is ignored so a distributor can be renamed to a new case of its
+// own name.
+func (ds *DistributionSystem) checkNameAvailable(name, except string) error {
+	if _, exists := ds.distributors[name]; exists && name != except {
+		return fmt.Errorf("distributor %s already exists", name)
+	}
+	if !ds.caseSensitiveNames {
+		for existing := range ds.distributors {
+			if existing != except && strings.EqualFold(existing, name) {
+				return fmt.Errorf("distributor %s conflicts with existing distributor %s (names are case-insensitive)", name, existing)
+			}
+		}
+	}
+	return nil
+}
+
+// SetParent changes the parent of a distributor. An empty parentName makes it
+// a root. Parents that would create a cycle are rejected.
+func (ds *DistributionSystem) SetParent(name, parentName string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.setParent(name, parentName)
+}
+
+func (ds *DistributionSystem) setParent(name, parentName string) error {
+	distributor, exists := ds.distributors[name]
+	if !exists {
+		return fmt.Errorf("distributor %s does not exist", name)
+	}
+
+	var parent *Distributor
+	if parentName != "" {
+		parent, exists = ds.distributors[parentName]
+		if !exists {
+			return fmt.Errorf("parent distributor %s does not exist", parentName)
+		}
+		if isAncestorOrSelf(distributor, parent) {
+			chain := []string{name}
+			for d := parent; d != distributor; d = d.Parent {
+				chain = append(chain, d.Name)
+			}
+			return fmt.Errorf("cannot make %s the parent of %s: it would create the cycle %s",
+				parentName, name, strings.Join(append(chain, name), " -> "))
+		}
+		if distributor.Parent != parent {
+			if err := ds.checkCapacity(parent); err != nil {
+				return err
+			}
+		}
+	}
+
+	distributor.Parent = parent
+	delete(ds.unresolvedParents, name)
+	return nil
+}
+
+// RenameDistributor gives a distributor a new name. Children refer to their
+// parent directly, so they follow the rename and are saved with the new
+// parent name.
+func (ds *DistributionSystem) RenameDistributor(oldName, newName string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	distributor, exists := ds.distributors[oldName]
+	if !exists {
+		return fmt.Errorf("distributor %s does not exist", oldName)
+	}
+	if newName == "" {
+		return errors.New("new name must not be empty")
+	}
+	if err := ds.checkNameAvailable(newName, oldName); err != nil {
+		return err
+	}
+
+	delete(ds.distributors, oldName)
+	distributor.Name = newName
+	ds.distributors[newName] = distributor
+	if parentName, unresolved := ds.unresolvedParents[oldName]; unresolved {
+		delete(ds.unresolvedParents, oldName)
+		ds.unresolvedParents[newName] = parentName
+	}
+	return nil
+}
+
+// AddPermission adds a permission for a distributor
+func (ds *DistributionSystem) AddPermission(distributorName, region string, isInclude bool) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.addPermission(distributorName, region, isInclude)
+}
+
+func (ds *DistributionSystem) addPermission(distributorName, region string, isInclude bool) error {
+	distributor, exists := ds.distributors[distributorName]
+	if !exists {
+		return fmt.Errorf("distributor %s does not exist", distributorName)
+	}
+
+	region = ds.CanonicalRegion(region)
+	if !ds.ValidateRegion(region) {
+		return fmt.Errorf("invalid region code: %s", region)
+	}
+
+	return distributor.AddPermission(region, isInclude)
+}
+
+// RemovePermission removes an include or exclude from a distributor
+func (ds *DistributionSystem) RemovePermission(distributorName, region string, isInclude bool) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	distributor, exists := ds.distributors[distributorName]
+	if !exists {
+		return fmt.Errorf("distributor %s does not exist", distributorName)
+	}
+
+	region = ds.CanonicalRegion(region)
+	rules, kind := distributor.Excludes, "exclude"
+	if isInclude {
+		rules, kind = distributor.Includes, "include"
+	}
+	if !rules[region] {
+		return fmt.Errorf("distributor %s has no %s permission for %s", distributorName, kind, region)
+	}
+
+	distributor.deleteRule(isInclude, region)
+	return nil
+}
+
+// deleteRule removes an include, in force or quarantined, or an exclude of
+// the distributor together with the predicate, validity and priority kept
+// for it, so none of them outlives the rule. Every removal of a rule goes
+// through here.
+func (d *Distributor) deleteRule(isInclude bool, region string) {
+	if isInclude {
+		delete(d.Includes, region)
+		delete(d.Quarantined, region)
+		delete(d.IncludeConditions, region)
+		delete(d.IncludeValidity, region)
+		delete(d.IncludePriority, region)
+		return
+	}
+	delete(d.Excludes, region)
+	delete(d.ExcludeConditions, region)
+	delete(d.ExcludeValidity, region)
+	delete(d.ExcludePriority, region)
+}
+
+// ReplacePermissions swaps a distributor's entire include and exclude sets.
+// Every region is validated, including against the parent, before anything
+// changes, so either both sets are replaced or neither is.
+func (ds *DistributionSystem) ReplacePermissions(distributorName string, includes, excludes []string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	distributor, exists := ds.distributors[distributorName]
+	if !exists {
+		return fmt.Errorf("distributor %s does not exist", distributorName)
+	}
+
+	staged := NewDistributor(distributorName, distributor.Parent)
+	for _, set := range []struct {
+		regions   []string
+		isInclude bool
+	}{{includes, true}, {excludes, false}} {
+		for _, region := range set.regions {
+			region = ds.CanonicalRegion(region)
+			if !ds.ValidateRegion(region) {
+				return fmt.Errorf("invalid region code: %s", region)
+			}
+			if err := staged.AddPermission(region, set.isInclude); err != nil {
+				return err
+			}
+		}
+	}
+
+	distributor.Includes = staged.Includes
+	distributor.Excludes = staged.Excludes
+	distributor.innerRules = staged.innerRules
+	distributor.IncludeConditions = staged.IncludeConditions
+	distributor.ExcludeConditions = staged.ExcludeConditions
+	distributor.IncludeValidity = staged.IncludeValidity
+	distributor.ExcludeValidity = staged.ExcludeValidity
+	distributor.IncludePriority = staged.IncludePriority
+	distributor.ExcludePriority = staged.ExcludePriority
+	return nil
+}
+
+// CheckPermission checks if a distributor has permission for a region
+func (ds *DistributionSystem) CheckPermission(distributorName, region string) (bool, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	distributor, exists := ds.distributors[distributorName]
+	if !exists {
+		return false, fmt.Errorf("distributor %s does not exist", distributorName)
+	}
+
+	region = ds.CanonicalRegion(region)
+	if !ds.ValidateRegion(region) {
+		return false, fmt.Errorf("invalid region code: %s", region)
+	}
+
+	return distributor.HasPermission(region), nil
+}
+
+// CheckPermissions checks one region for several distributors in parallel,
+// returning the results in the order of names. Any unknown distributor or an
+// invalid region fails the whole call.
+func (ds *DistributionSystem) CheckPermissions(names []string, region string) ([]bool, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	region = ds.CanonicalRegion(region)
+	if !ds.ValidateRegion(region) {
+		return nil, fmt.Errorf("invalid region code: %s", region)
+	}
+	distributors := make([]*Distributor, len(names))
+	for i, name := range names {
+		distributor, exists := ds.distributors[name]
+		if !exists {
+			return nil, fmt.Errorf("distributor %s does not exist", name)
+		}
+		distributors[i] = distributor
+	}
+
+	results := make([]bool, len(names))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), len(names)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = distributors[i].HasPermission(region)
+			}
+		}()
+	}
+	for i := range distributors {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results, nil
+}
+
+// LocationCount returns how many region keys, at all three levels, the
+// loaded location data provides
+func (ds *DistributionSystem) LocationCount() int {
+	return len(ds.countryIndex) + len(ds.provinceIndex) + len(ds.cityIndex)
+}
+
+// SetCaseSensitiveNames controls whether AddDistributor accepts names that
+// differ from an existing distributor only in case
+func (ds *DistributionSystem) SetCaseSensitiveNames(caseSensitive bool) {
+	ds.caseSensitiveNames = caseSensitive
+}
+
+// ValidateRegion checks if a region code, or its canonical form, exists
+func (ds *DistributionSystem) ValidateRegion(region string) bool {
+	_, exists := ds.lookupLocation(ds.CanonicalRegion(region))
+	return exists
+}
+
+// Location returns the location record for a region code, resolving aliases
+func (ds *DistributionSystem) Location(region string) (*Location, bool) {
+	return ds.lookupLocation(ds.CanonicalRegion(region))
+}
+
+// HasDistributor reports whether a distributor with the given name exists
+func (ds *DistributionSystem) HasDistributor(name string) bool {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	_, exists := ds.distributors[name]
+	return exists
+}
+
+// ListDistributors prints all distributors and their permissions
+func (ds *DistributionSystem) ListDistributors() {
+	fmt.Println("Registered Distributors:")
+	for name, dist := range ds.distributors {
+		parentName := "none"
+		if dist.Parent != nil {
+			parentName = dist.Parent.Name
+		}
+		if dist.MaxChildren > 0 {
+			fmt.Printf("- %s (Parent: %s, max children: %d)\n", name, parentName, dist.MaxChildren)
+		} else {
+			fmt.Printf("- %s (Parent: %s)\n", name, parentName)
+		}
+		if len(dist.Metadata) > 0 {
+			fmt.Println("  Metadata:")
+			for key, value := range dist.Metadata {
+				fmt.Printf("    - %s=%s\n", key, value)
+			}
+		}
+		fmt.Println("  Includes:")
+		for region := range dist.Includes {
+			fmt.Printf("    - %s%s\n", region, dist.ruleSuffix(true, region))
+		}
+		fmt.Println("  Excludes:")
+		for region := range dist.Excludes {
+			fmt.Printf("    - %s%s\n", region, dist.ruleSuffix(false, region))
+		}
+		if len(dist.Quarantined) > 0 {
+			fmt.Println("  Quarantined includes:")
+			for region := range dist.Quarantined {
+				fmt.Printf("    - %s%s\n", region, conditionSuffix(dist.IncludeConditions, region))
+			}
+		}
+		fmt.Println()
+	}
+}
+
+// countScanned records that n regions were evaluated by an enumeration
+func (ds *DistributionSystem) countScanned(n int) {
+	atomic.AddInt64(&ds.regionsScanned, int64(n))
+}
+
+// RegionsScanned returns how many regions enumerations such as EffectiveRegions have evaluated
+func (ds *DistributionSystem) RegionsScanned() int64 {
+	return atomic.LoadInt64(&ds.regionsScanned)
+}
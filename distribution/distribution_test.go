@@ -0,0 +1,181 @@
+package distribution
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testLocations holds two countries: IN with the provinces KA (BLR, MYS),
+// TN (CENAI, MDU) and HR (GGN), and US with CA (LA, SF) and NY (NYC)
+const testLocations = "testdata/locations.csv"
+
+// newTestSystem returns a system with testLocations loaded and no
+// distributors
+func newTestSystem(t testing.TB) *DistributionSystem {
+	t.Helper()
+	ds := NewDistributionSystem()
+	if err := ds.LoadLocationData(testLocations, true); err != nil {
+		t.Fatalf("loading %s: %v", testLocations, err)
+	}
+	return ds
+}
+
+// testRule is one include or exclude given to a test distributor
+type testRule struct {
+	distributor string
+	region      string
+	isInclude   bool
+}
+
+func include(distributor, region string) testRule { return testRule{distributor, region, true} }
+func exclude(distributor, region string) testRule { return testRule{distributor, region, false} }
+
+// addChain adds distributors, each the parent of the next, and then rules
+// in order, failing the test on any error
+func addChain(t testing.TB, ds *DistributionSystem, names []string, rules ...testRule) {
+	t.Helper()
+	parent := ""
+	for _, name := range names {
+		if err := ds.AddDistributor(name, parent); err != nil {
+			t.Fatalf("adding distributor %s: %v", name, err)
+		}
+		parent = name
+	}
+	for _, rule := range rules {
+		if err := ds.AddPermission(rule.distributor, rule.region, rule.isInclude); err != nil {
+			t.Fatalf("adding %+v: %v", rule, err)
+		}
+	}
+}
+
+// assertChecks checks every region against want for distributor, and that
+// Explain reaches the same outcome
+func assertChecks(t *testing.T, ds *DistributionSystem, distributor string, want map[string]bool) {
+	t.Helper()
+	for _, region := range sortedKeys(want) {
+		allowed, err := ds.CheckPermission(distributor, region)
+		if err != nil {
+			t.Errorf("CheckPermission(%s, %s): %v", distributor, region, err)
+			continue
+		}
+		if allowed != want[region] {
+			t.Errorf("CheckPermission(%s, %s) = %v, want %v", distributor, region, allowed, want[region])
+		}
+		decision, err := ds.Explain(distributor, region)
+		if err != nil {
+			t.Errorf("Explain(%s, %s): %v", distributor, region, err)
+			continue
+		}
+		if decision.Allowed != allowed {
+			t.Errorf("Explain(%s, %s).Allowed = %v, CheckPermission says %v; trace %q", distributor, region, decision.Allowed, allowed, decision.Trace)
+		}
+	}
+}
+
+// letterCode returns a two-letter code for i, which must be below 676
+func letterCode(i int) string {
+	return string(rune('A'+i/26)) + string(rune('A'+i%26))
+}
+
+// newLargeSystem returns a system over a generated world of countries ×
+// provinces × cities locations and chains of four distributors: a root
+// including a country less one province, a child including a province, a
+// grandchild including the province less one city and a leaf including one
+// city
+func newLargeSystem(tb testing.TB, countries, provinces, cities, chains int) *DistributionSystem {
+	tb.Helper()
+	var csv strings.Builder
+	csv.WriteString("City Code,Province Code,Country Code,City Name,Province Name,Country Name\n")
+	for c := 0; c < countries; c++ {
+		for p := 0; p < provinces; p++ {
+			for x := 0; x < cities; x++ {
+				fmt.Fprintf(&csv, "%s,%s,%s,City %d,Province %d,Country %d\n", letterCode(x), letterCode(p), letterCode(c), x, p, c)
+			}
+		}
+	}
+	filename := filepath.Join(tb.TempDir(), "locations.csv")
+	if err := os.WriteFile(filename, []byte(csv.String()), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	ds := NewDistributionSystem()
+	if err := ds.LoadLocationData(filename, true); err != nil {
+		tb.Fatal(err)
+	}
+
+	for i := 0; i < chains; i++ {
+		country := letterCode(i % countries)
+		province := letterCode(i%(provinces-1)+1) + "-" + country
+		names := []string{fmt.Sprintf("R%d", i), fmt.Sprintf("C%d", i), fmt.Sprintf("G%d", i), fmt.Sprintf("L%d", i)}
+		addChain(tb, ds, names,
+			include(names[0], country), exclude(names[0], letterCode(0)+"-"+country),
+			include(names[1], province),
+			include(names[2], province), exclude(names[2], letterCode(0)+"-"+province),
+			include(names[3], letterCode(cities-1)+"-"+province))
+	}
+	return ds
+}
+
+// BenchmarkLoadState compares loading the same large state from JSON and
+// from gob
+func BenchmarkLoadState(b *testing.B) {
+	ds := newLargeSystem(b, 20, 20, 20, 2500)
+	for _, name := range []string{"state.json", "state.gob"} {
+		filename := filepath.Join(b.TempDir(), name)
+		if err := ds.SaveState(filename); err != nil {
+			b.Fatal(err)
+		}
+		info, err := os.Stat(filename)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(strings.TrimPrefix(filepath.Ext(name), "."), func(b *testing.B) {
+			b.SetBytes(info.Size())
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				loaded := NewDistributionSystem()
+				if err := loaded.LoadState(filename); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadOlderGobLayouts(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"P", "C"}, include("P", "IN"), exclude("P", "KA-IN"), include("C", "TN-IN"))
+	distributors := ds.distributorData()
+	for _, tt := range []struct {
+		name     string
+		layout   interface{}
+		strategy string
+	}{
+		{"distributor map", distributors, defaultStrategy},
+		{"state", State{Strategy: "specificity", Distributors: distributors}, "specificity"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "state.gob")
+			file, err := os.Create(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := gob.NewEncoder(file).Encode(tt.layout); err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+
+			loaded := newTestSystem(t)
+			if err := loaded.LoadState(filename); err != nil {
+				t.Fatal(err)
+			}
+			if got := loaded.Strategy(); got != tt.strategy {
+				t.Errorf("Strategy() = %s, want %s", got, tt.strategy)
+			}
+			assertChecks(t, loaded, "C", map[string]bool{"CENAI-TN-IN": true, "BLR-KA-IN": false})
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package distribution
+
+import "fmt"
+
+// Decision is the outcome of a permission check together with the steps that
+// led to it. The last step is the deciding reason.
+type Decision struct {
+	Allowed bool
+	Trace   []string
+
+	// Truncated is set when the trace stopped early because of a depth
+	// limit; Allowed is still the full result
+	Truncated bool
+}
+
+// Reason returns the step that decided the outcome
+func (dec Decision) Reason() string {
+	if len(dec.Trace) == 0 {
+		return ""
+	}
+	return dec.Trace[len(dec.Trace)-1]
+}
+
+// Explain checks a distributor's permission for a region like CheckPermission,
+// recording which rule matched at each level of the parent chain
+func (ds *DistributionSystem) Explain(distributorName, region string) (Decision, error) {
+	return ds.ExplainWithin(distributorName, region, 0)
+}
+
+// ExplainWithin is like Explain but only traces the first maxDepth levels of
+// the parent chain, for deep hierarchies where only the proximate cause
+// matters. A maxDepth of 0 traces every level.
+func (ds *DistributionSystem) ExplainWithin(distributorName, region string, maxDepth int) (Decision, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	distributor, exists := ds.distributors[distributorName]
+	if !exists {
+		return Decision{}, fmt.Errorf("distributor %s does not exist", distributorName)
+	}
+
+	region = ds.CanonicalRegion(region)
+	if !ds.ValidateRegion(region) {
+		return Decision{}, fmt.Errorf("invalid region code: %s", region)
+	}
+
+	return distributor.decide(region, maxDepth), nil
+}
+
+// decide evaluates HasPermission for region while recording the trace
+func (d *Distributor) decide(region string, maxDepth int) Decision {
+	var dec Decision
+	denied := d.deniedWithin(region)
+	switch {
+	case denied == region:
+		dec.Allowed = d.explain(region, &dec.Trace, maxDepth, &dec.Truncated)
+	case denied != "":
+		// The whole region must be permitted, so the trace goes on to the
+		// part of it that is not
+		if d.admits(region) {
+			d.explain(region, &dec.Trace, maxDepth, &dec.Truncated)
+		}
+		dec.Trace = append(dec.Trace, fmt.Sprintf("%s is not permitted everywhere: %s inside it is denied", region, denied))
+		dec.Allowed = d.explain(denied, &dec.Trace, maxDepth, &dec.Truncated)
+	default:
+		dec.Allowed = true
+		if !d.explain(region, &dec.Trace, maxDepth, &dec.Truncated) {
+			dec.Trace = append(dec.Trace, fmt.Sprintf("%s: every location in %s is covered by permitted rules for regions inside it", d.Name, region))
+		}
+	}
+	return dec
+}
+
+// explain follows the same steps as admits, appending each one to
+// trace. Once budget levels have been traced (if budget is positive) the
+// rest of the chain is evaluated without tracing and truncated is set.
+func (d *Distributor) explain(region string, trace *[]string, budget int, truncated *bool) bool {
+	rule, isInclude, matched := d.resolution().Decide(d, region)
+	switch {
+	case !matched:
+		*trace = append(*trace, fmt.Sprintf("%s: no include matches %s", d.Name, region))
+		return false
+	case !isInclude:
+		*trace = append(*trace, fmt.Sprintf("%s: exclude %s%s matches %s", d.Name, rule, d.ruleSuffix(false, rule), region))
+		return false
+	}
+
+	rule += d.ruleSuffix(true, rule)
+	if d.Parent == nil {
+		*trace = append(*trace, fmt.Sprintf("%s: include %s matches %s", d.Name, rule, region))
+		return true
+	}
+	*trace = append(*trace, fmt.Sprintf("%s: include %s matches %s, checking parent %s", d.Name, rule, region, d.Parent.Name))
+	if budget == 1 {
+		*trace = append(*trace, fmt.Sprintf("... trace truncated, %s and its ancestors not shown", d.Parent.Name))
+		*truncated = true
+		return d.Parent.admits(region)
+	}
+	return d.Parent.explain(region, trace, budget-1, truncated)
+}
@@ -0,0 +1,65 @@
+package distribution
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// StateDelta holds the changes between a previous export and the current
+// state: the full record of every distributor that was added or changed, and
+// the names of those that were removed
+type StateDelta struct {
+	Upserted map[string]DistributorData
+	Deleted  []string
+}
+
+// DeltaSince compares the current distributors with a previously exported
+// state and returns only what changed. A distributor counts as changed when
+// any part of its persisted record differs, including its parent, rules,
+// metadata and conditions.
+func (ds *DistributionSystem) DeltaSince(previous *DistributionSystem) (StateDelta, error) {
+	delta := StateDelta{Upserted: make(map[string]DistributorData), Deleted: []string{}}
+	before := previous.distributorData()
+	for name, record := range ds.distributorData() {
+		old, existed := before[name]
+		if existed {
+			same, err := sameRecord(old, record)
+			if err != nil {
+				return delta, err
+			}
+			if same {
+				continue
+			}
+		}
+		delta.Upserted[name] = record
+	}
+	for name := range before {
+		if _, exists := ds.distributors[name]; !exists {
+			delta.Deleted = append(delta.Deleted, name)
+		}
+	}
+	sort.Strings(delta.Deleted)
+	return delta, nil
+}
+
+// sameRecord compares two records by their JSON encoding, which treats empty
+// and missing optional maps alike
+func sameRecord(a, b DistributorData) (bool, error) {
+	encodedA, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	encodedB, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return string(encodedA) == string(encodedB), nil
+}
+
+// WriteDelta writes a delta as indented JSON
+func WriteDelta(w io.Writer, delta StateDelta) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(delta)
+}
@@ -0,0 +1,267 @@
+package distribution
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileStore keeps the state in a file whose format follows the extension,
+// as reported by StateFormat
+type FileStore struct {
+	Path string
+	// Backups is how many previous versions of the file Save keeps, named
+	// like distributors.1.json (the most recent) through distributors.N.json
+	Backups int
+}
+
+// NewFileStore returns a store for the state file at path, keeping no
+// backups
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// LoadState loads distributor data from the state file. The format follows
+// the extension, as reported by StateFormat.
+func (ds *DistributionSystem) LoadState(filename string) error {
+	return ds.Load(NewFileStore(filename))
+}
+
+// SaveState saves distributor data to the state file, using the same
+// extension-based format selection as LoadState. The new file is synced to
+// disk and renamed over the old one, which is first kept as a backup if
+// SetBackups asked for any.
+func (ds *DistributionSystem) SaveState(filename string) error {
+	return ds.Save(&FileStore{Path: filename, Backups: ds.backupCount()})
+}
+
+// backupCount returns the number of backups SetBackups asked for
+func (ds *DistributionSystem) backupCount() int {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.backups
+}
+
+// Load reads the state file, creating it empty if it does not exist
+func (s *FileStore) Load() (State, error) {
+	file, err := os.OpenFile(s.Path, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return State{}, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return State{}, err
+	}
+
+	if stat.Size() == 0 {
+		return State{}, nil
+	}
+
+	raw, err := io.ReadAll(file)
+	if err != nil {
+		return State{}, err
+	}
+	return decodeState(raw, StateFormat(s.Path))
+}
+
+// Save writes the state next to the file and renames it into place, so a
+// failed or concurrent save never leaves a truncated state file behind. The
+// new file is synced to disk first, and the old one kept as a backup if
+// Backups asks for any.
+func (s *FileStore) Save(state State) error {
+	file, err := os.CreateTemp(filepath.Dir(s.Path), ".state-*"+filepath.Ext(s.Path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	// Files using the default strategy keep the plain distributor map so
+	// they stay readable by older versions
+	var layout interface{} = state.Distributors
+	if state.Strategy != "" {
+		layout = state
+	}
+
+	switch StateFormat(s.Path) {
+	case "gob":
+		err = gob.NewEncoder(file).Encode(newGobState(state))
+	case "yaml":
+		// yaml.v3 also writes map keys in sorted order
+		encoder := yaml.NewEncoder(file)
+		encoder.SetIndent(2)
+		if err = encoder.Encode(layout); err == nil {
+			err = encoder.Close()
+		}
+	default:
+		// encoding/json writes map keys in sorted order, so the same state
+		// always produces the same file
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "    ")
+		err = encoder.Encode(layout)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+	if s.Backups > 0 {
+		if err := rotateBackups(s.Path, s.Backups); err != nil {
+			return fmt.Errorf("rotating backups: %w", err)
+		}
+	}
+	if err := os.Rename(file.Name(), s.Path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(s.Path))
+	return nil
+}
+
+// Close does nothing; the file is only open while loading or saving
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// syncDir flushes a directory entry change such as a rename to disk. It is
+// best effort: not every platform can sync a directory.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// decodeState parses a state file in either layout
+func decodeState(raw []byte, format string) (State, error) {
+	var state State
+	switch format {
+	case "gob":
+		var records gobState
+		err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&records)
+		if err == nil {
+			return records.state(), nil
+		}
+		// Older versions wrote State, or the plain distributor map for the
+		// default strategy. A gob stream records its type ahead of the
+		// value, so those fail the decode above before any of the value
+		// is read.
+		if gob.NewDecoder(bytes.NewReader(raw)).Decode(&state) == nil {
+			return state, nil
+		}
+		state = State{}
+		if gob.NewDecoder(bytes.NewReader(raw)).Decode(&state.Distributors) == nil {
+			return state, nil
+		}
+		return State{}, err
+	case "yaml":
+		var fields map[string]yaml.Node
+		if err := yaml.Unmarshal(raw, &fields); err != nil {
+			return state, err
+		}
+		_, hasStrategy := fields["strategy"]
+		_, hasDistributors := fields["distributors"]
+		if len(fields) == 2 && hasStrategy && hasDistributors {
+			err := yaml.Unmarshal(raw, &state)
+			return state, err
+		}
+		err := yaml.Unmarshal(raw, &state.Distributors)
+		return state, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return state, err
+	}
+	_, hasStrategy := fields["Strategy"]
+	_, hasDistributors := fields["Distributors"]
+	if len(fields) == 2 && hasStrategy && hasDistributors {
+		err := json.Unmarshal(raw, &state)
+		return state, err
+	}
+	err := json.Unmarshal(raw, &state.Distributors)
+	return state, err
+}
+
+// gobState is the layout of gob state files. Gob decodes a map an entry at
+// a time through reflection, which made gob files of DistributorData slower
+// to load than JSON, so each distributor's rules are kept as a slice of
+// RuleRecords instead.
+type gobState struct {
+	Strategy string
+	// Distributors shares its name with State's map, so that decoding a
+	// file an older version wrote as State fails on the type mismatch
+	// rather than skipping the distributors
+	Distributors []gobDistributor
+}
+
+type gobDistributor struct {
+	Name        string
+	ParentName  string
+	Metadata    map[string]string
+	MaxChildren int
+	Rules       []RuleRecord
+}
+
+// newGobState flattens state into the gob layout, sorted by name so the
+// same state always produces the same file
+func newGobState(state State) gobState {
+	records := gobState{Strategy: state.Strategy, Distributors: make([]gobDistributor, 0, len(state.Distributors))}
+	for _, name := range sortedKeys(state.Distributors) {
+		data := state.Distributors[name]
+		records.Distributors = append(records.Distributors, gobDistributor{
+			Name:        name,
+			ParentName:  data.ParentName,
+			Metadata:    data.Metadata,
+			MaxChildren: data.MaxChildren,
+			Rules:       data.RuleRecords(),
+		})
+	}
+	return records
+}
+
+// state rebuilds the State newGobState flattened
+func (g gobState) state() State {
+	state := State{Strategy: g.Strategy, Distributors: make(map[string]DistributorData, len(g.Distributors))}
+	for _, record := range g.Distributors {
+		data := DistributorData{
+			Name:        record.Name,
+			ParentName:  record.ParentName,
+			Metadata:    record.Metadata,
+			MaxChildren: record.MaxChildren,
+		}
+		for _, rule := range record.Rules {
+			data.AddRuleRecord(rule)
+		}
+		state.Distributors[record.Name] = data
+	}
+	return state
+}
+
+// StateFormat returns the format of a state file going by its extension:
+// "gob" for .gob, "yaml" for .yaml or .yml and "json" for anything else
+func StateFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gob":
+		return "gob"
+	case ".yaml", ".yml":
+		return "yaml"
+	default:
+		return "json"
+	}
+}
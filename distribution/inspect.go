@@ -0,0 +1,146 @@
+package distribution
+
+import (
+	"fmt"
+	"sort"
+)
+
+// InheritedRuleSet returns every include and exclude a distributor is subject
+// to, starting with its own rules and followed by those of each ancestor.
+// Each entry is annotated with the distributor that declared it.
+func (ds *DistributionSystem) InheritedRuleSet(name string) (includes, excludes []string, err error) {
+	distributor, exists := ds.distributors[name]
+	if !exists {
+		return nil, nil, fmt.Errorf("distributor %s does not exist", name)
+	}
+
+	includes = []string{}
+	excludes = []string{}
+	visited := make(map[*Distributor]bool)
+	for d := distributor; d != nil && !visited[d]; d = d.Parent {
+		visited[d] = true
+		for _, region := range sortedKeys(d.Includes) {
+			includes = append(includes, fmt.Sprintf("%s (from %s)%s", region, d.Name, d.ruleSuffix(true, region)))
+		}
+		for _, region := range sortedKeys(d.Excludes) {
+			excludes = append(excludes, fmt.Sprintf("%s (from %s)%s", region, d.Name, d.ruleSuffix(false, region)))
+		}
+	}
+	return includes, excludes, nil
+}
+
+// InheritedOnly splits the regions a distributor can serve into those covered
+// by one of its own includes and those it can only serve through an
+// ancestor's include. Both lists are sorted like EffectiveRegions.
+func (ds *DistributionSystem) InheritedOnly(name string) (own, inherited []*Location, err error) {
+	regions, err := ds.EffectiveRegions(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	distributor := ds.distributors[name]
+	own = []*Location{}
+	inherited = []*Location{}
+	for _, location := range regions {
+		if distributor.includesRegion(CityKey(location)) {
+			own = append(own, location)
+		} else {
+			inherited = append(inherited, location)
+		}
+	}
+	return own, inherited, nil
+}
+
+// includesRegion reports whether one of the distributor's own applicable
+// includes covers region, regardless of its excludes and parent chain
+func (d *Distributor) includesRegion(region string) bool {
+	return len(d.matchingRules(true, region)) > 0
+}
+
+// sortedKeys returns the keys of a map in lexical order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Descendants returns the names of every distributor below name in the
+// hierarchy, directly or indirectly, in lexical order
+func (ds *DistributionSystem) Descendants(name string) ([]string, error) {
+	root, exists := ds.distributors[name]
+	if !exists {
+		return nil, fmt.Errorf("distributor %s does not exist", name)
+	}
+
+	descendants := []string{}
+	for _, other := range ds.distributorNames() {
+		dist := ds.distributors[other]
+		if dist != root && isAncestorOrSelf(root, dist) {
+			descendants = append(descendants, other)
+		}
+	}
+	return descendants, nil
+}
+
+// Depth returns how far a distributor is below its root (roots are at depth 0).
+// It fails instead of looping forever if the parent chain contains a cycle.
+func (ds *DistributionSystem) Depth(name string) (int, error) {
+	distributor, exists := ds.distributors[name]
+	if !exists {
+		return 0, fmt.Errorf("distributor %s does not exist", name)
+	}
+
+	visited := make(map[*Distributor]bool)
+	depth := 0
+	for d := distributor; d.Parent != nil; d = d.Parent {
+		if visited[d] {
+			return 0, fmt.Errorf("parent chain of %s contains a cycle", name)
+		}
+		visited[d] = true
+		depth++
+	}
+	return depth, nil
+}
+
+// DepthStats summarizes the distributors found at one level of the hierarchy
+type DepthStats struct {
+	Depth        int
+	Distributors int
+	Includes     int
+	Excludes     int
+}
+
+// DepthDistribution aggregates distributor and rule counts per hierarchy
+// depth, ordered from the roots down
+func (ds *DistributionSystem) DepthDistribution() ([]DepthStats, error) {
+	byDepth := make(map[int]*DepthStats)
+	maxDepth := -1
+	for name, dist := range ds.distributors {
+		depth, err := ds.Depth(name)
+		if err != nil {
+			return nil, err
+		}
+		stats, exists := byDepth[depth]
+		if !exists {
+			stats = &DepthStats{Depth: depth}
+			byDepth[depth] = stats
+		}
+		stats.Distributors++
+		stats.Includes += len(dist.Includes)
+		stats.Excludes += len(dist.Excludes)
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+	}
+
+	var result []DepthStats
+	for depth := 0; depth <= maxDepth; depth++ {
+		if stats, exists := byDepth[depth]; exists {
+			result = append(result, *stats)
+		}
+	}
+	return result, nil
+}
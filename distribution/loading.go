@@ -0,0 +1,71 @@
+package distribution
+
+import (
+	"fmt"
+	"io"
+)
+
+// defaultBufferSize is the read buffer used for locations CSVs when
+// LoadOptions does not set one
+const defaultBufferSize = 64 * 1024
+
+// LoadOptions tunes how locations CSVs are read. Rows are always parsed one
+// at a time, so memory use follows the size of the index, not of the file.
+type LoadOptions struct {
+	// BufferSize is the read buffer size in bytes; 0 uses 64 KiB
+	BufferSize int
+
+	// Progress, if set, is called as a file is read with the bytes parsed
+	// so far, the file's size and the rows parsed, and once more at its end
+	// with read equal to size
+	Progress func(file string, read, size int64, rows int)
+
+	// Level is the finest level indexed: "country", "province" or "city"
+	// (the default). Coarser levels use far less memory but make the finer
+	// region codes unknown.
+	Level string
+
+	// Cache keeps a compiled copy of each CSV next to it (see
+	// LocationCachePath) and reads that instead while the CSV is unchanged
+	Cache bool
+}
+
+// SetLoadOptions configures how later LoadLocationData and LoadLocationFiles
+// calls read their files
+func (ds *DistributionSystem) SetLoadOptions(options LoadOptions) error {
+	if options.BufferSize < 0 {
+		return fmt.Errorf("buffer size must not be negative, got %d", options.BufferSize)
+	}
+	switch options.Level {
+	case "", "city", "province", "country":
+	default:
+		return fmt.Errorf("unknown index level %q (available: country, province, city)", options.Level)
+	}
+	ds.loadOptions = options
+	return nil
+}
+
+// indexDepth returns how many levels of keys addLocation stores: 1 for
+// countries only up to 3 for cities
+func (options LoadOptions) indexDepth() int {
+	switch options.Level {
+	case "country":
+		return 1
+	case "province":
+		return 2
+	default:
+		return 3
+	}
+}
+
+// progressReader counts the bytes read through it for progress reports
+type progressReader struct {
+	r    io.Reader
+	read int64
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.read += int64(n)
+	return n, err
+}
@@ -0,0 +1,172 @@
+package distribution
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// locationCacheVersion changes whenever the layout of locationCache does, so
+// older cache files are rebuilt instead of misread
+const locationCacheVersion = 1
+
+// locationCache is the compiled form of a locations CSV, written next to it
+// as <file>.gob. It holds the parsed rows before aliases are applied, so one
+// cache serves every alias file and index level.
+type locationCache struct {
+	Version   int
+	Size      int64
+	ModTime   time.Time
+	Hash      [sha256.Size]byte
+	HasHeader bool
+	Rows      []Location
+
+	// Records counts every CSV row read, including the header and short
+	// rows, for progress reports
+	Records int
+}
+
+// LocationCachePath returns where the compiled cache of a locations CSV is
+// kept
+func LocationCachePath(filename string) string {
+	return filename + ".gob"
+}
+
+// readLocations calls fn for every row of a locations CSV like
+// readLocationRecords. With options.Cache set the rows come from the
+// compiled cache when it still matches the file, and the cache is rebuilt
+// when it does not.
+func readLocations(filename string, hasHeader bool, options LoadOptions, fn func(*Location)) error {
+	if !options.Cache {
+		return readLocationRecords(filename, hasHeader, options, fn)
+	}
+	if cache, ok := readLocationCache(filename, hasHeader); ok {
+		for i := range cache.Rows {
+			fn(&cache.Rows[i])
+		}
+		if options.Progress != nil {
+			options.Progress(filename, cache.Size, cache.Size, cache.Records)
+		}
+		return nil
+	}
+
+	var rows []Location
+	records := 0
+	progress := options.Progress
+	options.Progress = func(file string, read, size int64, rowsRead int) {
+		records = rowsRead
+		if progress != nil {
+			progress(file, read, size, rowsRead)
+		}
+	}
+	err := readLocationRecords(filename, hasHeader, options, func(location *Location) {
+		// fn may canonicalize the row, so the cache keeps its own copy
+		rows = append(rows, *location)
+		fn(location)
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeLocationCache(filename, hasHeader, rows, records); err != nil {
+		slog.Warn(fmt.Sprintf("could not write location cache for %s: %v", filename, err), "operation", "load-locations", "file", filename)
+	}
+	return nil
+}
+
+// readLocationCache returns the cache of filename if it was built from the
+// same contents with the same header setting. A file whose size and
+// modification time match is trusted as is; one that was only touched is
+// recognized by its hash.
+func readLocationCache(filename string, hasHeader bool) (*locationCache, bool) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, false
+	}
+	file, err := os.Open(LocationCachePath(filename))
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+
+	var cache locationCache
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(&cache); err != nil {
+		return nil, false
+	}
+	if cache.Version != locationCacheVersion || cache.HasHeader != hasHeader || cache.Size != info.Size() {
+		return nil, false
+	}
+	if !cache.ModTime.Equal(info.ModTime()) {
+		hash, err := hashFile(filename)
+		if err != nil || hash != cache.Hash {
+			return nil, false
+		}
+	}
+	return &cache, true
+}
+
+// writeLocationCache compiles rows, parsed from filename, into its cache.
+// Like SaveState it writes a temporary file and renames it into place, so
+// concurrent runs never read a partial cache.
+func writeLocationCache(filename string, hasHeader bool, rows []Location, records int) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	hash, err := hashFile(filename)
+	if err != nil {
+		return err
+	}
+	cache := locationCache{
+		Version:   locationCacheVersion,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		Hash:      hash,
+		HasHeader: hasHeader,
+		Rows:      rows,
+		Records:   records,
+	}
+	var encoded bytes.Buffer
+	if err := gob.NewEncoder(&encoded).Encode(cache); err != nil {
+		return err
+	}
+
+	path := LocationCachePath(filename)
+	file, err := os.CreateTemp(filepath.Dir(path), ".locations-*.gob")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(encoded.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func hashFile(filename string) ([sha256.Size]byte, error) {
+	var hash [sha256.Size]byte
+	file, err := os.Open(filename)
+	if err != nil {
+		return hash, err
+	}
+	defer file.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, file); err != nil {
+		return hash, err
+	}
+	copy(hash[:], sum.Sum(nil))
+	return hash, nil
+}
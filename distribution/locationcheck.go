@@ -0,0 +1,133 @@
+package distribution
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keyLevel names the three levels LoadLocationData stores keys at
+var keyLevel = [...]string{"country", "province", "city"}
+
+// CheckLocationKeys re-reads a locations CSV and reports keying problems that
+// LoadLocationData would silently hide: a key produced by two different
+// records or at two different levels, codes that break the dash-separated key
+// scheme, and city codes that shadow a real country code.
+func (ds *DistributionSystem) CheckLocationKeys(filename string, hasHeader bool) ([]string, error) {
+	var issues []string
+	cityOwners := make(map[string]Location)
+	keyLevels := make(map[string]int)
+	countries := make(map[string]bool)
+	var cities []Location
+
+	err := readLocationRecords(filename, hasHeader, ds.loadOptions, func(location *Location) {
+		ds.canonicalizeLocation(location)
+		key := CityKey(location)
+
+		for _, code := range []string{location.CityCode, location.ProvinceCode, location.CountryCode} {
+			if strings.Contains(code, "-") {
+				issues = append(issues, fmt.Sprintf("%s: code %q contains the key separator", key, code))
+			}
+		}
+		if location.CityCode == "" || location.ProvinceCode == "" || location.CountryCode == "" {
+			issues = append(issues, fmt.Sprintf("%s: empty code segment (%s, %s, %s)",
+				key, location.CityName, location.ProvinceName, location.CountryName))
+		}
+
+		if previous, exists := cityOwners[key]; exists && previous != *location {
+			issues = append(issues, fmt.Sprintf("%s: reachable by two records (%s, %s, %s) and (%s, %s, %s)",
+				key, previous.CityName, previous.ProvinceName, previous.CountryName,
+				location.CityName, location.ProvinceName, location.CountryName))
+		} else if !exists {
+			cityOwners[key] = *location
+		}
+
+		keys := []string{
+			location.CountryCode,
+			location.ProvinceCode + "-" + location.CountryCode,
+			key,
+		}
+		for level, k := range keys {
+			if previous, exists := keyLevels[k]; exists && previous != level {
+				issues = append(issues, fmt.Sprintf("%s: used as both a %s and a %s key", k, keyLevel[previous], keyLevel[level]))
+			} else if !exists {
+				keyLevels[k] = level
+			}
+		}
+
+		countries[location.CountryCode] = true
+		cities = append(cities, *location)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, city := range cities {
+		if countries[city.CityCode] {
+			issues = append(issues, fmt.Sprintf("%s: city code %s shadows the country %s",
+				CityKey(&city), city.CityCode, city.CityCode))
+		}
+	}
+
+	sort.Strings(issues)
+	return issues, nil
+}
+
+// CheckCompleteness verifies the loaded geography: every city's province and
+// country keys must resolve to a location in that province and country, and
+// all cities sharing a province or country must agree on its name. Cities
+// whose names disagree with the majority of their siblings are reported.
+func (ds *DistributionSystem) CheckCompleteness() []string {
+	cities := ds.cities()
+	sortLocations(cities)
+
+	provinceNames := make(map[string]map[string]int)
+	countryNames := make(map[string]map[string]int)
+	var issues []string
+	for _, city := range cities {
+		province := city.ProvinceCode + "-" + city.CountryCode
+		if resolved, exists := ds.provinceIndex[province]; !exists ||
+			resolved.ProvinceCode != city.ProvinceCode || resolved.CountryCode != city.CountryCode {
+			issues = append(issues, fmt.Sprintf("%s: province key %s does not resolve to its province", CityKey(city), province))
+		}
+		if resolved, exists := ds.countryIndex[city.CountryCode]; !exists || resolved.CountryCode != city.CountryCode {
+			issues = append(issues, fmt.Sprintf("%s: country key %s does not resolve to its country", CityKey(city), city.CountryCode))
+		}
+
+		if provinceNames[province] == nil {
+			provinceNames[province] = make(map[string]int)
+		}
+		provinceNames[province][city.ProvinceName]++
+		if countryNames[city.CountryCode] == nil {
+			countryNames[city.CountryCode] = make(map[string]int)
+		}
+		countryNames[city.CountryCode][city.CountryName]++
+	}
+
+	for _, city := range cities {
+		province := city.ProvinceCode + "-" + city.CountryCode
+		if expected := majorityName(provinceNames[province]); city.ProvinceName != expected {
+			issues = append(issues, fmt.Sprintf("%s: province name %q disagrees with %q used by other cities in %s",
+				CityKey(city), city.ProvinceName, expected, province))
+		}
+		if expected := majorityName(countryNames[city.CountryCode]); city.CountryName != expected {
+			issues = append(issues, fmt.Sprintf("%s: country name %q disagrees with %q used by other cities in %s",
+				CityKey(city), city.CountryName, expected, city.CountryCode))
+		}
+	}
+
+	sort.Strings(issues)
+	return issues
+}
+
+// majorityName returns the most frequent name, preferring the lexically
+// smallest on a tie so the result is deterministic
+func majorityName(counts map[string]int) string {
+	best := ""
+	for _, name := range sortedKeys(counts) {
+		if best == "" && counts[name] > 0 || counts[name] > counts[best] {
+			best = name
+		}
+	}
+	return best
+}
@@ -0,0 +1,87 @@
+package distribution
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LocationFiles resolves a -csv argument into the locations CSVs to load: a
+// comma-separated list of files and directories, where a directory stands
+// for the .csv files in it in lexical order
+func LocationFiles(spec string) ([]string, error) {
+	var files []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		info, err := os.Stat(entry)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, entry)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(entry, "*.csv"))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no .csv files in %s", entry)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no locations CSV given")
+	}
+	return files, nil
+}
+
+// namedIn records the name a file gave a location key
+type namedIn struct {
+	name string
+	file string
+}
+
+// LoadLocationFiles loads several locations CSVs into one index, in order,
+// so a later file can add to or correct an earlier one. It returns a
+// description of every key that two files give different names, which keeps
+// the name from the later file.
+func (ds *DistributionSystem) LoadLocationFiles(filenames []string, hasHeader bool) ([]string, error) {
+	origins := make(map[string]namedIn)
+	reported := make(map[string]bool)
+	var conflicts []string
+	for _, filename := range filenames {
+		err := readLocations(filename, hasHeader, ds.loadOptions, func(location *Location) {
+			ds.canonicalizeLocation(location)
+			// A single file cannot conflict with another, so the names need
+			// not be tracked
+			if len(filenames) == 1 {
+				ds.addLocation(location)
+				return
+			}
+			keys := []string{location.CountryCode, location.ProvinceCode + "-" + location.CountryCode, CityKey(location)}
+			names := []string{location.CountryName, location.ProvinceName, location.CityName}
+			for level, key := range keys {
+				origin, exists := origins[key]
+				if exists && origin.file != filename && origin.name != names[level] && !reported[key] {
+					conflicts = append(conflicts, fmt.Sprintf("%s: %s named %q in %s but %q in %s",
+						key, keyLevel[level], origin.name, origin.file, names[level], filename))
+					reported[key] = true
+				}
+				origins[key] = namedIn{name: names[level], file: filename}
+			}
+			ds.addLocation(location)
+		})
+		if err != nil {
+			return conflicts, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts, nil
+}
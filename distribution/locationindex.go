@@ -0,0 +1,47 @@
+package distribution
+
+// Locations are indexed separately per level so that a province or country
+// key resolves to a record of that province or country, not to whichever of
+// its cities was loaded last. Province records leave the city fields empty
+// and country records the province and city fields.
+
+// levelIndex returns the index holding keys of the given level: 1 for
+// countries, 2 for provinces and 3 for cities
+func (ds *DistributionSystem) levelIndex(level int) map[string]*Location {
+	switch level {
+	case 1:
+		return ds.countryIndex
+	case 2:
+		return ds.provinceIndex
+	case 3:
+		return ds.cityIndex
+	}
+	return nil
+}
+
+// lookupLocation returns the record of a canonical region key
+func (ds *DistributionSystem) lookupLocation(key string) (*Location, bool) {
+	location, exists := ds.levelIndex(regionLevel(key))[key]
+	return location, exists
+}
+
+// eachLocation calls fn for every indexed key and its record, countries
+// first, then provinces, then cities
+func (ds *DistributionSystem) eachLocation(fn func(key string, location *Location)) {
+	for level := 1; level <= 3; level++ {
+		for key, location := range ds.levelIndex(level) {
+			fn(key, location)
+		}
+	}
+}
+
+// indexLevel records a location under key in index, creating the record
+// the first time and otherwise updating its names, so that names from later
+// rows win as they did when every level shared one map
+func indexLevel(index map[string]*Location, key string, record Location) {
+	if existing, exists := index[key]; exists {
+		*existing = record
+		return
+	}
+	index[key] = &record
+}
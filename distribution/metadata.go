@@ -0,0 +1,99 @@
+package distribution
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetMetadata sets a metadata tag on a distributor. An empty value removes it.
+func (ds *DistributionSystem) SetMetadata(distributorName, key, value string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	distributor, exists := ds.distributors[distributorName]
+	if !exists {
+		return fmt.Errorf("distributor %s does not exist", distributorName)
+	}
+	if key == "" || strings.ContainsAny(key, "=!") {
+		return fmt.Errorf("invalid metadata key: %q", key)
+	}
+
+	if value == "" {
+		delete(distributor.Metadata, key)
+	} else {
+		distributor.Metadata[key] = value
+	}
+	return nil
+}
+
+// AddConditionalPermission adds a permission that only applies while the
+// distributor's metadata satisfies when, a predicate of the form key=value or
+// key!=value. An empty predicate adds an unconditional permission.
+func (ds *DistributionSystem) AddConditionalPermission(distributorName, region string, isInclude bool, when string) error {
+	if when != "" {
+		if _, _, _, err := parsePredicate(when); err != nil {
+			return err
+		}
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if err := ds.addPermission(distributorName, region, isInclude); err != nil {
+		return err
+	}
+
+	distributor := ds.distributors[distributorName]
+	region = ds.CanonicalRegion(region)
+	conditions := distributor.ExcludeConditions
+	if isInclude {
+		conditions = distributor.IncludeConditions
+	}
+	if when == "" {
+		delete(conditions, region)
+	} else {
+		conditions[region] = when
+	}
+	return nil
+}
+
+// ruleApplies reports whether the distributor's include or exclude for
+// region is valid at the distributor's clock and is unconditional or has a
+// predicate that holds for its metadata
+func (d *Distributor) ruleApplies(isInclude bool, region string) bool {
+	conditions, validity := d.ExcludeConditions, d.ExcludeValidity
+	if isInclude {
+		conditions, validity = d.IncludeConditions, d.IncludeValidity
+	}
+	if v, bounded := validity[region]; bounded && !v.covers(d.now()) {
+		return false
+	}
+	when, conditional := conditions[region]
+	if !conditional {
+		return true
+	}
+	key, value, negated, err := parsePredicate(when)
+	if err != nil {
+		return false
+	}
+	return (d.Metadata[key] == value) != negated
+}
+
+// parsePredicate splits key=value or key!=value into its parts
+func parsePredicate(when string) (key, value string, negated bool, err error) {
+	if i := strings.Index(when, "!="); i > 0 {
+		return when[:i], when[i+2:], true, nil
+	}
+	// An equals sign after a leading "!" belongs to a key!=value with no key
+	if i := strings.Index(when, "="); i > 0 && when[:i] != "!" {
+		return when[:i], when[i+1:], false, nil
+	}
+	return "", "", false, fmt.Errorf("invalid predicate %q: expected key=value or key!=value", when)
+}
+
+// conditionSuffix describes the predicate gating a rule for display
+func conditionSuffix(conditions map[string]string, region string) string {
+	if when, conditional := conditions[region]; conditional {
+		return fmt.Sprintf(" (when %s)", when)
+	}
+	return ""
+}
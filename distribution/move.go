@@ -0,0 +1,79 @@
+package distribution
+
+import "fmt"
+
+// MoveDistributor gives a distributor a new parent, like SetParent, and then
+// re-checks every include in the moved subtree against the parent it now
+// resolves through. It returns the includes that the new parent chain no
+// longer allows, keyed by distributor. Unless prune is set, such includes
+// make the move fail and leave the hierarchy unchanged; with prune they are
+// removed.
+func (ds *DistributionSystem) MoveDistributor(name, parentName string, prune bool) (map[string][]string, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	distributor, exists := ds.distributors[name]
+	if !exists {
+		return nil, fmt.Errorf("distributor %s does not exist", name)
+	}
+	oldParent := distributor.Parent
+	oldUnresolved, wasUnresolved := ds.unresolvedParents[name]
+	if err := ds.setParent(name, parentName); err != nil {
+		return nil, err
+	}
+
+	descendants, err := ds.Descendants(name)
+	if err != nil {
+		return nil, err
+	}
+	invalid := ds.includesOutsideParent(append([]string{name}, descendants...))
+
+	if len(invalid) > 0 && !prune {
+		distributor.Parent = oldParent
+		if wasUnresolved {
+			ds.unresolvedParents[name] = oldUnresolved
+		}
+		return invalid, fmt.Errorf("moving %s would leave %d includes outside the new parent's permissions", name, countRegions(invalid))
+	}
+	ds.pruneIncludes(invalid)
+	return invalid, nil
+}
+
+// includesOutsideParent returns the includes of the named distributors that
+// their parent does not admit, keyed by distributor
+func (ds *DistributionSystem) includesOutsideParent(names []string) map[string][]string {
+	invalid := make(map[string][]string)
+	for _, name := range names {
+		dist := ds.distributors[name]
+		if dist.Parent == nil {
+			continue
+		}
+		for _, region := range sortedKeys(dist.Includes) {
+			if !dist.Parent.admits(region) {
+				invalid[name] = append(invalid[name], region)
+			}
+		}
+	}
+	return invalid
+}
+
+// pruneIncludes removes the includes found by includesOutsideParent. Each
+// was already denied through the parent chain, so removing it does not
+// change what any other check finds.
+func (ds *DistributionSystem) pruneIncludes(invalid map[string][]string) {
+	for name, regions := range invalid {
+		dist := ds.distributors[name]
+		for _, region := range regions {
+			dist.deleteRule(true, region)
+		}
+	}
+}
+
+// countRegions returns how many regions invalid lists in all
+func countRegions(invalid map[string][]string) int {
+	count := 0
+	for _, regions := range invalid {
+		count += len(regions)
+	}
+	return count
+}
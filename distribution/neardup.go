@@ -0,0 +1,88 @@
+package distribution
+
+import "sort"
+
+// maxTypoDistance is the largest edit distance at which two region codes are
+// treated as a likely typo of each other
+const maxTypoDistance = 2
+
+// NearDuplicate is a pair of region codes in one distributor's rules that are
+// only a few edits apart, where Unresolved is not a known region but Resolved
+// is
+type NearDuplicate struct {
+	Distributor string
+	Unresolved  string
+	Resolved    string
+	Distance    int
+}
+
+// NearDuplicates finds, within each distributor, rule codes that do not
+// resolve to a known region but are within maxTypoDistance edits of a rule
+// code that does, such as CHENAI-TN-IN next to CHENNAI-TN-IN. Results are
+// sorted by distributor and code.
+func (ds *DistributionSystem) NearDuplicates() []NearDuplicate {
+	var found []NearDuplicate
+	for _, name := range ds.distributorNames() {
+		dist := ds.distributors[name]
+		var resolved, unresolved []string
+		for _, region := range ruleCodes(dist) {
+			if ds.ValidateRegion(region) {
+				resolved = append(resolved, region)
+			} else {
+				unresolved = append(unresolved, region)
+			}
+		}
+		for _, bad := range unresolved {
+			for _, good := range resolved {
+				if distance := editDistance(bad, good); distance <= maxTypoDistance {
+					found = append(found, NearDuplicate{
+						Distributor: name,
+						Unresolved:  bad,
+						Resolved:    good,
+						Distance:    distance,
+					})
+				}
+			}
+		}
+	}
+	return found
+}
+
+// ruleCodes returns the distinct region codes a distributor includes or
+// excludes, sorted
+func ruleCodes(dist *Distributor) []string {
+	seen := make(map[string]bool)
+	for region := range dist.Includes {
+		seen[region] = true
+	}
+	for region := range dist.Excludes {
+		seen[region] = true
+	}
+	codes := make([]string, 0, len(seen))
+	for region := range seen {
+		codes = append(codes, region)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,145 @@
+package distribution
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CleanupRedundant removes the rules of a distributor that cannot affect any
+// permission decision: includes nested inside another unconditional include,
+// excludes nested inside another unconditional exclude, and excludes that do
+// not overlap any include. Under strategies other than excludes-win a more
+// specific rule can override a broader one of the other kind, so nested rules
+// that overlap a rule of the other kind are kept. It returns a description of
+// each removed rule.
+func (ds *DistributionSystem) CleanupRedundant(name string) ([]string, error) {
+	distributor, exists := ds.distributors[name]
+	if !exists {
+		return nil, fmt.Errorf("distributor %s does not exist", name)
+	}
+
+	layered := ds.Strategy() != defaultStrategy
+	var removed []string
+	for _, rules := range []struct {
+		set        map[string]bool
+		conditions map[string]string
+		validity   map[string]Validity
+		others     map[string]bool
+		isInclude  bool
+		kind       string
+	}{
+		{distributor.Includes, distributor.IncludeConditions, distributor.IncludeValidity, distributor.Excludes, true, "include"},
+		{distributor.Excludes, distributor.ExcludeConditions, distributor.ExcludeValidity, distributor.Includes, false, "exclude"},
+	} {
+		for _, region := range sortedKeys(rules.set) {
+			if layered && overlapsAny(rules.others, region) {
+				continue
+			}
+			if covering := coveringRule(rules.set, rules.conditions, rules.validity, region); covering != "" {
+				distributor.deleteRule(rules.isInclude, region)
+				removed = append(removed, fmt.Sprintf("%s %s (covered by %s)", rules.kind, region, covering))
+			}
+		}
+	}
+
+	for _, excluded := range sortedKeys(distributor.Excludes) {
+		if !overlapsAny(distributor.Includes, excluded) {
+			distributor.deleteRule(false, excluded)
+			removed = append(removed, fmt.Sprintf("exclude %s (overlaps no include)", excluded))
+		}
+	}
+
+	return removed, nil
+}
+
+// coveringRule returns another unconditional, permanent rule in set that
+// strictly contains region, or "" if there is none
+func coveringRule(set map[string]bool, conditions map[string]string, validity map[string]Validity, region string) string {
+	parts := strings.Split(region, "-")
+	for _, other := range sortedKeys(set) {
+		if other == region {
+			continue
+		}
+		if _, conditional := conditions[other]; conditional {
+			continue
+		}
+		if _, bounded := validity[other]; bounded {
+			continue
+		}
+		if isSubregion(parts, strings.Split(other, "-")) {
+			return other
+		}
+	}
+	return ""
+}
+
+// overlapsAny reports whether region contains, or is contained in, any of the
+// regions in set
+func overlapsAny(set map[string]bool, region string) bool {
+	parts := strings.Split(region, "-")
+	for other := range set {
+		otherParts := strings.Split(other, "-")
+		if isSubregion(parts, otherParts) || isSubregion(otherParts, parts) {
+			return true
+		}
+	}
+	return false
+}
+
+// Optimize runs CleanupRedundant on the named distributors, or on all of them
+// when names is empty. In safe mode the cleanup is first rehearsed on a clone
+// and only applied if every distributor's effective regions are unchanged;
+// otherwise the original rules are kept and the discrepancies are returned
+// in the error.
+func (ds *DistributionSystem) Optimize(names []string, safe bool) (map[string][]string, error) {
+	if len(names) == 0 {
+		names = ds.distributorNames()
+	}
+
+	if safe {
+		trial := ds.Clone()
+		if _, err := trial.cleanupAll(names); err != nil {
+			return nil, err
+		}
+		if discrepancies := ds.coverageChanges(trial); len(discrepancies) > 0 {
+			return nil, fmt.Errorf("optimization would change effective coverage, rules left unchanged:\n  %s",
+				strings.Join(discrepancies, "\n  "))
+		}
+	}
+
+	return ds.cleanupAll(names)
+}
+
+func (ds *DistributionSystem) cleanupAll(names []string) (map[string][]string, error) {
+	removed := make(map[string][]string)
+	for _, name := range names {
+		rules, err := ds.CleanupRedundant(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(rules) > 0 {
+			removed[name] = rules
+		}
+	}
+	return removed, nil
+}
+
+// coverageChanges compares every distributor's effective regions with those
+// in other and describes each distributor whose coverage differs
+func (ds *DistributionSystem) coverageChanges(other *DistributionSystem) []string {
+	var changes []string
+	for _, name := range ds.distributorNames() {
+		before, _ := ds.effectiveRegionSet(name)
+		after, err := other.effectiveRegionSet(name)
+		if err != nil {
+			changes = append(changes, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		gained := len(after) - intersectionSize(before, after)
+		lost := len(before) - intersectionSize(before, after)
+		if gained > 0 || lost > 0 {
+			changes = append(changes, fmt.Sprintf("%s: %d regions gained, %d lost", name, gained, lost))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,67 @@
+package distribution
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// IsRegionPattern reports whether region is a pattern such as *-TN-IN
+// rather than a single region code
+func IsRegionPattern(region string) bool {
+	return strings.ContainsAny(region, "*?[")
+}
+
+// MatchRegions returns the sorted codes of the loaded regions that pattern
+// matches. Each dash-separated part of the pattern is matched against the
+// same part of a code as in path.Match, and only codes with as many parts
+// are considered, so *-TN-IN matches every city in Tamil Nadu, *-*-IN every
+// city in India and *-IN every province of India.
+func (ds *DistributionSystem) MatchRegions(pattern string) ([]string, error) {
+	parts := strings.Split(normalizeRegion(pattern), "-")
+	for _, part := range parts {
+		if _, err := path.Match(part, ""); err != nil {
+			return nil, fmt.Errorf("invalid region pattern %s: %w", pattern, err)
+		}
+	}
+
+	matches := make(map[string]bool)
+	index := ds.levelIndex(len(parts))
+	for region := range index {
+		codes := strings.Split(region, "-")
+		matched := true
+		for i, part := range parts {
+			if ok, _ := path.Match(part, codes[i]); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches[region] = true
+		}
+	}
+	ds.countScanned(len(index))
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("region pattern %s matches no region", pattern)
+	}
+	return sortedKeys(matches), nil
+}
+
+// expandPatterns replaces each pattern among regions with the codes it
+// matches, keeping the order of the list
+func (ds *DistributionSystem) expandPatterns(regions []string) ([]string, error) {
+	var expanded []string
+	for _, region := range regions {
+		if !IsRegionPattern(region) {
+			expanded = append(expanded, region)
+			continue
+		}
+		matches, err := ds.MatchRegions(region)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,59 @@
+package distribution
+
+import "fmt"
+
+// PermissionDiff compares the regions two distributors can serve. The
+// region lists are collapsed like SubtreePolicy's, so a province or country
+// whose cities all fall on one side is listed by its own code; the counts
+// are of cities.
+type PermissionDiff struct {
+	Distributor     string   `json:"distributor"`
+	Against         string   `json:"against"`
+	OnlyDistributor []string `json:"onlyDistributor"`
+	OnlyAgainst     []string `json:"onlyAgainst"`
+	Both            []string `json:"both"`
+
+	OnlyDistributorCities int `json:"onlyDistributorCities"`
+	OnlyAgainstCities     int `json:"onlyAgainstCities"`
+	BothCities            int `json:"bothCities"`
+}
+
+// DiffPermissions compares the effective regions of distributor with those
+// of against, for example before one replaces the other
+func (ds *DistributionSystem) DiffPermissions(distributor, against string) (*PermissionDiff, error) {
+	if distributor == against {
+		return nil, fmt.Errorf("cannot compare %s with itself", distributor)
+	}
+	ours, err := ds.effectiveRegionSet(distributor)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := ds.effectiveRegionSet(against)
+	if err != nil {
+		return nil, err
+	}
+
+	onlyOurs, onlyTheirs, both := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	for key := range ours {
+		if theirs[key] {
+			both[key] = true
+		} else {
+			onlyOurs[key] = true
+		}
+	}
+	for key := range theirs {
+		if !ours[key] {
+			onlyTheirs[key] = true
+		}
+	}
+	return &PermissionDiff{
+		Distributor:           distributor,
+		Against:               against,
+		OnlyDistributor:       ds.collapseRegions(onlyOurs),
+		OnlyAgainst:           ds.collapseRegions(onlyTheirs),
+		Both:                  ds.collapseRegions(both),
+		OnlyDistributorCities: len(onlyOurs),
+		OnlyAgainstCities:     len(onlyTheirs),
+		BothCities:            len(both),
+	}, nil
+}
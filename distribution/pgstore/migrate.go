@@ -0,0 +1,103 @@
+package pgstore
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Advisory lock keys serializing stores that migrate the same database or
+// save its locations
+const (
+	migrationLock = 0x6d6f7669
+	locationsLock = 0x6d6f766a
+)
+
+// migration is one numbered schema change, applied in order and recorded in
+// schema_migrations
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// readMigrations returns the embedded migrations sorted by version. Each
+// file is named NNNN_description.sql.
+func readMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []migration
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name does not start with a version number", entry.Name())
+		}
+		if other, exists := seen[version]; exists {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, entry.Name())
+		}
+		seen[version] = entry.Name()
+		sql, err := fs.ReadFile(migrationFiles, "migrations/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: entry.Name(), sql: string(sql)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// migrate applies the migrations the database has not seen yet, all in one
+// transaction, and refuses a database migrated by a newer version
+func (s *Store) migrate(ctx context.Context) error {
+	migrations, err := readMigrations()
+	if err != nil {
+		return err
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Stores opening a new database at once wait for each other here
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLock); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    integer PRIMARY KEY,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+	var current int
+	if err := tx.QueryRow(ctx, "SELECT coalesce(max(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].version; current > latest {
+		return fmt.Errorf("schema version %d is newer than the supported %d", current, latest)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if _, err := tx.Exec(ctx, m.sql); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", m.version); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
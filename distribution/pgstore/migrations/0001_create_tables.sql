@@ -0,0 +1,41 @@
+CREATE TABLE settings (
+	name  text PRIMARY KEY,
+	value text NOT NULL
+);
+
+-- version counts the saves that changed the row, so a writer can tell
+-- whether the row is still the one it loaded
+CREATE TABLE distributors (
+	name         text PRIMARY KEY,
+	parent       text NOT NULL DEFAULT '',
+	max_children integer NOT NULL DEFAULT 0,
+	version      bigint NOT NULL DEFAULT 1
+);
+
+CREATE TABLE metadata (
+	distributor text NOT NULL REFERENCES distributors (name) ON DELETE CASCADE,
+	name        text NOT NULL,
+	value       text NOT NULL,
+	PRIMARY KEY (distributor, name)
+);
+
+CREATE TABLE permissions (
+	distributor text NOT NULL REFERENCES distributors (name) ON DELETE CASCADE,
+	region      text NOT NULL,
+	include     boolean NOT NULL,
+	quarantined boolean NOT NULL DEFAULT false,
+	predicate   text NOT NULL DEFAULT '',
+	valid_from  timestamptz,
+	valid_until timestamptz,
+	PRIMARY KEY (distributor, region, include, quarantined)
+);
+
+CREATE TABLE locations (
+	country_code  text NOT NULL,
+	province_code text NOT NULL,
+	city_code     text NOT NULL,
+	country_name  text NOT NULL,
+	province_name text NOT NULL,
+	city_name     text NOT NULL,
+	PRIMARY KEY (country_code, province_code, city_code)
+);
@@ -0,0 +1,2 @@
+-- priority ranks a rule under the priority resolution strategy
+ALTER TABLE permissions ADD COLUMN priority integer NOT NULL DEFAULT 0;
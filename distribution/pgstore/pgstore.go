@@ -0,0 +1,374 @@
+// Package pgstore keeps the state of a distribution system in PostgreSQL,
+// with a row per distributor, per rule and per location, so that several
+// processes can share it. The schema is created and upgraded by migrations
+// embedded in the package.
+//
+// Writers do not lock the state against each other. Instead every
+// distributor row has a version, and a save only writes the distributors
+// that changed since the store loaded them, failing with ErrConflict if
+// another writer changed one of them in the meantime.
+package pgstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"movie-distrbution/distribution"
+)
+
+// ErrConflict is returned by Save when a distributor it would write was
+// added, changed or removed by another writer since it was loaded. Loading
+// again and redoing the change resolves it.
+var ErrConflict = errors.New("changed by another writer")
+
+// Store is a distribution.LocationStore backed by a PostgreSQL database
+// through a connection pool. It is safe for concurrent use.
+type Store struct {
+	pool *pgxpool.Pool
+
+	mu sync.Mutex
+	// loaded holds each distributor as last loaded or saved, with the
+	// version of its row then
+	loaded map[string]loadedRow
+}
+
+// loadedRow is a distributor as the store last saw it in the database
+type loadedRow struct {
+	version     int64
+	parent      string
+	maxChildren int
+	metadata    map[string]string
+	rules       []distribution.RuleRecord
+}
+
+// Open connects to the database named by dsn, a PostgreSQL URL or keyword
+// string, and migrates its schema. Pool settings such as pool_max_conns may
+// be given in dsn.
+func Open(ctx context.Context, dsn string) (*Store, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{pool: pool}
+	if err := store.migrate(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("migrating: %w", err)
+	}
+	return store, nil
+}
+
+// String names the database without the credentials in its DSN
+func (s *Store) String() string {
+	config := s.pool.Config().ConnConfig
+	return fmt.Sprintf("postgres://%s:%d/%s", config.Host, config.Port, config.Database)
+}
+
+// Close closes every connection of the pool
+func (s *Store) Close() error {
+	s.pool.Close()
+	return nil
+}
+
+// Load reads the state from one snapshot of the database and remembers the
+// version of every distributor for the next Save
+func (s *Store) Load() (distribution.State, error) {
+	ctx := context.Background()
+	state := distribution.State{Distributors: make(map[string]distribution.DistributorData)}
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return state, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, "SELECT value FROM settings WHERE name = 'strategy'").Scan(&state.Strategy)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return state, err
+	}
+
+	versions := make(map[string]int64)
+	rows, err := tx.Query(ctx, "SELECT name, parent, max_children, version FROM distributors")
+	if err != nil {
+		return state, err
+	}
+	for rows.Next() {
+		var data distribution.DistributorData
+		var version int64
+		if err := rows.Scan(&data.Name, &data.ParentName, &data.MaxChildren, &version); err != nil {
+			rows.Close()
+			return state, err
+		}
+		state.Distributors[data.Name] = data
+		versions[data.Name] = version
+	}
+	if err := rows.Err(); err != nil {
+		return state, err
+	}
+
+	rows, err = tx.Query(ctx, "SELECT distributor, name, value FROM metadata")
+	if err != nil {
+		return state, err
+	}
+	for rows.Next() {
+		var distributor, name, value string
+		if err := rows.Scan(&distributor, &name, &value); err != nil {
+			rows.Close()
+			return state, err
+		}
+		data := state.Distributors[distributor]
+		if data.Metadata == nil {
+			data.Metadata = make(map[string]string)
+		}
+		data.Metadata[name] = value
+		state.Distributors[distributor] = data
+	}
+	if err := rows.Err(); err != nil {
+		return state, err
+	}
+
+	rows, err = tx.Query(ctx, "SELECT distributor, region, include, quarantined, predicate, valid_from, valid_until, priority FROM permissions")
+	if err != nil {
+		return state, err
+	}
+	for rows.Next() {
+		var distributor string
+		var record distribution.RuleRecord
+		if err := rows.Scan(&distributor, &record.Region, &record.IsInclude, &record.Quarantined, &record.When,
+			&record.Validity.ValidFrom, &record.Validity.ValidUntil, &record.Priority); err != nil {
+			rows.Close()
+			return state, err
+		}
+		data := state.Distributors[distributor]
+		data.AddRuleRecord(record)
+		state.Distributors[distributor] = data
+	}
+	if err := rows.Err(); err != nil {
+		return state, err
+	}
+
+	loaded := make(map[string]loadedRow, len(state.Distributors))
+	for name, data := range state.Distributors {
+		loaded[name] = newLoadedRow(versions[name], data)
+	}
+	s.mu.Lock()
+	s.loaded = loaded
+	s.mu.Unlock()
+	return state, nil
+}
+
+// Save writes the distributors of state that differ from those last loaded
+// or saved, and deletes those no longer in it, in one transaction. If any of
+// them was changed by another writer in the meantime nothing is written and
+// the error wraps ErrConflict.
+func (s *Store) Save(state distribution.State) error {
+	ctx := context.Background()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if state.Strategy == "" {
+		_, err = tx.Exec(ctx, "DELETE FROM settings WHERE name = 'strategy'")
+	} else {
+		_, err = tx.Exec(ctx, `INSERT INTO settings (name, value) VALUES ('strategy', $1)
+			ON CONFLICT (name) DO UPDATE SET value = excluded.value`, state.Strategy)
+	}
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]loadedRow, len(state.Distributors))
+	var metadataRows, ruleRows [][]any
+	// Rows are written in name order so that concurrent saves lock them in
+	// the same order and cannot deadlock
+	for _, name := range sortedNames(state.Distributors) {
+		data := state.Distributors[name]
+		row := newLoadedRow(0, data)
+		previous, known := s.loaded[name]
+		switch {
+		case !known:
+			tag, err := tx.Exec(ctx, `INSERT INTO distributors (name, parent, max_children) VALUES ($1, $2, $3)
+				ON CONFLICT (name) DO NOTHING`, name, data.ParentName, data.MaxChildren)
+			if err != nil {
+				return fmt.Errorf("distributor %s: %w", name, err)
+			}
+			if tag.RowsAffected() == 0 {
+				return fmt.Errorf("distributor %s: %w", name, ErrConflict)
+			}
+			row.version = 1
+		case previous.equal(row):
+			loaded[name] = previous
+			continue
+		default:
+			tag, err := tx.Exec(ctx, `UPDATE distributors SET parent = $2, max_children = $3, version = version + 1
+				WHERE name = $1 AND version = $4`, name, data.ParentName, data.MaxChildren, previous.version)
+			if err != nil {
+				return fmt.Errorf("distributor %s: %w", name, err)
+			}
+			if tag.RowsAffected() == 0 {
+				return fmt.Errorf("distributor %s: %w", name, ErrConflict)
+			}
+			row.version = previous.version + 1
+			for _, table := range []string{"metadata", "permissions"} {
+				if _, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE distributor = $1", name); err != nil {
+					return fmt.Errorf("distributor %s: %w", name, err)
+				}
+			}
+		}
+		loaded[name] = row
+		for key, value := range row.metadata {
+			metadataRows = append(metadataRows, []any{name, key, value})
+		}
+		for _, record := range row.rules {
+			ruleRows = append(ruleRows, []any{name, record.Region, record.IsInclude, record.Quarantined, record.When,
+				record.Validity.ValidFrom, record.Validity.ValidUntil, record.Priority})
+		}
+	}
+
+	for _, name := range sortedNames(s.loaded) {
+		if _, kept := state.Distributors[name]; kept {
+			continue
+		}
+		tag, err := tx.Exec(ctx, "DELETE FROM distributors WHERE name = $1 AND version = $2", name, s.loaded[name].version)
+		if err != nil {
+			return fmt.Errorf("distributor %s: %w", name, err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("distributor %s: %w", name, ErrConflict)
+		}
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"metadata"}, []string{"distributor", "name", "value"},
+		pgx.CopyFromRows(metadataRows)); err != nil {
+		return err
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"permissions"},
+		[]string{"distributor", "region", "include", "quarantined", "predicate", "valid_from", "valid_until", "priority"},
+		pgx.CopyFromRows(ruleRows)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	s.loaded = loaded
+	return nil
+}
+
+// LoadLocations returns the stored locations sorted by country, province and
+// city code
+func (s *Store) LoadLocations() ([]distribution.Location, error) {
+	rows, err := s.pool.Query(context.Background(), `SELECT country_code, province_code, city_code, country_name, province_name, city_name
+		FROM locations ORDER BY country_code, province_code, city_code`)
+	if err != nil {
+		return nil, err
+	}
+	var locations []distribution.Location
+	for rows.Next() {
+		var l distribution.Location
+		if err := rows.Scan(&l.CountryCode, &l.ProvinceCode, &l.CityCode, &l.CountryName, &l.ProvinceName, &l.CityName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+	return locations, rows.Err()
+}
+
+// SaveLocations replaces the stored locations in one transaction. Locations
+// identical to those stored, as recognized by their fingerprint, are not
+// written again.
+func (s *Store) SaveLocations(locations []distribution.Location) error {
+	ctx := context.Background()
+	fingerprint := distribution.LocationsFingerprint(locations)
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Concurrent savers write the locations one after the other
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", locationsLock); err != nil {
+		return err
+	}
+	var stored string
+	err = tx.QueryRow(ctx, "SELECT value FROM settings WHERE name = 'locations'").Scan(&stored)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if stored == fingerprint {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM locations"); err != nil {
+		return err
+	}
+	rows := make([][]any, len(locations))
+	for i, l := range locations {
+		rows[i] = []any{l.CountryCode, l.ProvinceCode, l.CityCode, l.CountryName, l.ProvinceName, l.CityName}
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"locations"},
+		[]string{"country_code", "province_code", "city_code", "country_name", "province_name", "city_name"},
+		pgx.CopyFromRows(rows)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO settings (name, value) VALUES ('locations', $1)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value`, fingerprint); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func newLoadedRow(version int64, data distribution.DistributorData) loadedRow {
+	return loadedRow{
+		version:     version,
+		parent:      data.ParentName,
+		maxChildren: data.MaxChildren,
+		metadata:    maps.Clone(data.Metadata),
+		rules:       data.RuleRecords(),
+	}
+}
+
+// equal reports whether two rows hold the same distributor, whatever their
+// versions. Validity bounds are compared as instants, since the database
+// does not keep their time zones.
+func (r loadedRow) equal(other loadedRow) bool {
+	if r.parent != other.parent || r.maxChildren != other.maxChildren || !maps.Equal(r.metadata, other.metadata) ||
+		len(r.rules) != len(other.rules) {
+		return false
+	}
+	for i, rule := range r.rules {
+		o := other.rules[i]
+		if rule.Region != o.Region || rule.IsInclude != o.IsInclude || rule.Quarantined != o.Quarantined || rule.When != o.When || rule.Priority != o.Priority ||
+			!sameTime(rule.Validity.ValidFrom, o.Validity.ValidFrom) || !sameTime(rule.Validity.ValidUntil, o.Validity.ValidUntil) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,210 @@
+package pgstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"movie-distrbution/distribution"
+)
+
+const testLocations = "../testdata/locations.csv"
+
+// openTestStore opens the database named by $PGSTORE_TEST_DSN with its
+// tables dropped first, or skips the test when the variable is not set
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	dsn := os.Getenv("PGSTORE_TEST_DSN")
+	if dsn == "" {
+		t.Skip("PGSTORE_TEST_DSN is not set")
+	}
+	ctx := context.Background()
+	store, err := Open(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.pool.Exec(ctx, "DROP TABLE IF EXISTS permissions, metadata, distributors, locations, settings, schema_migrations")
+	store.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reopen(t, dsn)
+}
+
+func reopen(t *testing.T, dsn string) *Store {
+	t.Helper()
+	store, err := Open(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestMigrationsOrdered(t *testing.T) {
+	migrations, err := readMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", m.name, m.version, i+1)
+		}
+	}
+}
+
+func TestLoadedRowEqual(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.FixedZone("IST", 5*3600+1800))
+	inUTC := from.UTC()
+	data := distribution.DistributorData{
+		Includes:        map[string]bool{"IN": true},
+		IncludeValidity: map[string]distribution.Validity{"IN": {ValidFrom: &from}},
+	}
+	// The database hands bounds back in another zone, and maps back empty
+	// rather than nil
+	stored := distribution.DistributorData{
+		Includes:        map[string]bool{"IN": true},
+		Metadata:        map[string]string{},
+		IncludeValidity: map[string]distribution.Validity{"IN": {ValidFrom: &inUTC}},
+	}
+	if !newLoadedRow(1, data).equal(newLoadedRow(2, stored)) {
+		t.Error("rows differing in time zone and version only are not equal")
+	}
+	stored.IncludePriority = map[string]int{"IN": 1}
+	if newLoadedRow(1, data).equal(newLoadedRow(1, stored)) {
+		t.Error("rows with different rule priorities are equal")
+	}
+	stored.IncludePriority = nil
+	stored.Excludes = map[string]bool{"KA-IN": true}
+	if newLoadedRow(1, data).equal(newLoadedRow(1, stored)) {
+		t.Error("rows with different rules are equal")
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	store := openTestStore(t)
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	want := distribution.State{
+		Strategy: "specificity",
+		Distributors: map[string]distribution.DistributorData{
+			"P": {
+				Name:        "P",
+				Includes:    map[string]bool{"IN": true},
+				Excludes:    map[string]bool{"KA-IN": true},
+				Metadata:    map[string]string{"tier": "premium"},
+				MaxChildren: 2,
+			},
+			"C": {
+				Name:              "C",
+				ParentName:        "P",
+				Includes:          map[string]bool{"TN-IN": true},
+				Quarantined:       map[string]bool{"KA-IN": true},
+				IncludeConditions: map[string]string{"TN-IN": "tier=premium"},
+				IncludeValidity:   map[string]distribution.Validity{"TN-IN": {ValidFrom: &from}},
+				IncludePriority:   map[string]int{"TN-IN": 5},
+			},
+		},
+	}
+	if err := store.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Strategy != want.Strategy || len(got.Distributors) != len(want.Distributors) {
+		t.Fatalf("Load() = %+v, want %+v", got, want)
+	}
+	for name, data := range want.Distributors {
+		if !newLoadedRow(0, got.Distributors[name]).equal(newLoadedRow(0, data)) {
+			t.Errorf("distributor %s = %+v, want %+v", name, got.Distributors[name], data)
+		}
+	}
+}
+
+func TestSaveConflict(t *testing.T) {
+	store := openTestStore(t)
+	dsn := os.Getenv("PGSTORE_TEST_DSN")
+	initial := distribution.State{Distributors: map[string]distribution.DistributorData{
+		"A": {Name: "A", Includes: map[string]bool{"IN": true}},
+		"B": {Name: "B", Includes: map[string]bool{"US": true}},
+	}}
+	if err := store.Save(initial); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two writers load the same state
+	first, second := reopen(t, dsn), reopen(t, dsn)
+	firstState, err := first.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondState, err := second.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := firstState.Distributors["A"]
+	a.Excludes = map[string]bool{"KA-IN": true}
+	firstState.Distributors["A"] = a
+	if err := first.Save(firstState); err != nil {
+		t.Fatal(err)
+	}
+
+	// A change to another distributor goes through
+	b := secondState.Distributors["B"]
+	b.MaxChildren = 3
+	secondState.Distributors["B"] = b
+	if err := second.Save(secondState); err != nil {
+		t.Fatalf("saving a change to B: %v", err)
+	}
+
+	// but one to the distributor the first writer changed does not
+	a = secondState.Distributors["A"]
+	a.Includes = map[string]bool{"US": true}
+	secondState.Distributors["A"] = a
+	if err := second.Save(secondState); !errors.Is(err, ErrConflict) {
+		t.Errorf("saving a stale A: err = %v, want ErrConflict", err)
+	}
+	delete(secondState.Distributors, "A")
+	if err := second.Save(secondState); !errors.Is(err, ErrConflict) {
+		t.Errorf("removing a stale A: err = %v, want ErrConflict", err)
+	}
+
+	// After loading again the change applies
+	secondState, err = second.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := secondState.Distributors["A"].Excludes; !reflect.DeepEqual(got, map[string]bool{"KA-IN": true}) {
+		t.Errorf("A's excludes = %v, want the first writer's KA-IN", got)
+	}
+	delete(secondState.Distributors, "A")
+	if err := second.Save(secondState); err != nil {
+		t.Errorf("removing A after loading again: %v", err)
+	}
+}
+
+func TestLocationsRoundTrip(t *testing.T) {
+	store := openTestStore(t)
+	ds := distribution.NewDistributionSystem()
+	if err := ds.LoadLocationData(testLocations, true); err != nil {
+		t.Fatal(err)
+	}
+	want := ds.LocationRecords()
+	for i := 0; i < 2; i++ {
+		if err := store.SaveLocations(want); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := store.LoadLocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadLocations() = %+v, want %+v", got, want)
+	}
+}
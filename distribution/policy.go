@@ -0,0 +1,163 @@
+package distribution
+
+import (
+	"sort"
+	"strings"
+)
+
+// The policy engine gives every distributor a set of effective permissions,
+//
+//	effective(d) = (effective(parent) ∩ includes(d)) − excludes(d)
+//
+// where a root's parent allows everywhere and the resolution strategy decides
+// which of d's own rules governs each location. A region is permitted when
+// every location in it is in the effective set, so a check of a country is
+// denied when any ancestor excludes one of its provinces or cities.
+
+// HasPermission checks if distribution is allowed in the whole of the given
+// region. Each location is decided by the most specific rules that contain
+// it, so only region itself and the regions that rules anywhere up the
+// parent chain name inside it need to be evaluated.
+func (d *Distributor) HasPermission(region string) bool {
+	return d.deniedWithin(region) == ""
+}
+
+// admits evaluates the policy at region without looking inside it: the
+// strategy picks the deciding rule among d's own, an exclude denies and an
+// include defers to the parent, if any. An include is valid when the parent
+// admits its region, so a child can include a country its parent carves a
+// province out of; the intersection with the parent removes the province.
+func (d *Distributor) admits(region string) bool {
+	_, isInclude, matched := d.resolution().Decide(d, region)
+	if !matched || !isInclude {
+		return false
+	}
+	if d.Parent != nil {
+		return d.Parent.admits(region)
+	}
+	return true
+}
+
+// deniedWithin returns region, or the region inside it, that decides a
+// location d does not permit, or "" if d permits all of region. Regions are
+// tried in lexical order. region itself only decides the locations that no
+// rule inside it covers, so a province whose cities are each included is
+// permitted although no rule names the province.
+func (d *Distributor) deniedWithin(region string) string {
+	return d.deniedAmong(region, d.chainRulesWithin(region))
+}
+
+// deniedAmong is deniedWithin given the chain's rules inside region
+func (d *Distributor) deniedAmong(region string, inner []string) string {
+	if len(inner) == 0 {
+		if d.admits(region) {
+			return ""
+		}
+		return region
+	}
+	children := d.subregions[region]
+	if children == nil {
+		// Without location data every rule inside region and region
+		// itself are taken to decide some location
+		if !d.admits(region) {
+			return region
+		}
+		for _, rule := range inner {
+			if !d.admits(rule) {
+				return rule
+			}
+		}
+		return ""
+	}
+
+	// Group the rules by the child of region they fall in
+	byChild := make(map[string][]string)
+	for _, rule := range inner {
+		parts := strings.Split(rule, "-")
+		child := strings.Join(parts[len(parts)-regionLevel(region)-1:], "-")
+		if rule != child {
+			byChild[child] = append(byChild[child], rule)
+		} else if _, exists := byChild[child]; !exists {
+			byChild[child] = nil
+		}
+	}
+	for child := range children {
+		if _, ruled := byChild[child]; !ruled {
+			if !d.admits(region) {
+				return region
+			}
+			break
+		}
+	}
+	for _, child := range sortedKeys(byChild) {
+		if !children[child] {
+			continue
+		}
+		if denied := d.deniedAmong(child, byChild[child]); denied != "" {
+			return denied
+		}
+	}
+	return ""
+}
+
+// chainRulesWithin returns the sorted regions strictly inside region that an
+// include or exclude of d or one of its ancestors names
+func (d *Distributor) chainRulesWithin(region string) []string {
+	if regionLevel(region) == 3 {
+		return nil
+	}
+	found := make(map[string]bool)
+	visited := make(map[*Distributor]bool)
+	for dist := d; dist != nil && !visited[dist]; dist = dist.Parent {
+		visited[dist] = true
+		for rule := range dist.innerRules[region] {
+			if dist.Includes[rule] || dist.Excludes[rule] {
+				found[rule] = true
+			}
+		}
+	}
+	inner := make([]string, 0, len(found))
+	for rule := range found {
+		inner = append(inner, rule)
+	}
+	sort.Strings(inner)
+	return inner
+}
+
+// indexRule records region in innerRules under every region strictly
+// containing it
+func (d *Distributor) indexRule(region string) {
+	for _, outer := range enclosingRegions(region) {
+		if outer == region {
+			continue
+		}
+		if d.innerRules[outer] == nil {
+			d.innerRules[outer] = make(map[string]bool)
+		}
+		d.innerRules[outer][region] = true
+	}
+}
+
+// reindexRules rebuilds innerRules from the distributor's rules, after they
+// have been replaced wholesale
+func (d *Distributor) reindexRules() {
+	d.innerRules = make(map[string]map[string]bool)
+	for _, rules := range []map[string]bool{d.Includes, d.Excludes} {
+		for region := range rules {
+			d.indexRule(region)
+		}
+	}
+}
+
+// isStrictSubregion reports whether inner lies inside outer and is smaller
+func isStrictSubregion(inner, outer string) bool {
+	return regionLevel(inner) > regionLevel(outer) && strings.HasSuffix(inner, "-"+outer)
+}
+
+// addSubregion records region as directly inside parent
+func (ds *DistributionSystem) addSubregion(parent, region string) {
+	if ds.subregions[parent] == nil {
+		ds.subregions[parent] = make(map[string]bool)
+	}
+	ds.subregions[parent][region] = true
+}
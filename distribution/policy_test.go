@@ -0,0 +1,348 @@
+package distribution
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThreeLevelChain(t *testing.T) {
+	// The ancestor A carves KA-IN out of IN, and the middle distributor M
+	// includes all of IN, which A admits as a whole
+	chain := []string{"A", "M", "L"}
+	ancestorRules := []testRule{include("A", "IN"), exclude("A", "KA-IN"), include("M", "IN")}
+
+	tests := []struct {
+		name      string
+		leafRules []testRule
+		region    string
+		want      bool
+	}{
+		{"city in the excluded province", []testRule{include("L", "IN")}, "BLR-KA-IN", false},
+		{"other city in the excluded province", []testRule{include("L", "IN")}, "MYS-KA-IN", false},
+		{"city elsewhere in the country", []testRule{include("L", "IN")}, "CENAI-TN-IN", true},
+		{"city in another province", []testRule{include("L", "IN")}, "GGN-HR-IN", true},
+		{"city outside the country", []testRule{include("L", "IN")}, "LA-CA-US", false},
+		{"excluded province itself", []testRule{include("L", "IN")}, "KA-IN", false},
+		{"whole country", []testRule{include("L", "IN")}, "IN", false},
+		{"province include of the leaf", []testRule{include("L", "TN-IN")}, "MDU-TN-IN", true},
+		{"outside the leaf's province include", []testRule{include("L", "TN-IN")}, "GGN-HR-IN", false},
+		{"city exclude of the leaf", []testRule{include("L", "IN"), exclude("L", "MDU-TN-IN")}, "MDU-TN-IN", false},
+		{"sibling of the leaf's exclude", []testRule{include("L", "IN"), exclude("L", "MDU-TN-IN")}, "CENAI-TN-IN", true},
+		{"no rules of its own", nil, "CENAI-TN-IN", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := newTestSystem(t)
+			addChain(t, ds, chain, append(append([]testRule(nil), ancestorRules...), tt.leafRules...)...)
+			assertChecks(t, ds, "L", map[string]bool{tt.region: tt.want})
+		})
+	}
+}
+
+func TestThreeLevelChainRejectsIncludeInExcludedProvince(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"A", "M", "L"}, include("A", "IN"), exclude("A", "KA-IN"), include("M", "IN"))
+	for _, region := range []string{"BLR-KA-IN", "KA-IN"} {
+		if err := ds.AddPermission("L", region, true); err == nil {
+			t.Errorf("leaf included %s, which the ancestor excludes", region)
+		}
+	}
+}
+
+// forEachStrategy runs test once per resolution strategy on a fresh system
+// using it
+func forEachStrategy(t *testing.T, test func(t *testing.T, ds *DistributionSystem, strategy string)) {
+	for _, strategy := range StrategyNames() {
+		t.Run(strategy, func(t *testing.T) {
+			ds := newTestSystem(t)
+			if err := ds.SetStrategy(strategy); err != nil {
+				t.Fatal(err)
+			}
+			test(t, ds, strategy)
+		})
+	}
+}
+
+func TestWholeRegionChecks(t *testing.T) {
+	// A region is permitted only when every location in it is, whichever
+	// level the rules that decide those locations are at
+	tests := []struct {
+		name  string
+		chain []string
+		rules []testRule
+		want  map[string]bool
+	}{
+		{
+			name:  "country include",
+			chain: []string{"D"},
+			rules: []testRule{include("D", "IN")},
+			want:  map[string]bool{"IN": true, "KA-IN": true, "BLR-KA-IN": true, "US": false, "CA-US": false},
+		},
+		{
+			name:  "province exclude denies the country",
+			chain: []string{"D"},
+			rules: []testRule{include("D", "IN"), exclude("D", "HR-IN")},
+			want:  map[string]bool{"IN": false, "HR-IN": false, "GGN-HR-IN": false, "KA-IN": true, "TN-IN": true},
+		},
+		{
+			name:  "city exclude denies its province and country",
+			chain: []string{"D"},
+			rules: []testRule{include("D", "IN"), exclude("D", "MYS-KA-IN")},
+			want:  map[string]bool{"IN": false, "KA-IN": false, "MYS-KA-IN": false, "BLR-KA-IN": true, "TN-IN": true},
+		},
+		{
+			name:  "every city included permits the province",
+			chain: []string{"D"},
+			rules: []testRule{include("D", "BLR-KA-IN"), include("D", "MYS-KA-IN")},
+			want:  map[string]bool{"KA-IN": true, "IN": false, "BLR-KA-IN": true},
+		},
+		{
+			name:  "some cities included do not permit the province",
+			chain: []string{"D"},
+			rules: []testRule{include("D", "CENAI-TN-IN")},
+			want:  map[string]bool{"TN-IN": false, "CENAI-TN-IN": true, "MDU-TN-IN": false},
+		},
+		{
+			name:  "every province included permits the country",
+			chain: []string{"D"},
+			rules: []testRule{include("D", "CA-US"), include("D", "NY-US")},
+			want:  map[string]bool{"US": true, "NYC-NY-US": true},
+		},
+		{
+			name:  "ancestor's city exclude denies the descendant's province",
+			chain: []string{"A", "B", "C"},
+			rules: []testRule{include("A", "US"), exclude("A", "SF-CA-US"), include("B", "US"), include("C", "CA-US")},
+			want:  map[string]bool{"CA-US": false, "LA-CA-US": true, "SF-CA-US": false, "US": false},
+		},
+		{
+			name:  "descendant cannot widen the ancestor",
+			chain: []string{"A", "B"},
+			rules: []testRule{include("A", "KA-IN"), include("B", "BLR-KA-IN")},
+			want:  map[string]bool{"BLR-KA-IN": true, "MYS-KA-IN": false, "KA-IN": false, "IN": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachStrategy(t, func(t *testing.T, ds *DistributionSystem, _ string) {
+				addChain(t, ds, tt.chain, tt.rules...)
+				assertChecks(t, ds, tt.chain[len(tt.chain)-1], tt.want)
+			})
+		})
+	}
+}
+
+func TestWholeRegionChecksByStrategy(t *testing.T) {
+	// Where rules conflict at different levels the strategies disagree on
+	// the locations, and so on the regions containing them
+	rules := []testRule{include("D", "US"), exclude("D", "CA-US"), include("D", "LA-CA-US")}
+	want := map[string]map[string]bool{
+		"excludes-win": {"LA-CA-US": false, "SF-CA-US": false, "CA-US": false, "NY-US": true, "US": false},
+		"specificity":  {"LA-CA-US": true, "SF-CA-US": false, "CA-US": false, "NY-US": true, "US": false},
+		"priority":     {"LA-CA-US": true, "SF-CA-US": false, "CA-US": false, "NY-US": true, "US": false},
+	}
+	forEachStrategy(t, func(t *testing.T, ds *DistributionSystem, strategy string) {
+		addChain(t, ds, []string{"D"}, rules...)
+		assertChecks(t, ds, "D", want[strategy])
+	})
+}
+
+func TestPatternRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		pattern   string
+		isInclude bool
+		base      []testRule
+		matches   []string
+		want      map[string]bool
+	}{
+		{
+			name:      "cities of a province",
+			pattern:   "*-TN-IN",
+			isInclude: true,
+			matches:   []string{"CENAI-TN-IN", "MDU-TN-IN"},
+			want:      map[string]bool{"CENAI-TN-IN": true, "MDU-TN-IN": true, "TN-IN": true, "KA-IN": false},
+		},
+		{
+			name:      "provinces of a country",
+			pattern:   "*-US",
+			isInclude: true,
+			matches:   []string{"CA-US", "NY-US"},
+			want:      map[string]bool{"US": true, "SF-CA-US": true, "IN": false},
+		},
+		{
+			name:      "cities of a country, excluded",
+			pattern:   "M*-*-IN",
+			isInclude: false,
+			base:      []testRule{include("D", "IN")},
+			matches:   []string{"MDU-TN-IN", "MYS-KA-IN"},
+			want:      map[string]bool{"MDU-TN-IN": false, "MYS-KA-IN": false, "BLR-KA-IN": true, "KA-IN": false, "HR-IN": true},
+		},
+		{
+			name:      "lower-case pattern",
+			pattern:   "*-ka-in",
+			isInclude: true,
+			matches:   []string{"BLR-KA-IN", "MYS-KA-IN"},
+			want:      map[string]bool{"KA-IN": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachStrategy(t, func(t *testing.T, ds *DistributionSystem, _ string) {
+				addChain(t, ds, []string{"D"}, tt.base...)
+				regions, err := ds.ExpandRegions(tt.pattern, "", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if strings.Join(regions, ",") != strings.Join(tt.matches, ",") {
+					t.Fatalf("ExpandRegions(%s) = %v, want %v", tt.pattern, regions, tt.matches)
+				}
+				if err := ds.AddPermissions("D", regions, tt.isInclude); err != nil {
+					t.Fatal(err)
+				}
+				assertChecks(t, ds, "D", tt.want)
+			})
+		})
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	ds := newTestSystem(t)
+	for _, pattern := range []string{"*-XX", "[-IN", "*-*-*-IN"} {
+		if regions, err := ds.MatchRegions(pattern); err == nil {
+			t.Errorf("MatchRegions(%s) = %v, want an error", pattern, regions)
+		}
+	}
+}
+
+func TestValidityWindows(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	window := Validity{ValidFrom: &from, ValidUntil: &until}
+	before, during, last := from.Add(-time.Second), from.Add(time.Hour), until.Add(-time.Nanosecond)
+
+	tests := []struct {
+		name     string
+		rules    []testRule
+		bounded  testRule
+		validity Validity
+		at       time.Time
+		want     map[string]bool
+	}{
+		{"include before its window", []testRule{include("D", "KA-IN")}, include("D", "KA-IN"), window, before, map[string]bool{"KA-IN": false, "BLR-KA-IN": false}},
+		{"include from its first instant", []testRule{include("D", "KA-IN")}, include("D", "KA-IN"), window, from, map[string]bool{"KA-IN": true, "BLR-KA-IN": true}},
+		{"include during its window", []testRule{include("D", "KA-IN")}, include("D", "KA-IN"), window, during, map[string]bool{"KA-IN": true}},
+		{"include at its last instant", []testRule{include("D", "KA-IN")}, include("D", "KA-IN"), window, last, map[string]bool{"KA-IN": true}},
+		{"include once expired", []testRule{include("D", "KA-IN")}, include("D", "KA-IN"), window, until, map[string]bool{"KA-IN": false}},
+		{"open-ended include", []testRule{include("D", "KA-IN")}, include("D", "KA-IN"), Validity{ValidFrom: &from}, until.AddDate(10, 0, 0), map[string]bool{"KA-IN": true}},
+		{"include until a date", []testRule{include("D", "KA-IN")}, include("D", "KA-IN"), Validity{ValidUntil: &until}, before, map[string]bool{"KA-IN": true}},
+		{"exclude during its window", []testRule{include("D", "IN"), exclude("D", "KA-IN")}, exclude("D", "KA-IN"), window, during, map[string]bool{"KA-IN": false, "IN": false, "TN-IN": true}},
+		{"exclude before its window", []testRule{include("D", "IN"), exclude("D", "KA-IN")}, exclude("D", "KA-IN"), window, before, map[string]bool{"KA-IN": true, "IN": true}},
+		{"exclude once expired", []testRule{include("D", "IN"), exclude("D", "MYS-KA-IN")}, exclude("D", "MYS-KA-IN"), window, until, map[string]bool{"MYS-KA-IN": true, "KA-IN": true, "IN": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachStrategy(t, func(t *testing.T, ds *DistributionSystem, _ string) {
+				addChain(t, ds, []string{"D"}, tt.rules...)
+				if err := ds.SetRuleValidity(tt.bounded.distributor, tt.bounded.region, tt.bounded.isInclude, tt.validity); err != nil {
+					t.Fatal(err)
+				}
+				at := tt.at
+				ds.SetClock(func() time.Time { return at })
+				assertChecks(t, ds, "D", tt.want)
+			})
+		})
+	}
+}
+
+func TestValidityInheritedFromParent(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	forEachStrategy(t, func(t *testing.T, ds *DistributionSystem, _ string) {
+		addChain(t, ds, []string{"P", "C"}, include("P", "IN"), include("C", "KA-IN"))
+		if err := ds.SetRuleValidity("P", "IN", true, Validity{ValidFrom: &from, ValidUntil: &until}); err != nil {
+			t.Fatal(err)
+		}
+		for at, want := range map[time.Time]bool{from.Add(-time.Hour): false, from: true, until: false} {
+			at := at
+			ds.SetClock(func() time.Time { return at })
+			assertChecks(t, ds, "C", map[string]bool{"KA-IN": want, "BLR-KA-IN": want})
+		}
+	})
+}
+
+func TestInvalidValidity(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"D"}, include("D", "IN"))
+	from := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	if err := ds.SetRuleValidity("D", "IN", true, Validity{ValidFrom: &from, ValidUntil: &from}); err == nil {
+		t.Error("SetRuleValidity accepted an empty window")
+	}
+	if err := ds.SetRuleValidity("D", "KA-IN", true, Validity{ValidFrom: &from}); err == nil {
+		t.Error("SetRuleValidity accepted a rule the distributor does not have")
+	}
+}
+
+func TestConditionalRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []testRule
+		region   string
+		include  bool
+		when     string
+		metadata map[string]string
+		want     map[string]bool
+	}{
+		{"include whose predicate holds", nil, "KA-IN", true, "tier=premium", map[string]string{"tier": "premium"}, map[string]bool{"KA-IN": true, "BLR-KA-IN": true}},
+		{"include whose predicate fails", nil, "KA-IN", true, "tier=premium", map[string]string{"tier": "basic"}, map[string]bool{"KA-IN": false}},
+		{"include without the metadata key", nil, "KA-IN", true, "tier=premium", nil, map[string]bool{"KA-IN": false}},
+		{"negated include without the metadata key", nil, "KA-IN", true, "tier!=basic", nil, map[string]bool{"KA-IN": true}},
+		{"negated include whose key matches", nil, "KA-IN", true, "tier!=basic", map[string]string{"tier": "basic"}, map[string]bool{"KA-IN": false}},
+		{"exclude whose predicate holds", []testRule{include("D", "IN")}, "TN-IN", false, "region=south", map[string]string{"region": "south"}, map[string]bool{"TN-IN": false, "IN": false, "KA-IN": true}},
+		{"exclude whose predicate fails", []testRule{include("D", "IN")}, "TN-IN", false, "region=south", map[string]string{"region": "north"}, map[string]bool{"TN-IN": true, "IN": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachStrategy(t, func(t *testing.T, ds *DistributionSystem, _ string) {
+				addChain(t, ds, []string{"D"}, tt.rules...)
+				if err := ds.AddConditionalPermission("D", tt.region, tt.include, tt.when); err != nil {
+					t.Fatal(err)
+				}
+				for key, value := range tt.metadata {
+					if err := ds.SetMetadata("D", key, value); err != nil {
+						t.Fatal(err)
+					}
+				}
+				assertChecks(t, ds, "D", tt.want)
+			})
+		})
+	}
+}
+
+func TestConditionalRuleFollowsMetadata(t *testing.T) {
+	forEachStrategy(t, func(t *testing.T, ds *DistributionSystem, _ string) {
+		addChain(t, ds, []string{"D"})
+		if err := ds.AddConditionalPermission("D", "US", true, "tier=premium"); err != nil {
+			t.Fatal(err)
+		}
+		for _, step := range []struct {
+			tier string
+			want bool
+		}{{"premium", true}, {"basic", false}, {"", false}, {"premium", true}} {
+			if err := ds.SetMetadata("D", "tier", step.tier); err != nil {
+				t.Fatal(err)
+			}
+			assertChecks(t, ds, "D", map[string]bool{"US": step.want, "NYC-NY-US": step.want})
+		}
+	})
+}
+
+func TestInvalidPredicate(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"D"})
+	for _, when := range []string{"tier", "=premium", "!=basic"} {
+		if err := ds.AddConditionalPermission("D", "IN", true, when); err == nil {
+			t.Errorf("AddConditionalPermission accepted the predicate %q", when)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package distribution
+
+import "fmt"
+
+// SetRulePriority sets the priority an existing include or exclude is ranked
+// by under the priority strategy. A priority of 0, which rules have by
+// default, is not stored.
+func (ds *DistributionSystem) SetRulePriority(distributorName, region string, isInclude bool, priority int) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	distributor, exists := ds.distributors[distributorName]
+	if !exists {
+		return fmt.Errorf("distributor %s does not exist", distributorName)
+	}
+	region = ds.CanonicalRegion(region)
+	rules, priorities, kind := distributor.Excludes, distributor.ExcludePriority, "exclude"
+	if isInclude {
+		rules, priorities, kind = distributor.Includes, distributor.IncludePriority, "include"
+	}
+	if !rules[region] {
+		return fmt.Errorf("distributor %s has no %s permission for %s", distributorName, kind, region)
+	}
+
+	if priority == 0 {
+		delete(priorities, region)
+	} else {
+		priorities[region] = priority
+	}
+	return nil
+}
+
+// rulePriority returns the priority of one of the distributor's rules
+func (d *Distributor) rulePriority(isInclude bool, region string) int {
+	if isInclude {
+		return d.IncludePriority[region]
+	}
+	return d.ExcludePriority[region]
+}
+
+// prioritySuffix describes the priority of a rule for display
+func prioritySuffix(priorities map[string]int, region string) string {
+	if priority, set := priorities[region]; set {
+		return fmt.Sprintf(" [priority %d]", priority)
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package distribution
+
+import (
+	"fmt"
+	"sort"
+)
+
+// QuarantineViolations moves every include that its parent does not permit
+// out of the distributor's includes and into its quarantine, so hand-edited
+// or legacy data can be loaded without such includes taking effect. Parents
+// are processed before their children, so an include quarantined at one level
+// is not counted as permitted further down. It returns the number of
+// includes quarantined.
+func (ds *DistributionSystem) QuarantineViolations() int {
+	names := ds.distributorNames()
+	depths := make(map[string]int, len(names))
+	for _, name := range names {
+		// Distributors in a parent cycle report an error; their position in
+		// the order does not matter
+		depths[name], _ = ds.Depth(name)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return depths[names[i]] < depths[names[j]]
+	})
+
+	quarantined := 0
+	for _, name := range names {
+		dist := ds.distributors[name]
+		if dist.Parent == nil {
+			continue
+		}
+		for _, region := range sortedKeys(dist.Includes) {
+			if !dist.Parent.admits(region) {
+				delete(dist.Includes, region)
+				dist.Quarantined[region] = true
+				quarantined++
+			}
+		}
+	}
+	return quarantined
+}
+
+// QuarantinedIncludes returns the quarantined includes of every distributor
+// that has any, keyed by distributor name
+func (ds *DistributionSystem) QuarantinedIncludes() map[string][]string {
+	found := make(map[string][]string)
+	for name, dist := range ds.distributors {
+		if len(dist.Quarantined) > 0 {
+			found[name] = sortedKeys(dist.Quarantined)
+		}
+	}
+	return found
+}
+
+// ReviewQuarantine settles quarantined includes of a distributor: "approve"
+// restores them as includes, which still requires the parent to permit them,
+// and "drop" discards them. An empty region reviews every quarantined include
+// of the distributor. It returns the regions that were settled.
+func (ds *DistributionSystem) ReviewQuarantine(name, region, decision string) ([]string, error) {
+	distributor, exists := ds.distributors[name]
+	if !exists {
+		return nil, fmt.Errorf("distributor %s does not exist", name)
+	}
+	if decision != "approve" && decision != "drop" {
+		return nil, fmt.Errorf("decision must be approve or drop, got %q", decision)
+	}
+
+	regions := sortedKeys(distributor.Quarantined)
+	if region != "" {
+		region = ds.CanonicalRegion(region)
+		if !distributor.Quarantined[region] {
+			return nil, fmt.Errorf("%s has no quarantined include %s", name, region)
+		}
+		regions = []string{region}
+	}
+
+	for _, r := range regions {
+		if decision == "drop" {
+			distributor.deleteRule(true, r)
+			continue
+		}
+		if err := distributor.AddPermission(r, true); err != nil {
+			return nil, err
+		}
+		delete(distributor.Quarantined, r)
+	}
+	return regions, nil
+}
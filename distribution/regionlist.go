@@ -0,0 +1,112 @@
+package distribution
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ReadRegionFile reads region codes from a file, one per line. Blank lines
+// and lines starting with # are ignored.
+func ReadRegionFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadRegions(file)
+}
+
+// ReadRegions reads region codes from r in the format of ReadRegionFile
+func ReadRegions(r io.Reader) ([]string, error) {
+	var regions []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		regions = append(regions, line)
+	}
+	return regions, scanner.Err()
+}
+
+// ProvincesOf returns the province-country codes of every province of a
+// country present in the loaded location data, in lexical order
+func (ds *DistributionSystem) ProvincesOf(country string) ([]string, error) {
+	country = ds.CanonicalRegion(country)
+	if strings.Contains(country, "-") || !ds.ValidateRegion(country) {
+		return nil, fmt.Errorf("invalid country code: %s", country)
+	}
+
+	seen := make(map[string]bool)
+	for key, location := range ds.provinceIndex {
+		if location.CountryCode == country && location.ProvinceCode != "" {
+			seen[key] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// AddPermissions adds the same kind of permission for several regions at
+// once. Either every region is added or, if any of them is rejected, none is.
+func (ds *DistributionSystem) AddPermissions(distributorName string, regions []string, isInclude bool) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	trial := ds.Clone()
+	for _, region := range regions {
+		if err := trial.AddPermission(distributorName, region, isInclude); err != nil {
+			return err
+		}
+	}
+
+	for _, region := range regions {
+		if err := ds.addPermission(distributorName, region, isInclude); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpandRegions resolves a region argument into the
+// list of codes to add: the contents of regionFile if given, otherwise the
+// single region, with patterns replaced by the regions they match and
+// optionally expanded into all of its provinces
+func (ds *DistributionSystem) ExpandRegions(region, regionFile, expand string) ([]string, error) {
+	var regions []string
+	if regionFile != "" {
+		var err error
+		regions, err = ReadRegionFile(regionFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		regions = []string{region}
+	}
+	regions, err := ds.expandPatterns(regions)
+	if err != nil {
+		return nil, err
+	}
+
+	switch expand {
+	case "":
+		return regions, nil
+	case "provinces":
+		var expanded []string
+		for _, country := range regions {
+			provinces, err := ds.ProvincesOf(country)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, provinces...)
+		}
+		sort.Strings(expanded)
+		return expanded, nil
+	default:
+		return nil, fmt.Errorf("unsupported expansion %s", expand)
+	}
+}
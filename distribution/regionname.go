@@ -0,0 +1,96 @@
+package distribution
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RegionMatch is a region found by FindRegions, with the edit distance
+// between its name and the name searched for (0 for an exact match)
+type RegionMatch struct {
+	Region   string
+	Name     string
+	Distance int
+}
+
+// normalizeName lowercases a region name and trims each of its
+// comma-separated parts, so "chennai ,Tamil Nadu" matches "Chennai, Tamil Nadu"
+func normalizeName(name string) string {
+	parts := strings.Split(name, ",")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ResolveRegionName returns the code of the region whose full name, as given
+// by RegionName, is name, for example "Chennai, Tamil Nadu, India" or
+// "Tamil Nadu, India". Case and spacing around commas are ignored. A name
+// shared by several regions is reported as ambiguous.
+func (ds *DistributionSystem) ResolveRegionName(name string) (string, error) {
+	wanted := normalizeName(name)
+	// A name has one part per level, so only that level's index is searched
+	index := ds.levelIndex(strings.Count(wanted, ",") + 1)
+	var matches []string
+	for _, region := range sortedKeys(index) {
+		if normalizeName(ds.RegionName(region)) == wanted {
+			matches = append(matches, region)
+		}
+	}
+	ds.countScanned(len(index))
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no region is named %q", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("region name %q is ambiguous: %s", name, strings.Join(matches, ", "))
+	}
+}
+
+// FindRegions returns the regions whose name is close to name, tolerating
+// about one typo per four characters. A name without commas is compared with
+// the most specific part of each region's name (the city, province or
+// country name); a name with commas is compared with the full name. Matches
+// are ordered from the closest, then by region code.
+func (ds *DistributionSystem) FindRegions(name string) []RegionMatch {
+	wanted := normalizeName(name)
+	fullName := strings.Contains(wanted, ",")
+	maxDistance := len(wanted) / 4
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	var matches []RegionMatch
+	ds.eachLocation(func(region string, location *Location) {
+		candidate := ds.RegionName(region)
+		if !fullName {
+			switch strings.Count(region, "-") {
+			case 0:
+				candidate = location.CountryName
+			case 1:
+				candidate = location.ProvinceName
+			default:
+				candidate = location.CityName
+			}
+		}
+		// Lengths further apart than the limit cannot be within it
+		if diff := len(candidate) - len(wanted); diff > maxDistance || -diff > maxDistance {
+			return
+		}
+		if distance := editDistance(wanted, normalizeName(candidate)); distance <= maxDistance {
+			matches = append(matches, RegionMatch{Region: region, Name: ds.RegionName(region), Distance: distance})
+		}
+	})
+	ds.countScanned(ds.LocationCount())
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].Region < matches[j].Region
+	})
+	return matches
+}
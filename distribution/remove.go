@@ -0,0 +1,81 @@
+package distribution
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// RemoveDistributor deletes a distributor and returns the names of every
+// distributor removed, in lexical order. A distributor with children is only
+// removed if cascade is set, which also removes all its descendants, or
+// reparent is set, which attaches its direct children to its own parent.
+// Either way no remaining distributor is left pointing at a removed one.
+//
+// Reparenting re-checks every include below the removed distributor against
+// the parent chain it now resolves through, like MoveDistributor, and returns
+// the includes that chain does not allow, keyed by distributor. Unless prune
+// is set, such includes make the removal fail and leave the hierarchy
+// unchanged; with prune they are removed.
+func (ds *DistributionSystem) RemoveDistributor(name string, cascade, reparent, prune bool) ([]string, map[string][]string, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	distributor, exists := ds.distributors[name]
+	if !exists {
+		return nil, nil, fmt.Errorf("distributor %s does not exist", name)
+	}
+	if cascade && reparent {
+		return nil, nil, errors.New("cascade and reparent cannot be combined")
+	}
+
+	var children []*Distributor
+	for _, childName := range ds.distributorNames() {
+		if child := ds.distributors[childName]; child.Parent == distributor {
+			children = append(children, child)
+		}
+	}
+
+	removed := []string{name}
+	var invalid map[string][]string
+	switch {
+	case len(children) == 0:
+	case cascade:
+		descendants, err := ds.Descendants(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		removed = append(removed, descendants...)
+	case reparent:
+		if grandparent := distributor.Parent; grandparent != nil && grandparent.MaxChildren > 0 {
+			// The removed distributor frees one of the grandparent's slots
+			if total := ds.childCounts()[grandparent.Name] - 1 + len(children); total > grandparent.MaxChildren {
+				return nil, nil, fmt.Errorf("reparenting would give %s %d of at most %d children", grandparent.Name, total, grandparent.MaxChildren)
+			}
+		}
+		descendants, err := ds.Descendants(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, child := range children {
+			child.Parent = distributor.Parent
+		}
+		invalid = ds.includesOutsideParent(descendants)
+		if len(invalid) > 0 && !prune {
+			for _, child := range children {
+				child.Parent = distributor
+			}
+			return nil, invalid, fmt.Errorf("removing %s would leave %d includes outside the new parent chain", name, countRegions(invalid))
+		}
+		ds.pruneIncludes(invalid)
+	default:
+		return nil, nil, fmt.Errorf("distributor %s has %d children; use cascade or reparent", name, len(children))
+	}
+
+	for _, removedName := range removed {
+		delete(ds.distributors, removedName)
+		delete(ds.unresolvedParents, removedName)
+	}
+	sort.Strings(removed)
+	return removed, invalid, nil
+}
@@ -0,0 +1,108 @@
+package distribution
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newExpiringChain returns G → X → C → L, where G's include of IN ends at
+// until and X, C and L narrow it down to one city
+func newExpiringChain(t *testing.T, until time.Time) *DistributionSystem {
+	t.Helper()
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"G", "X", "C", "L"},
+		include("G", "IN"), include("G", "US"), include("X", "IN"), include("X", "CA-US"),
+		include("C", "KA-IN"), include("C", "CA-US"), include("L", "BLR-KA-IN"))
+	if err := ds.SetRuleValidity("G", "IN", true, Validity{ValidUntil: &until}); err != nil {
+		t.Fatal(err)
+	}
+	return ds
+}
+
+func TestRemoveDistributorReparent(t *testing.T) {
+	until := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		at          time.Time
+		prune       bool
+		wantErr     bool
+		wantInvalid map[string][]string
+		// wantIncludes is C's and L's includes afterwards
+		wantIncludes map[string][]string
+	}{
+		{
+			name:         "chain still allows every include",
+			at:           until.Add(-time.Hour),
+			wantIncludes: map[string][]string{"C": {"CA-US", "KA-IN"}, "L": {"BLR-KA-IN"}},
+		},
+		{
+			name:         "includes outside the new chain fail the removal",
+			at:           until,
+			wantErr:      true,
+			wantInvalid:  map[string][]string{"C": {"KA-IN"}, "L": {"BLR-KA-IN"}},
+			wantIncludes: map[string][]string{"C": {"CA-US", "KA-IN"}, "L": {"BLR-KA-IN"}},
+		},
+		{
+			name:         "includes outside the new chain are pruned",
+			at:           until,
+			prune:        true,
+			wantInvalid:  map[string][]string{"C": {"KA-IN"}, "L": {"BLR-KA-IN"}},
+			wantIncludes: map[string][]string{"C": {"CA-US"}, "L": {}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := newExpiringChain(t, until)
+			at := tt.at
+			ds.SetClock(func() time.Time { return at })
+
+			removed, invalid, err := ds.RemoveDistributor("X", false, true, tt.prune)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RemoveDistributor: error %v, want error %v", err, tt.wantErr)
+			}
+			if len(invalid) > 0 || len(tt.wantInvalid) > 0 {
+				if !reflect.DeepEqual(invalid, tt.wantInvalid) {
+					t.Errorf("invalid includes = %v, want %v", invalid, tt.wantInvalid)
+				}
+			}
+
+			wantParent := "G"
+			if tt.wantErr {
+				wantParent = "X"
+				if _, exists := ds.distributors["X"]; !exists {
+					t.Error("X was removed despite the error")
+				}
+			} else if !reflect.DeepEqual(removed, []string{"X"}) {
+				t.Errorf("removed = %v, want [X]", removed)
+			}
+			c := ds.distributors["C"]
+			if c.Parent == nil || c.Parent.Name != wantParent {
+				t.Errorf("C's parent is %v, want %s", c.Parent, wantParent)
+			}
+			for name, want := range tt.wantIncludes {
+				if got := sortedKeys(ds.distributors[name].Includes); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s includes %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveDistributorWithChildren(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"A", "B", "C"}, include("A", "IN"))
+	if _, _, err := ds.RemoveDistributor("B", false, false, false); err == nil {
+		t.Error("removed a distributor with children without cascade or reparent")
+	}
+	if _, _, err := ds.RemoveDistributor("B", true, true, false); err == nil {
+		t.Error("cascade and reparent were combined")
+	}
+	removed, _, err := ds.RemoveDistributor("A", true, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"A", "B", "C"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("cascade removed %v, want %v", removed, want)
+	}
+}
@@ -0,0 +1,70 @@
+package distribution
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RestoreRecords puts distributors back to the given persisted records,
+// keyed by name; a nil record removes the distributor. Restored distributors
+// keep their place in the hierarchy: their children stay attached and their
+// parent is taken from the record. Either every record is restored or, if
+// the result would leave a parent missing or create a cycle, none is.
+func (ds *DistributionSystem) RestoreRecords(records map[string]*DistributorData) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	staged := ds.Clone()
+	for _, name := range sortedKeys(records) {
+		record := records[name]
+		existing, exists := staged.distributors[name]
+		if record == nil {
+			delete(staged.distributors, name)
+			delete(staged.unresolvedParents, name)
+			continue
+		}
+		restored := staged.distributorFromData(name, *record)
+		if exists {
+			// Children point at the existing distributor, so it is updated
+			// in place
+			restored.Parent = existing.Parent
+			*existing = *restored
+		} else {
+			staged.distributors[name] = restored
+		}
+	}
+
+	for _, name := range sortedKeys(records) {
+		record := records[name]
+		if record == nil {
+			continue
+		}
+		dist := staged.distributors[name]
+		dist.Parent = nil
+		delete(staged.unresolvedParents, name)
+		if record.ParentName == "" {
+			continue
+		}
+		parent, exists := staged.distributors[record.ParentName]
+		if !exists {
+			return fmt.Errorf("cannot restore %s: parent distributor %s does not exist", name, record.ParentName)
+		}
+		dist.Parent = parent
+	}
+	for _, name := range staged.distributorNames() {
+		if parent := staged.distributors[name].Parent; parent != nil && staged.distributors[parent.Name] != parent {
+			return fmt.Errorf("cannot remove %s: distributor %s still has it as parent", parent.Name, name)
+		}
+	}
+	if cycles := staged.parentCycles(); len(cycles) > 0 {
+		chains := make([]string, len(cycles))
+		for i, cycle := range cycles {
+			chains[i] = strings.Join(cycle, " -> ")
+		}
+		return fmt.Errorf("restoring would create a parent cycle: %s", strings.Join(chains, "; "))
+	}
+
+	ds.distributors = staged.distributors
+	ds.unresolvedParents = staged.unresolvedParents
+	return nil
+}
@@ -0,0 +1,113 @@
+package distribution
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PermissionChange is one proposed edit to a distributor's rules, as read
+// from a changes file by LoadChanges
+type PermissionChange struct {
+	Distributor    string   `json:"distributor" yaml:"distributor"`
+	AddIncludes    []string `json:"addIncludes,omitempty" yaml:"addIncludes,omitempty"`
+	AddExcludes    []string `json:"addExcludes,omitempty" yaml:"addExcludes,omitempty"`
+	RemoveIncludes []string `json:"removeIncludes,omitempty" yaml:"removeIncludes,omitempty"`
+	RemoveExcludes []string `json:"removeExcludes,omitempty" yaml:"removeExcludes,omitempty"`
+}
+
+// LoadChanges reads a file of proposed permission changes, as YAML if it has
+// a .yaml or .yml extension and as JSON otherwise. The document lists the
+// changes under "changes".
+func LoadChanges(filename string) ([]PermissionChange, error) {
+	var definition struct {
+		Changes []PermissionChange `json:"changes" yaml:"changes"`
+	}
+	if err := decodeFile(filename, &definition); err != nil {
+		return nil, err
+	}
+	if len(definition.Changes) == 0 {
+		return nil, errors.New("no changes defined")
+	}
+	return definition.Changes, nil
+}
+
+// PlanChanges turns proposed changes into plan steps, in file order. Within
+// one change excludes are lifted and includes removed before includes are
+// added, and excludes are added last, so an include is never checked
+// against rules the same change takes away. Region patterns such as *-TN-IN
+// stand for the regions they match.
+func (ds *DistributionSystem) PlanChanges(changes []PermissionChange) ([]PlanStep, error) {
+	var plan []PlanStep
+	for i, change := range changes {
+		if _, exists := ds.distributors[change.Distributor]; !exists {
+			return nil, fmt.Errorf("change %d: distributor %s does not exist", i+1, change.Distributor)
+		}
+		for _, set := range []struct {
+			action    string
+			isInclude bool
+			regions   []string
+		}{
+			{"remove", false, change.RemoveExcludes},
+			{"remove", true, change.RemoveIncludes},
+			{"add", true, change.AddIncludes},
+			{"add", false, change.AddExcludes},
+		} {
+			regions, err := ds.expandPatterns(set.regions)
+			if err != nil {
+				return nil, fmt.Errorf("change %d (%s): %w", i+1, change.Distributor, err)
+			}
+			for _, region := range regions {
+				plan = append(plan, PlanStep{Action: set.action, Distributor: change.Distributor, Region: region, IsInclude: set.isInclude})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// Simulate applies plan to a copy of the system and reports how the
+// effective regions of every distributor it touches, and of all their
+// descendants, would change. The system itself is left as it is.
+func (ds *DistributionSystem) Simulate(plan []PlanStep) ([]CoverageChange, error) {
+	trial := ds.Clone()
+	if err := trial.applySteps(plan); err != nil {
+		return nil, err
+	}
+
+	affected := make(map[string]bool)
+	for _, step := range plan {
+		if affected[step.Distributor] {
+			continue
+		}
+		affected[step.Distributor] = true
+		descendants, err := trial.Descendants(step.Distributor)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range descendants {
+			affected[name] = true
+		}
+	}
+	return trial.coverageChangesOf(ds, sortedKeys(affected)), nil
+}
+
+// DescendantLosses reports the regions that descendants of the distributors
+// changed by plan would lose if it were applied, such as when a parent adds
+// an exclude its children relied on. The changed distributors themselves
+// and descendants that lose nothing are left out.
+func (ds *DistributionSystem) DescendantLosses(plan []PlanStep) ([]CoverageChange, error) {
+	changed := make(map[string]bool)
+	for _, step := range plan {
+		changed[step.Distributor] = true
+	}
+	coverage, err := ds.Simulate(plan)
+	if err != nil {
+		return nil, err
+	}
+	var losses []CoverageChange
+	for _, change := range coverage {
+		if !changed[change.Distributor] && len(change.Lost) > 0 {
+			losses = append(losses, CoverageChange{Distributor: change.Distributor, Lost: change.Lost})
+		}
+	}
+	return losses, nil
+}
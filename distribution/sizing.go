@@ -0,0 +1,95 @@
+package distribution
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// Footprint is the approximate heap memory taken by the loaded data, measured
+// as the growth in live heap after loading each part
+type Footprint struct {
+	LocationBytes    uint64
+	DistributorBytes uint64
+	LocationKeys     int
+	Cities           int
+	Distributors     int
+	Rules            int
+}
+
+// MeasureFootprint loads the locations CSVs, read with options, and the state
+// saved in store into a fresh system, recording how much the live heap grows with each.
+// The numbers are approximate: they include allocator overhead and any
+// garbage that survived the forced collection.
+func MeasureFootprint(csvFiles []string, hasHeader bool, options LoadOptions, store Store) (Footprint, error) {
+	var footprint Footprint
+
+	base := liveHeap()
+	system := NewDistributionSystem()
+	if err := system.SetLoadOptions(options); err != nil {
+		return footprint, err
+	}
+	if _, err := system.LoadLocationFiles(csvFiles, hasHeader); err != nil {
+		return footprint, fmt.Errorf("loading location data: %w", err)
+	}
+	afterLocations := liveHeap()
+	if err := system.Load(store); err != nil {
+		return footprint, fmt.Errorf("loading distributor data: %w", err)
+	}
+	afterState := liveHeap()
+
+	footprint.LocationBytes = growth(base, afterLocations)
+	footprint.DistributorBytes = growth(afterLocations, afterState)
+	footprint.LocationKeys = system.LocationCount()
+	footprint.Cities = len(system.cities())
+	footprint.Distributors = len(system.distributors)
+	for _, dist := range system.distributors {
+		footprint.Rules += len(dist.Includes) + len(dist.Excludes)
+	}
+	runtime.KeepAlive(system)
+	return footprint, nil
+}
+
+// liveHeap returns the bytes in live heap objects after a full collection
+func liveHeap() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+func growth(before, after uint64) uint64 {
+	if after < before {
+		return 0
+	}
+	return after - before
+}
+
+// WriteFootprint prints the footprint with per-item averages
+func WriteFootprint(w io.Writer, footprint Footprint) {
+	fmt.Fprintf(w, "Locations:    %s for %d keys (%d cities)", formatBytes(footprint.LocationBytes), footprint.LocationKeys, footprint.Cities)
+	if footprint.Cities > 0 {
+		fmt.Fprintf(w, ", about %s per city", formatBytes(footprint.LocationBytes/uint64(footprint.Cities)))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Distributors: %s for %d distributors with %d rules", formatBytes(footprint.DistributorBytes), footprint.Distributors, footprint.Rules)
+	if footprint.Rules > 0 {
+		fmt.Fprintf(w, ", about %s per rule", formatBytes(footprint.DistributorBytes/uint64(footprint.Rules)))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Total:        %s\n", formatBytes(footprint.LocationBytes+footprint.DistributorBytes))
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,349 @@
+// Package sqlitestore keeps the state of a distribution system in an SQLite
+// database, with a row per distributor, per rule and per location, for
+// deployments that outgrow a state file. It needs cgo.
+package sqlitestore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"movie-distrbution/distribution"
+)
+
+// schemaVersion is stored as the database's user_version once every one of
+// migrations has been applied
+const schemaVersion = 2
+
+// migrations brings a database whose user_version is i to version i+1
+var migrations = []string{
+	schema,
+	`ALTER TABLE permissions ADD COLUMN priority INTEGER NOT NULL DEFAULT 0`,
+}
+
+// schema creates the tables of version 1
+const schema = `
+CREATE TABLE IF NOT EXISTS settings (
+	name  TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS distributors (
+	name         TEXT PRIMARY KEY,
+	parent       TEXT NOT NULL DEFAULT '',
+	max_children INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS metadata (
+	distributor TEXT NOT NULL REFERENCES distributors (name) ON DELETE CASCADE,
+	name        TEXT NOT NULL,
+	value       TEXT NOT NULL,
+	PRIMARY KEY (distributor, name)
+);
+CREATE TABLE IF NOT EXISTS permissions (
+	distributor TEXT NOT NULL REFERENCES distributors (name) ON DELETE CASCADE,
+	region      TEXT NOT NULL,
+	include     INTEGER NOT NULL,
+	quarantined INTEGER NOT NULL DEFAULT 0,
+	predicate   TEXT NOT NULL DEFAULT '',
+	valid_from  TEXT,
+	valid_until TEXT,
+	PRIMARY KEY (distributor, region, include, quarantined)
+);
+CREATE TABLE IF NOT EXISTS locations (
+	country_code  TEXT NOT NULL,
+	province_code TEXT NOT NULL,
+	city_code     TEXT NOT NULL,
+	country_name  TEXT NOT NULL,
+	province_name TEXT NOT NULL,
+	city_name     TEXT NOT NULL,
+	PRIMARY KEY (country_code, province_code, city_code)
+);
+`
+
+// Store is a distribution.LocationStore backed by an SQLite database. Each
+// save replaces the stored state in one transaction, so readers see either
+// the old state or the new one.
+type Store struct {
+	db   *sql.DB
+	path string
+}
+
+// Open opens the database at path, creating it and its tables if needed
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{db: db, path: path}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return store, nil
+}
+
+// migrate creates the tables of a new database, brings one written by an
+// older version up to date and refuses one written by a newer version
+func (s *Store) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	switch {
+	case version == schemaVersion:
+		return nil
+	case version > schemaVersion:
+		return fmt.Errorf("schema version %d is newer than the supported %d", version, schemaVersion)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, step := range migrations[version:] {
+		if _, err := tx.Exec(step); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) String() string {
+	return "sqlite:" + s.path
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Load reads the state in one read transaction
+func (s *Store) Load() (distribution.State, error) {
+	state := distribution.State{Distributors: make(map[string]distribution.DistributorData)}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return state, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("SELECT value FROM settings WHERE name = 'strategy'").Scan(&state.Strategy)
+	if err != nil && err != sql.ErrNoRows {
+		return state, err
+	}
+
+	rows, err := tx.Query("SELECT name, parent, max_children FROM distributors")
+	if err != nil {
+		return state, err
+	}
+	for rows.Next() {
+		var data distribution.DistributorData
+		if err := rows.Scan(&data.Name, &data.ParentName, &data.MaxChildren); err != nil {
+			rows.Close()
+			return state, err
+		}
+		state.Distributors[data.Name] = data
+	}
+	if err := closeRows(rows); err != nil {
+		return state, err
+	}
+
+	rows, err = tx.Query("SELECT distributor, name, value FROM metadata")
+	if err != nil {
+		return state, err
+	}
+	for rows.Next() {
+		var distributor, name, value string
+		if err := rows.Scan(&distributor, &name, &value); err != nil {
+			rows.Close()
+			return state, err
+		}
+		data := state.Distributors[distributor]
+		if data.Metadata == nil {
+			data.Metadata = make(map[string]string)
+		}
+		data.Metadata[name] = value
+		state.Distributors[distributor] = data
+	}
+	if err := closeRows(rows); err != nil {
+		return state, err
+	}
+
+	rows, err = tx.Query("SELECT distributor, region, include, quarantined, predicate, valid_from, valid_until, priority FROM permissions")
+	if err != nil {
+		return state, err
+	}
+	for rows.Next() {
+		var distributor string
+		var record distribution.RuleRecord
+		var from, until sql.NullString
+		if err := rows.Scan(&distributor, &record.Region, &record.IsInclude, &record.Quarantined, &record.When, &from, &until, &record.Priority); err != nil {
+			rows.Close()
+			return state, err
+		}
+		if record.Validity.ValidFrom, err = parseBound(from); err != nil {
+			rows.Close()
+			return state, err
+		}
+		if record.Validity.ValidUntil, err = parseBound(until); err != nil {
+			rows.Close()
+			return state, err
+		}
+		data := state.Distributors[distributor]
+		data.AddRuleRecord(record)
+		state.Distributors[distributor] = data
+	}
+	if err := closeRows(rows); err != nil {
+		return state, err
+	}
+	return state, nil
+}
+
+// Save replaces the stored state with state in one transaction
+func (s *Store) Save(state distribution.State) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Deleting the distributors cascades to their metadata and rules
+	if _, err := tx.Exec("DELETE FROM distributors"); err != nil {
+		return err
+	}
+	if state.Strategy == "" {
+		_, err = tx.Exec("DELETE FROM settings WHERE name = 'strategy'")
+	} else {
+		_, err = tx.Exec("INSERT OR REPLACE INTO settings (name, value) VALUES ('strategy', ?)", state.Strategy)
+	}
+	if err != nil {
+		return err
+	}
+
+	insertDistributor, err := tx.Prepare("INSERT INTO distributors (name, parent, max_children) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertDistributor.Close()
+	insertMetadata, err := tx.Prepare("INSERT INTO metadata (distributor, name, value) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertMetadata.Close()
+	insertRule, err := tx.Prepare("INSERT INTO permissions (distributor, region, include, quarantined, predicate, valid_from, valid_until, priority) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertRule.Close()
+
+	for name, data := range state.Distributors {
+		if _, err := insertDistributor.Exec(name, data.ParentName, data.MaxChildren); err != nil {
+			return fmt.Errorf("distributor %s: %w", name, err)
+		}
+		for key, value := range data.Metadata {
+			if _, err := insertMetadata.Exec(name, key, value); err != nil {
+				return fmt.Errorf("distributor %s: %w", name, err)
+			}
+		}
+		for _, record := range data.RuleRecords() {
+			validity := record.Validity
+			if _, err := insertRule.Exec(name, record.Region, record.IsInclude, record.Quarantined, record.When,
+				formatBound(validity.ValidFrom), formatBound(validity.ValidUntil), record.Priority); err != nil {
+				return fmt.Errorf("distributor %s: %w", name, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadLocations returns the stored locations sorted by country, province and
+// city code
+func (s *Store) LoadLocations() ([]distribution.Location, error) {
+	rows, err := s.db.Query(`SELECT country_code, province_code, city_code, country_name, province_name, city_name
+		FROM locations ORDER BY country_code, province_code, city_code`)
+	if err != nil {
+		return nil, err
+	}
+	var locations []distribution.Location
+	for rows.Next() {
+		var l distribution.Location
+		if err := rows.Scan(&l.CountryCode, &l.ProvinceCode, &l.CityCode, &l.CountryName, &l.ProvinceName, &l.CityName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+	return locations, closeRows(rows)
+}
+
+// SaveLocations replaces the stored locations in one transaction. Locations
+// identical to those stored, as recognized by their fingerprint, are not
+// written again.
+func (s *Store) SaveLocations(locations []distribution.Location) error {
+	fingerprint := distribution.LocationsFingerprint(locations)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stored string
+	err = tx.QueryRow("SELECT value FROM settings WHERE name = 'locations'").Scan(&stored)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if stored == fingerprint {
+		return nil
+	}
+
+	if _, err := tx.Exec("DELETE FROM locations"); err != nil {
+		return err
+	}
+	insert, err := tx.Prepare(`INSERT OR REPLACE INTO locations
+		(country_code, province_code, city_code, country_name, province_name, city_name) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	for _, l := range locations {
+		if _, err := insert.Exec(l.CountryCode, l.ProvinceCode, l.CityCode, l.CountryName, l.ProvinceName, l.CityName); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO settings (name, value) VALUES ('locations', ?)", fingerprint); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// closeRows closes rows and returns any error met while iterating them
+func closeRows(rows *sql.Rows) error {
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	return rows.Close()
+}
+
+// formatBound stores a validity bound as RFC 3339 text, keeping its offset;
+// a missing bound is NULL
+func formatBound(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseBound(text sql.NullString) (*time.Time, error) {
+	if !text.Valid {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, text.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
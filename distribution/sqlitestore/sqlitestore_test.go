@@ -0,0 +1,242 @@
+package sqlitestore
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"movie-distrbution/distribution"
+)
+
+const testLocations = "../testdata/locations.csv"
+
+func openTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "state.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, path
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.FixedZone("", 5*3600+1800))
+	until := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	want := distribution.State{
+		Strategy: "specificity",
+		Distributors: map[string]distribution.DistributorData{
+			"P": {
+				Name:        "P",
+				Includes:    map[string]bool{"IN": true, "US": true},
+				Excludes:    map[string]bool{"KA-IN": true},
+				Metadata:    map[string]string{"tier": "premium"},
+				MaxChildren: 2,
+				ExcludeValidity: map[string]distribution.Validity{
+					"KA-IN": {ValidFrom: &from},
+				},
+				ExcludePriority: map[string]int{"KA-IN": -1},
+			},
+			"C": {
+				Name:              "C",
+				ParentName:        "P",
+				Includes:          map[string]bool{"TN-IN": true},
+				Excludes:          map[string]bool{"MDU-TN-IN": true},
+				Quarantined:       map[string]bool{"KA-IN": true},
+				IncludeConditions: map[string]string{"TN-IN": "tier=premium"},
+				ExcludeConditions: map[string]string{"MDU-TN-IN": "!tier"},
+				IncludeValidity: map[string]distribution.Validity{
+					"TN-IN": {ValidFrom: &from, ValidUntil: &until},
+				},
+				IncludePriority: map[string]int{"TN-IN": 5},
+			},
+			// A parent that is missing stays unresolved rather than lost
+			"O": {Name: "O", ParentName: "GONE"},
+		},
+	}
+
+	store, path := openTestStore(t)
+	if err := store.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	got, err := reopened.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSaveReplaces(t *testing.T) {
+	store, _ := openTestStore(t)
+	first := distribution.State{
+		Strategy: "specificity",
+		Distributors: map[string]distribution.DistributorData{
+			"A": {Name: "A", Includes: map[string]bool{"IN": true}, Metadata: map[string]string{"tier": "basic"}},
+			"B": {Name: "B", Excludes: map[string]bool{"US": true}},
+		},
+	}
+	if err := store.Save(first); err != nil {
+		t.Fatal(err)
+	}
+	second := distribution.State{
+		Distributors: map[string]distribution.DistributorData{
+			"A": {Name: "A", Excludes: map[string]bool{"KA-IN": true}},
+		},
+	}
+	if err := store.Save(second); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, second) {
+		t.Errorf("Load() = %+v, want %+v", got, second)
+	}
+}
+
+func TestLoadEmpty(t *testing.T) {
+	store, _ := openTestStore(t)
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Strategy != "" || len(got.Distributors) != 0 {
+		t.Errorf("Load() of a new database = %+v, want an empty state", got)
+	}
+}
+
+func TestMigrateVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range []string{
+		schema,
+		"PRAGMA user_version = 1",
+		"INSERT INTO distributors (name) VALUES ('P')",
+		"INSERT INTO permissions (distributor, region, include) VALUES ('P', 'IN', 1)",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := distribution.State{
+		Distributors: map[string]distribution.DistributorData{
+			"P": {Name: "P", Includes: map[string]bool{"IN": true}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() of a version 1 database = %+v, want %+v", got, want)
+	}
+	var version int
+	if err := store.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil || version != schemaVersion {
+		t.Errorf("user_version after Open = %d, %v; want %d", version, err, schemaVersion)
+	}
+}
+
+func TestSystemRoundTrip(t *testing.T) {
+	ds := distribution.NewDistributionSystem()
+	if err := ds.LoadLocationData(testLocations, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.AddDistributor("P", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.AddDistributor("C", "P"); err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []error{
+		ds.AddPermission("P", "IN", true),
+		ds.AddPermission("P", "KA-IN", false),
+		ds.SetMetadata("C", "tier", "premium"),
+		ds.AddConditionalPermission("C", "TN-IN", true, "tier=premium"),
+	} {
+		if step != nil {
+			t.Fatal(step)
+		}
+	}
+
+	store, _ := openTestStore(t)
+	if err := ds.Save(store); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveLocations(ds.LocationRecords()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The locations come from the database too, not the CSV
+	locations, err := store.LoadLocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := distribution.NewDistributionSystem()
+	loaded.AddLocations(locations)
+	if err := loaded.Load(store); err != nil {
+		t.Fatal(err)
+	}
+	for region, want := range map[string]bool{"CENAI-TN-IN": true, "BLR-KA-IN": false, "IN": false, "US": false} {
+		got, err := loaded.CheckPermission("C", region)
+		if err != nil {
+			t.Fatalf("CheckPermission(C, %s): %v", region, err)
+		}
+		if got != want {
+			t.Errorf("CheckPermission(C, %s) = %v, want %v", region, got, want)
+		}
+	}
+}
+
+func TestLocationsRoundTrip(t *testing.T) {
+	ds := distribution.NewDistributionSystem()
+	if err := ds.LoadLocationData(testLocations, true); err != nil {
+		t.Fatal(err)
+	}
+	want := ds.LocationRecords()
+
+	store, _ := openTestStore(t)
+	if err := store.SaveLocations(want); err != nil {
+		t.Fatal(err)
+	}
+	// Saving the same locations again leaves them as they are
+	if err := store.SaveLocations(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.LoadLocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadLocations() = %+v, want %+v", got, want)
+	}
+
+	if err := store.SaveLocations(want[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.LoadLocations(); err != nil || len(got) != 1 {
+		t.Errorf("LoadLocations() after saving one location = %d locations, %v; want 1", len(got), err)
+	}
+}
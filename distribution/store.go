@@ -0,0 +1,202 @@
+package distribution
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Store persists the distributors and settings of a system. FileStore keeps
+// them in a state file; the sqlitestore, boltstore and pgstore packages keep
+// them in a database.
+type Store interface {
+	// Load returns the saved state, which is empty if nothing was saved yet
+	Load() (State, error)
+	// Save replaces the saved state with state
+	Save(state State) error
+	// Close releases the store
+	Close() error
+}
+
+// LocationStore is a Store that can also keep the location data, so that it
+// holds everything a system is loaded from
+type LocationStore interface {
+	Store
+	// LoadLocations returns the saved locations, if any
+	LoadLocations() ([]Location, error)
+	// SaveLocations replaces the saved locations with locations
+	SaveLocations(locations []Location) error
+}
+
+// State is what a Store saves: the resolution strategy, empty for the
+// default, and every distributor keyed by name. A state file written with
+// the default strategy holds just the distributor map.
+type State struct {
+	Strategy     string                     `yaml:"strategy"`
+	Distributors map[string]DistributorData `yaml:"distributors"`
+}
+
+// Load replaces the distributors with the state saved in store. Like
+// LoadState it is not safe for concurrent use.
+func (ds *DistributionSystem) Load(store Store) error {
+	state, err := store.Load()
+	if err != nil {
+		return err
+	}
+	if state.Strategy != "" {
+		if err := ds.SetStrategy(state.Strategy); err != nil {
+			return err
+		}
+	}
+	distributorsData := state.Distributors
+
+	// First pass: create all distributors
+	for name, data := range distributorsData {
+		ds.distributors[name] = ds.distributorFromData(name, data)
+	}
+
+	// Second pass: set up parent relationships
+	for name, data := range distributorsData {
+		if data.ParentName != "" {
+			if parent, exists := ds.distributors[data.ParentName]; exists {
+				ds.distributors[name].Parent = parent
+			} else {
+				ds.unresolvedParents[name] = data.ParentName
+			}
+		}
+	}
+
+	// A cycle would make every permission check in it recurse forever
+	if cycles := ds.parentCycles(); len(cycles) > 0 {
+		chains := make([]string, len(cycles))
+		for i, cycle := range cycles {
+			chains[i] = strings.Join(cycle, " -> ")
+		}
+		return fmt.Errorf("parent cycle: %s", strings.Join(chains, "; "))
+	}
+	return nil
+}
+
+// Save writes the distributors and the strategy to store
+func (ds *DistributionSystem) Save(store Store) error {
+	// The records share their rule maps with the distributors, so changes
+	// wait until they are written
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	state := State{Distributors: ds.distributorData()}
+	if strategy := ds.strategyName(); strategy != defaultStrategy {
+		state.Strategy = strategy
+	}
+	return store.Save(state)
+}
+
+// RuleRecord is one include or exclude of a distributor in the flat form
+// database stores keep, with the predicate and validity gating it and the
+// priority it is ranked by
+type RuleRecord struct {
+	Region    string
+	IsInclude bool
+	// Quarantined marks an include set aside by QuarantineViolations
+	// rather than in force
+	Quarantined bool
+	When        string
+	Validity    Validity
+	Priority    int
+}
+
+// RuleRecords flattens the distributor's includes, quarantined includes
+// and excludes, in that order and each sorted by region
+func (d DistributorData) RuleRecords() []RuleRecord {
+	var records []RuleRecord
+	sets := []struct {
+		rules                   map[string]bool
+		isInclude, isQuarantine bool
+	}{{d.Includes, true, false}, {d.Quarantined, true, true}, {d.Excludes, false, false}}
+	for _, set := range sets {
+		conditions, validity, priority := d.ExcludeConditions, d.ExcludeValidity, d.ExcludePriority
+		if set.isInclude {
+			conditions, validity, priority = d.IncludeConditions, d.IncludeValidity, d.IncludePriority
+		}
+		for _, region := range sortedKeys(set.rules) {
+			if !set.rules[region] {
+				continue
+			}
+			records = append(records, RuleRecord{
+				Region:      region,
+				IsInclude:   set.isInclude,
+				Quarantined: set.isQuarantine,
+				When:        conditions[region],
+				Validity:    validity[region],
+				Priority:    priority[region],
+			})
+		}
+	}
+	return records
+}
+
+// AddRuleRecord adds a rule flattened by RuleRecords back to the
+// distributor's maps, creating them as needed
+func (d *DistributorData) AddRuleRecord(record RuleRecord) {
+	rules, conditions, validity, priority := &d.Excludes, &d.ExcludeConditions, &d.ExcludeValidity, &d.ExcludePriority
+	if record.IsInclude {
+		rules, conditions, validity, priority = &d.Includes, &d.IncludeConditions, &d.IncludeValidity, &d.IncludePriority
+		if record.Quarantined {
+			rules = &d.Quarantined
+		}
+	}
+	if *rules == nil {
+		*rules = make(map[string]bool)
+	}
+	(*rules)[record.Region] = true
+	if record.When != "" {
+		if *conditions == nil {
+			*conditions = make(map[string]string)
+		}
+		(*conditions)[record.Region] = record.When
+	}
+	if !record.Validity.IsZero() {
+		if *validity == nil {
+			*validity = make(map[string]Validity)
+		}
+		(*validity)[record.Region] = record.Validity
+	}
+	if record.Priority != 0 {
+		if *priority == nil {
+			*priority = make(map[string]int)
+		}
+		(*priority)[record.Region] = record.Priority
+	}
+}
+
+// LocationRecords returns every indexed city, sorted by country, province
+// and city code, for keeping the locations in a LocationStore. Locations
+// loaded at a coarser -level than cities are not included.
+func (ds *DistributionSystem) LocationRecords() []Location {
+	cities := ds.cities()
+	sortLocations(cities)
+	records := make([]Location, len(cities))
+	for i, location := range cities {
+		records[i] = *location
+	}
+	return records
+}
+
+// AddLocations indexes locations as if they were read from a locations CSV
+func (ds *DistributionSystem) AddLocations(locations []Location) {
+	for i := range locations {
+		location := locations[i]
+		ds.canonicalizeLocation(&location)
+		ds.addLocation(&location)
+	}
+}
+
+// LocationsFingerprint hashes locations in order, so a LocationStore can
+// tell whether the locations it was given are the ones it holds already
+func LocationsFingerprint(locations []Location) string {
+	hash := sha256.New()
+	for _, l := range locations {
+		fmt.Fprintf(hash, "%q,%q,%q,%q,%q,%q\n", l.CountryCode, l.ProvinceCode, l.CityCode, l.CountryName, l.ProvinceName, l.CityName)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,176 @@
+package distribution
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResolutionStrategy decides which of a distributor's own rules governs a
+// region when several of them match. HasPermission then denies on an
+// exclude, and on an include defers to the parent chain.
+type ResolutionStrategy interface {
+	// Name identifies the strategy in flags and state files
+	Name() string
+
+	// Decide returns the deciding rule among d's applicable rules matching
+	// region, whether it is an include, and false if no rule matches
+	Decide(d *Distributor, region string) (rule string, isInclude bool, matched bool)
+}
+
+// defaultStrategy is used when neither the state file nor SetStrategy picks one
+const defaultStrategy = "excludes-win"
+
+// strategies lists the available resolution strategies by name
+var strategies = map[string]ResolutionStrategy{
+	"excludes-win": excludesWin{},
+	"specificity":  specificityWins{},
+	"priority":     priorityWins{},
+}
+
+// StrategyNames returns the names of the available strategies, sorted
+func StrategyNames() []string {
+	return sortedKeys(strategies)
+}
+
+// lookupStrategy returns the strategy with the given name; an empty name
+// selects the default
+func lookupStrategy(name string) (ResolutionStrategy, error) {
+	if name == "" {
+		name = defaultStrategy
+	}
+	strategy, exists := strategies[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown resolution strategy %q (available: %s)", name, strings.Join(StrategyNames(), ", "))
+	}
+	return strategy, nil
+}
+
+// excludesWin is the original semantics: any matching exclude denies,
+// regardless of how specific a matching include is
+type excludesWin struct{}
+
+func (excludesWin) Name() string { return "excludes-win" }
+
+func (excludesWin) Decide(d *Distributor, region string) (string, bool, bool) {
+	if rule := d.firstMatch(false, region); rule != "" {
+		return rule, false, true
+	}
+	if rule := d.firstMatch(true, region); rule != "" {
+		return rule, true, true
+	}
+	return "", false, false
+}
+
+// specificityWins lets the most specific matching rule decide, so a city
+// include can carve an exception out of a province exclude and vice versa.
+// An include and exclude of the same region resolve to the exclude.
+type specificityWins struct{}
+
+func (specificityWins) Name() string { return "specificity" }
+
+func (specificityWins) Decide(d *Distributor, region string) (string, bool, bool) {
+	exclude := d.mostSpecificMatch(false, region)
+	include := d.mostSpecificMatch(true, region)
+	switch {
+	case include == "" && exclude == "":
+		return "", false, false
+	case include == "" || regionLevel(exclude) >= regionLevel(include):
+		return exclude, false, true
+	default:
+		return include, true, true
+	}
+}
+
+// priorityWins lets the matching rule with the highest priority decide, as
+// set with SetRulePriority, so any rule can be made to override the others
+// whatever its kind or level. Rules of equal priority resolve as under
+// specificity, which is what priorityWins reduces to when no rule has one.
+type priorityWins struct{}
+
+func (priorityWins) Name() string { return "priority" }
+
+func (priorityWins) Decide(d *Distributor, region string) (string, bool, bool) {
+	best, bestInclude, matched := "", false, false
+	// Excludes are ranked first so that an include only takes over from an
+	// exclude of the same region and priority by being strictly ahead
+	for _, isInclude := range []bool{false, true} {
+		for _, rule := range d.matchingRules(isInclude, region) {
+			if matched {
+				priority, bestPriority := d.rulePriority(isInclude, rule), d.rulePriority(bestInclude, best)
+				if priority < bestPriority || (priority == bestPriority && regionLevel(rule) <= regionLevel(best)) {
+					continue
+				}
+			}
+			best, bestInclude, matched = rule, isInclude, true
+		}
+	}
+	return best, bestInclude, matched
+}
+
+// firstMatch returns the lexically smallest applicable include or exclude
+// that contains region, or "" if none does
+func (d *Distributor) firstMatch(isInclude bool, region string) string {
+	best := ""
+	for _, rule := range d.matchingRules(isInclude, region) {
+		if best == "" || rule < best {
+			best = rule
+		}
+	}
+	return best
+}
+
+// mostSpecificMatch returns the applicable include or exclude that contains
+// region at the finest level, or "" if none does
+func (d *Distributor) mostSpecificMatch(isInclude bool, region string) string {
+	matches := d.matchingRules(isInclude, region)
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[len(matches)-1]
+}
+
+// regionLevel returns 1 for a country, 2 for a province and 3 for a city code
+func regionLevel(region string) int {
+	if region == "" {
+		return 0
+	}
+	return strings.Count(region, "-") + 1
+}
+
+// resolution returns the strategy the distributor resolves its rules with
+func (d *Distributor) resolution() ResolutionStrategy {
+	if d.strategy == nil {
+		return strategies[defaultStrategy]
+	}
+	return d.strategy
+}
+
+// SetStrategy switches every distributor, and those added later, to the named
+// resolution strategy
+func (ds *DistributionSystem) SetStrategy(name string) error {
+	strategy, err := lookupStrategy(name)
+	if err != nil {
+		return err
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.strategy = strategy
+	for _, dist := range ds.distributors {
+		dist.strategy = strategy
+	}
+	return nil
+}
+
+// Strategy returns the name of the resolution strategy in use
+func (ds *DistributionSystem) Strategy() string {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.strategyName()
+}
+
+func (ds *DistributionSystem) strategyName() string {
+	if ds.strategy == nil {
+		return defaultStrategy
+	}
+	return ds.strategy.Name()
+}
@@ -0,0 +1,271 @@
+package distribution
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStrategies(t *testing.T) {
+	tests := []struct {
+		name  string
+		chain []string
+		rules []testRule
+		// want maps each strategy to the expected result per region for
+		// the last distributor of the chain
+		want map[string]map[string]bool
+	}{
+		{
+			name:  "city include inside an excluded province",
+			chain: []string{"D"},
+			rules: []testRule{include("D", "IN"), exclude("D", "KA-IN"), include("D", "BLR-KA-IN")},
+			want: map[string]map[string]bool{
+				"excludes-win": {"BLR-KA-IN": false, "MYS-KA-IN": false, "KA-IN": false, "CENAI-TN-IN": true, "TN-IN": true, "IN": false, "US": false},
+				"specificity":  {"BLR-KA-IN": true, "MYS-KA-IN": false, "KA-IN": false, "CENAI-TN-IN": true, "TN-IN": true, "IN": false, "US": false},
+				"priority":     {"BLR-KA-IN": true, "MYS-KA-IN": false, "KA-IN": false, "CENAI-TN-IN": true, "TN-IN": true, "IN": false, "US": false},
+			},
+		},
+		{
+			name:  "province include inside an excluded country",
+			chain: []string{"D"},
+			rules: []testRule{include("D", "KA-IN"), exclude("D", "IN")},
+			want: map[string]map[string]bool{
+				"excludes-win": {"BLR-KA-IN": false, "KA-IN": false, "TN-IN": false, "IN": false},
+				"specificity":  {"BLR-KA-IN": true, "KA-IN": true, "TN-IN": false, "IN": false},
+				"priority":     {"BLR-KA-IN": true, "KA-IN": true, "TN-IN": false, "IN": false},
+			},
+		},
+		{
+			name:  "same region included and excluded",
+			chain: []string{"D"},
+			rules: []testRule{include("D", "KA-IN"), exclude("D", "KA-IN")},
+			want: map[string]map[string]bool{
+				"excludes-win": {"KA-IN": false, "BLR-KA-IN": false},
+				"specificity":  {"KA-IN": false, "BLR-KA-IN": false},
+				"priority":     {"KA-IN": false, "BLR-KA-IN": false},
+			},
+		},
+		{
+			name:  "parent exclude limits a child's country include",
+			chain: []string{"P", "C"},
+			rules: []testRule{include("P", "IN"), exclude("P", "KA-IN"), include("C", "IN")},
+			want: map[string]map[string]bool{
+				"excludes-win": {"KA-IN": false, "BLR-KA-IN": false, "TN-IN": true, "MDU-TN-IN": true, "IN": false},
+				"specificity":  {"KA-IN": false, "BLR-KA-IN": false, "TN-IN": true, "MDU-TN-IN": true, "IN": false},
+				"priority":     {"KA-IN": false, "BLR-KA-IN": false, "TN-IN": true, "MDU-TN-IN": true, "IN": false},
+			},
+		},
+		{
+			name:  "child exclude inside the parent's include",
+			chain: []string{"P", "C"},
+			rules: []testRule{include("P", "IN"), include("C", "TN-IN"), exclude("C", "MDU-TN-IN")},
+			want: map[string]map[string]bool{
+				"excludes-win": {"TN-IN": false, "CENAI-TN-IN": true, "MDU-TN-IN": false, "KA-IN": false},
+				"specificity":  {"TN-IN": false, "CENAI-TN-IN": true, "MDU-TN-IN": false, "KA-IN": false},
+				"priority":     {"TN-IN": false, "CENAI-TN-IN": true, "MDU-TN-IN": false, "KA-IN": false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, strategy := range StrategyNames() {
+			want, ok := tt.want[strategy]
+			if !ok {
+				t.Fatalf("%s: no expectations for strategy %s", tt.name, strategy)
+			}
+			t.Run(tt.name+"/"+strategy, func(t *testing.T) {
+				ds := newTestSystem(t)
+				if err := ds.SetStrategy(strategy); err != nil {
+					t.Fatal(err)
+				}
+				addChain(t, ds, tt.chain, tt.rules...)
+				assertChecks(t, ds, tt.chain[len(tt.chain)-1], want)
+			})
+		}
+	}
+}
+
+func TestStrategyIncludeOutsideParent(t *testing.T) {
+	// Under either strategy the parent's exclude of KA-IN decides its
+	// cities, so the child cannot include one of them
+	for _, strategy := range StrategyNames() {
+		t.Run(strategy, func(t *testing.T) {
+			ds := newTestSystem(t)
+			if err := ds.SetStrategy(strategy); err != nil {
+				t.Fatal(err)
+			}
+			addChain(t, ds, []string{"P", "C"}, include("P", "IN"), exclude("P", "KA-IN"))
+			if err := ds.AddPermission("C", "BLR-KA-IN", true); err == nil {
+				t.Error("including a city of the parent's excluded province succeeded")
+			}
+		})
+	}
+}
+
+func TestPriorityStrategy(t *testing.T) {
+	type prioritized struct {
+		rule     testRule
+		priority int
+	}
+	tests := []struct {
+		name       string
+		chain      []string
+		rules      []testRule
+		priorities []prioritized
+		want       map[string]bool
+	}{
+		{
+			name:       "province exclude outranks a city include",
+			chain:      []string{"D"},
+			rules:      []testRule{include("D", "IN"), exclude("D", "KA-IN"), include("D", "BLR-KA-IN")},
+			priorities: []prioritized{{exclude("D", "KA-IN"), 10}},
+			want:       map[string]bool{"BLR-KA-IN": false, "MYS-KA-IN": false, "KA-IN": false, "TN-IN": true, "IN": false},
+		},
+		{
+			name:       "country include outranks a province exclude",
+			chain:      []string{"D"},
+			rules:      []testRule{include("D", "IN"), exclude("D", "KA-IN")},
+			priorities: []prioritized{{include("D", "IN"), 5}},
+			want:       map[string]bool{"BLR-KA-IN": true, "KA-IN": true, "IN": true, "US": false},
+		},
+		{
+			name:       "negative priority yields to rules without one",
+			chain:      []string{"D"},
+			rules:      []testRule{include("D", "IN"), exclude("D", "KA-IN")},
+			priorities: []prioritized{{exclude("D", "KA-IN"), -1}},
+			want:       map[string]bool{"BLR-KA-IN": true, "KA-IN": true, "IN": true},
+		},
+		{
+			name:       "include of the same region outranks the exclude",
+			chain:      []string{"D"},
+			rules:      []testRule{include("D", "KA-IN"), exclude("D", "KA-IN")},
+			priorities: []prioritized{{include("D", "KA-IN"), 1}},
+			want:       map[string]bool{"KA-IN": true, "BLR-KA-IN": true, "TN-IN": false},
+		},
+		{
+			name:       "equal priorities resolve by specificity",
+			chain:      []string{"D"},
+			rules:      []testRule{include("D", "IN"), exclude("D", "KA-IN"), include("D", "BLR-KA-IN")},
+			priorities: []prioritized{{include("D", "IN"), 3}, {exclude("D", "KA-IN"), 3}, {include("D", "BLR-KA-IN"), 3}},
+			want:       map[string]bool{"BLR-KA-IN": true, "MYS-KA-IN": false, "TN-IN": true},
+		},
+		{
+			name:       "a child's priority cannot outrank the parent's exclude",
+			chain:      []string{"P", "C"},
+			rules:      []testRule{include("P", "IN"), exclude("P", "KA-IN"), include("C", "IN")},
+			priorities: []prioritized{{include("C", "IN"), 100}},
+			want:       map[string]bool{"BLR-KA-IN": false, "KA-IN": false, "TN-IN": true, "IN": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := newTestSystem(t)
+			if err := ds.SetStrategy("priority"); err != nil {
+				t.Fatal(err)
+			}
+			addChain(t, ds, tt.chain, tt.rules...)
+			for _, p := range tt.priorities {
+				if err := ds.SetRulePriority(p.rule.distributor, p.rule.region, p.rule.isInclude, p.priority); err != nil {
+					t.Fatal(err)
+				}
+			}
+			assertChecks(t, ds, tt.chain[len(tt.chain)-1], tt.want)
+		})
+	}
+}
+
+func TestSetRulePriority(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"D"}, include("D", "IN"), exclude("D", "KA-IN"))
+	if err := ds.SetRulePriority("D", "KA-IN", true, 1); err == nil {
+		t.Error("SetRulePriority succeeded on a rule the distributor does not have")
+	}
+	if err := ds.SetRulePriority("X", "KA-IN", false, 1); err == nil {
+		t.Error("SetRulePriority succeeded on an unknown distributor")
+	}
+
+	if err := ds.SetRulePriority("D", "ka-in", false, 7); err != nil {
+		t.Fatal(err)
+	}
+	if got := ds.distributors["D"].ExcludePriority["KA-IN"]; got != 7 {
+		t.Errorf("ExcludePriority[KA-IN] = %d, want 7", got)
+	}
+	if err := ds.SetRulePriority("D", "KA-IN", false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, stored := ds.distributors["D"].ExcludePriority["KA-IN"]; stored {
+		t.Error("priority 0 was stored rather than cleared")
+	}
+
+	// Removing a rule drops its priority, so adding it back starts at 0
+	if err := ds.SetRulePriority("D", "KA-IN", false, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.RemovePermission("D", "KA-IN", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, stored := ds.distributors["D"].ExcludePriority["KA-IN"]; stored {
+		t.Error("RemovePermission kept the rule's priority")
+	}
+}
+
+func TestPrioritySavedWithState(t *testing.T) {
+	for _, name := range []string{"state.json", "state.yaml", "state.gob"} {
+		t.Run(name, func(t *testing.T) {
+			ds := newTestSystem(t)
+			if err := ds.SetStrategy("priority"); err != nil {
+				t.Fatal(err)
+			}
+			addChain(t, ds, []string{"D"}, include("D", "IN"), exclude("D", "KA-IN"), include("D", "BLR-KA-IN"))
+			if err := ds.SetRulePriority("D", "KA-IN", false, 10); err != nil {
+				t.Fatal(err)
+			}
+			filename := filepath.Join(t.TempDir(), name)
+			if err := ds.SaveState(filename); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := newTestSystem(t)
+			if err := loaded.LoadState(filename); err != nil {
+				t.Fatal(err)
+			}
+			assertChecks(t, loaded, "D", map[string]bool{"BLR-KA-IN": false, "TN-IN": true})
+			assertChecks(t, loaded.Clone(), "D", map[string]bool{"BLR-KA-IN": false, "TN-IN": true})
+		})
+	}
+}
+
+func TestUnknownStrategy(t *testing.T) {
+	ds := newTestSystem(t)
+	if err := ds.SetStrategy("newest-wins"); err == nil {
+		t.Error("SetStrategy accepted an unknown strategy")
+	}
+	if got := ds.Strategy(); got != defaultStrategy {
+		t.Errorf("Strategy() = %s after a failed SetStrategy, want %s", got, defaultStrategy)
+	}
+}
+
+func TestStrategySavedWithState(t *testing.T) {
+	for _, name := range []string{"state.json", "state.yaml", "state.gob"} {
+		t.Run(name, func(t *testing.T) {
+			ds := newTestSystem(t)
+			if err := ds.SetStrategy("specificity"); err != nil {
+				t.Fatal(err)
+			}
+			addChain(t, ds, []string{"D"}, include("D", "IN"), exclude("D", "KA-IN"), include("D", "BLR-KA-IN"))
+			filename := filepath.Join(t.TempDir(), name)
+			if err := ds.SaveState(filename); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := newTestSystem(t)
+			if err := loaded.LoadState(filename); err != nil {
+				t.Fatal(err)
+			}
+			if got := loaded.Strategy(); got != "specificity" {
+				t.Errorf("Strategy() = %s after loading, want specificity", got)
+			}
+			assertChecks(t, loaded, "D", map[string]bool{"BLR-KA-IN": true, "MYS-KA-IN": false})
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package distribution
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// SubtreePolicy computes the union of the regions that a distributor or any
+// of its descendants can serve and flattens it into a single include list.
+// Whole countries and provinces are collapsed into their own codes so the
+// list stays short. It also returns the distributors that were combined.
+func (ds *DistributionSystem) SubtreePolicy(root string) (members, includes []string, err error) {
+	descendants, err := ds.Descendants(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	members = append([]string{root}, descendants...)
+
+	covered := make(map[string]bool)
+	for _, name := range members {
+		regions, err := ds.effectiveRegionSet(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for region := range regions {
+			covered[region] = true
+		}
+	}
+	return members, ds.collapseRegions(covered), nil
+}
+
+// collapseRegions turns a set of city keys into a sorted list of region
+// codes, replacing a country or province by its code when every one of its
+// cities is in the set
+func (ds *DistributionSystem) collapseRegions(cityKeys map[string]bool) []string {
+	cityTotal := make(map[string]int)
+	cityCovered := make(map[string]int)
+	for _, location := range ds.cities() {
+		province := location.ProvinceCode + "-" + location.CountryCode
+		cityTotal[province]++
+		cityTotal[location.CountryCode]++
+		if cityKeys[CityKey(location)] {
+			cityCovered[province]++
+			cityCovered[location.CountryCode]++
+		}
+	}
+
+	regions := make(map[string]bool)
+	for key := range cityKeys {
+		location := ds.cityIndex[key]
+		province := location.ProvinceCode + "-" + location.CountryCode
+		switch {
+		case cityCovered[location.CountryCode] == cityTotal[location.CountryCode]:
+			regions[location.CountryCode] = true
+		case cityCovered[province] == cityTotal[province]:
+			regions[province] = true
+		default:
+			regions[key] = true
+		}
+	}
+	return sortedKeys(regions)
+}
+
+// WriteSubtreePolicy writes the flattened coverage of root's subtree as a
+// policy file with a single entry for root, in the format read by apply
+func (ds *DistributionSystem) WriteSubtreePolicy(w io.Writer, root string) (members, includes []string, err error) {
+	members, includes, err = ds.SubtreePolicy(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	policy := Policy{root: PolicyEntry{Includes: includes, Excludes: []string{}}}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return members, includes, encoder.Encode(policy)
+}
@@ -0,0 +1,91 @@
+package distribution
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// children returns the sorted names of each distributor's direct children,
+// keyed by parent name; roots are listed under ""
+func (ds *DistributionSystem) children() map[string][]string {
+	children := make(map[string][]string)
+	for _, name := range ds.distributorNames() {
+		parent := ""
+		if dist := ds.distributors[name]; dist.Parent != nil {
+			parent = dist.Parent.Name
+		}
+		children[parent] = append(children[parent], name)
+	}
+	return children
+}
+
+// WriteTree renders the distributor hierarchy with each distributor's own
+// include and exclude counts, either as an indented tree ("text" or empty)
+// or as a Graphviz digraph ("dot"). Distributors caught in a parent cycle
+// cannot be reached from a root and are listed separately.
+func (ds *DistributionSystem) WriteTree(w io.Writer, format string) error {
+	children := ds.children()
+	switch format {
+	case "", "text":
+		visited := make(map[string]bool)
+		var walk func(name, prefix, branch, indent string)
+		walk = func(name, prefix, branch, indent string) {
+			visited[name] = true
+			fmt.Fprintf(w, "%s%s%s\n", prefix, branch, ds.treeLabel(name))
+			kids := children[name]
+			for i, child := range kids {
+				if i == len(kids)-1 {
+					walk(child, prefix+indent, "└── ", "    ")
+				} else {
+					walk(child, prefix+indent, "├── ", "│   ")
+				}
+			}
+		}
+		for _, root := range children[""] {
+			walk(root, "", "", "")
+		}
+
+		var unreachable []string
+		for _, name := range ds.distributorNames() {
+			if !visited[name] {
+				unreachable = append(unreachable, ds.treeLabel(name))
+			}
+		}
+		if len(unreachable) > 0 {
+			fmt.Fprintln(w, "In a parent cycle:")
+			for _, label := range unreachable {
+				fmt.Fprintf(w, "  - %s\n", label)
+			}
+		}
+		return nil
+	case "dot":
+		fmt.Fprintln(w, "digraph distributors {")
+		for _, name := range ds.distributorNames() {
+			dist := ds.distributors[name]
+			fmt.Fprintf(w, "    %q [label=%q];\n", name, fmt.Sprintf("%s\n+%d -%d", name, len(dist.Includes), len(dist.Excludes)))
+		}
+		for _, name := range ds.distributorNames() {
+			if dist := ds.distributors[name]; dist.Parent != nil {
+				fmt.Fprintf(w, "    %q -> %q;\n", dist.Parent.Name, name)
+			}
+		}
+		fmt.Fprintln(w, "}")
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %s", format)
+	}
+}
+
+// treeLabel describes a distributor as a tree node
+func (ds *DistributionSystem) treeLabel(name string) string {
+	dist := ds.distributors[name]
+	counts := []string{
+		fmt.Sprintf("%d includes", len(dist.Includes)),
+		fmt.Sprintf("%d excludes", len(dist.Excludes)),
+	}
+	if len(dist.Quarantined) > 0 {
+		counts = append(counts, fmt.Sprintf("%d quarantined", len(dist.Quarantined)))
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.Join(counts, ", "))
+}
@@ -0,0 +1,193 @@
+package distribution
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Validity bounds the time during which a rule applies. ValidFrom is
+// inclusive and ValidUntil exclusive; a missing bound leaves that side open.
+type Validity struct {
+	ValidFrom  *time.Time `json:",omitempty" yaml:"validFrom,omitempty"`
+	ValidUntil *time.Time `json:",omitempty" yaml:"validUntil,omitempty"`
+}
+
+// IsZero reports whether the validity has no bounds, so the rule always
+// applies
+func (v Validity) IsZero() bool {
+	return v.ValidFrom == nil && v.ValidUntil == nil
+}
+
+// covers reports whether the rule applies at t
+func (v Validity) covers(t time.Time) bool {
+	if v.ValidFrom != nil && t.Before(*v.ValidFrom) {
+		return false
+	}
+	return v.ValidUntil == nil || t.Before(*v.ValidUntil)
+}
+
+func (v Validity) String() string {
+	switch {
+	case v.ValidFrom != nil && v.ValidUntil != nil:
+		return fmt.Sprintf("from %s until %s", formatBound(*v.ValidFrom), formatBound(*v.ValidUntil))
+	case v.ValidFrom != nil:
+		return "from " + formatBound(*v.ValidFrom)
+	case v.ValidUntil != nil:
+		return "until " + formatBound(*v.ValidUntil)
+	}
+	return "always"
+}
+
+// formatBound prints a bound as a date when it falls on midnight UTC
+func formatBound(t time.Time) string {
+	if t.Equal(t.UTC().Truncate(24 * time.Hour)) {
+		return t.UTC().Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
+
+// validitySuffix describes the validity of a rule for display
+func validitySuffix(validity map[string]Validity, region string) string {
+	if v, bounded := validity[region]; bounded {
+		return fmt.Sprintf(" (%s)", v)
+	}
+	return ""
+}
+
+// ruleSuffix describes the predicate and validity gating one of the
+// distributor's rules, and its priority, for display
+func (d *Distributor) ruleSuffix(isInclude bool, region string) string {
+	if isInclude {
+		return conditionSuffix(d.IncludeConditions, region) + validitySuffix(d.IncludeValidity, region) + prioritySuffix(d.IncludePriority, region)
+	}
+	return conditionSuffix(d.ExcludeConditions, region) + validitySuffix(d.ExcludeValidity, region) + prioritySuffix(d.ExcludePriority, region)
+}
+
+// now returns the time rules are evaluated at
+func (d *Distributor) now() time.Time {
+	if d.clock == nil {
+		return time.Now()
+	}
+	return d.clock()
+}
+
+// SetClock makes every distributor, and those added later, evaluate rule
+// validity at the time returned by now instead of the current time, for
+// checking permissions as of another date. A nil now restores the current
+// time.
+func (ds *DistributionSystem) SetClock(now func() time.Time) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.clock = now
+	for _, dist := range ds.distributors {
+		dist.clock = now
+	}
+}
+
+// Now returns the time rules are evaluated at, as set by SetClock
+func (ds *DistributionSystem) Now() time.Time {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	if ds.clock == nil {
+		return time.Now()
+	}
+	return ds.clock()
+}
+
+// SetRuleValidity limits when an existing include or exclude applies. A zero
+// validity makes the rule apply at all times again.
+func (ds *DistributionSystem) SetRuleValidity(distributorName, region string, isInclude bool, validity Validity) error {
+	if validity.ValidFrom != nil && validity.ValidUntil != nil && !validity.ValidUntil.After(*validity.ValidFrom) {
+		return errors.New("valid-until must be after valid-from")
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	distributor, exists := ds.distributors[distributorName]
+	if !exists {
+		return fmt.Errorf("distributor %s does not exist", distributorName)
+	}
+	region = ds.CanonicalRegion(region)
+	rules, validities, kind := distributor.Excludes, distributor.ExcludeValidity, "exclude"
+	if isInclude {
+		rules, validities, kind = distributor.Includes, distributor.IncludeValidity, "include"
+	}
+	if !rules[region] {
+		return fmt.Errorf("distributor %s has no %s permission for %s", distributorName, kind, region)
+	}
+
+	if validity.IsZero() {
+		delete(validities, region)
+	} else {
+		validities[region] = validity
+	}
+	return nil
+}
+
+// ExpiringRule is a time-bounded rule reported by Expiring
+type ExpiringRule struct {
+	Distributor string
+	Region      string
+	IsInclude   bool
+	ValidUntil  time.Time
+}
+
+// Expiring returns the rules whose validity ends within the given duration
+// of the time rules are evaluated at, soonest first, then by distributor and
+// region. Rules that have already expired are left out.
+func (ds *DistributionSystem) Expiring(within time.Duration) []ExpiringRule {
+	now := ds.Now()
+	end := now.Add(within)
+
+	var expiring []ExpiringRule
+	for _, name := range ds.distributorNames() {
+		dist := ds.distributors[name]
+		for _, set := range []struct {
+			validity  map[string]Validity
+			isInclude bool
+		}{{dist.IncludeValidity, true}, {dist.ExcludeValidity, false}} {
+			for region, v := range set.validity {
+				if v.ValidUntil == nil || !v.ValidUntil.After(now) || v.ValidUntil.After(end) {
+					continue
+				}
+				expiring = append(expiring, ExpiringRule{Distributor: name, Region: region, IsInclude: set.isInclude, ValidUntil: *v.ValidUntil})
+			}
+		}
+	}
+	sort.Slice(expiring, func(i, j int) bool {
+		a, b := expiring[i], expiring[j]
+		if !a.ValidUntil.Equal(b.ValidUntil) {
+			return a.ValidUntil.Before(b.ValidUntil)
+		}
+		if a.Distributor != b.Distributor {
+			return a.Distributor < b.Distributor
+		}
+		return a.Region < b.Region
+	})
+	return expiring
+}
+
+// NextValidityChange returns the earliest time after now at which a rule
+// starts or stops applying, so results computed now hold until then. It
+// returns false if no rule's validity changes in the future.
+func (ds *DistributionSystem) NextValidityChange() (time.Time, bool) {
+	now := ds.Now()
+	var next time.Time
+	found := false
+	consider := func(bound *time.Time) {
+		if bound != nil && bound.After(now) && (!found || bound.Before(next)) {
+			next, found = *bound, true
+		}
+	}
+	for _, dist := range ds.distributors {
+		for _, validity := range []map[string]Validity{dist.IncludeValidity, dist.ExcludeValidity} {
+			for _, v := range validity {
+				consider(v.ValidFrom)
+				consider(v.ValidUntil)
+			}
+		}
+	}
+	return next, found
+}
@@ -0,0 +1,230 @@
+package distribution
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// date returns midnight UTC on the given day of 2026
+func date(month time.Month, day int) time.Time {
+	return time.Date(2026, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// bounded returns the validity from from until until, leaving a zero time
+// open
+func bounded(from, until time.Time) Validity {
+	var v Validity
+	if !from.IsZero() {
+		v.ValidFrom = &from
+	}
+	if !until.IsZero() {
+		v.ValidUntil = &until
+	}
+	return v
+}
+
+// setClock fixes the time ds evaluates rules at
+func setClock(ds *DistributionSystem, at time.Time) {
+	ds.SetClock(func() time.Time { return at })
+}
+
+func TestValidityCovers(t *testing.T) {
+	from, until := date(3, 1), date(4, 1)
+	tests := []struct {
+		validity Validity
+		at       time.Time
+		want     bool
+	}{
+		{bounded(from, until), from.Add(-time.Nanosecond), false},
+		{bounded(from, until), from, true},
+		{bounded(from, until), until.Add(-time.Nanosecond), true},
+		{bounded(from, until), until, false},
+		{bounded(from, time.Time{}), until.AddDate(5, 0, 0), true},
+		{bounded(time.Time{}, until), from.AddDate(-5, 0, 0), true},
+		{Validity{}, until, true},
+	}
+	for _, tt := range tests {
+		if got := tt.validity.covers(tt.at); got != tt.want {
+			t.Errorf("%s covers %s = %v, want %v", tt.validity, tt.at.Format(time.RFC3339Nano), got, tt.want)
+		}
+	}
+}
+
+func TestValidityString(t *testing.T) {
+	noon := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]Validity{
+		"from 2026-03-01 until 2026-04-01": bounded(date(3, 1), date(4, 1)),
+		"from 2026-03-01":                  bounded(date(3, 1), time.Time{}),
+		"until 2026-03-01T12:00:00Z":       bounded(time.Time{}, noon),
+		"always":                           {},
+	}
+	for want, validity := range tests {
+		if got := validity.String(); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"D"}, include("D", "KA-IN"))
+	if err := ds.SetRuleValidity("D", "KA-IN", true, bounded(date(3, 1), date(4, 1))); err != nil {
+		t.Fatal(err)
+	}
+
+	setClock(ds, date(3, 15))
+	if got := ds.Now(); !got.Equal(date(3, 15)) {
+		t.Errorf("Now() = %s, want %s", got, date(3, 15))
+	}
+	assertChecks(t, ds, "D", map[string]bool{"KA-IN": true})
+
+	// Distributors added after SetClock use the same clock
+	addChain(t, ds, []string{"E"}, include("E", "TN-IN"))
+	if err := ds.SetRuleValidity("E", "TN-IN", true, bounded(time.Time{}, date(3, 10))); err != nil {
+		t.Fatal(err)
+	}
+	assertChecks(t, ds, "E", map[string]bool{"TN-IN": false})
+
+	// A nil clock goes back to the current time, long after both windows
+	ds.SetClock(nil)
+	if got := ds.Now(); time.Since(got) > time.Minute {
+		t.Errorf("Now() = %s after SetClock(nil), want the current time", got)
+	}
+	if time.Now().After(date(4, 1)) {
+		assertChecks(t, ds, "D", map[string]bool{"KA-IN": false})
+	}
+}
+
+func TestSetRuleValidityZeroClearsBounds(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"D"}, include("D", "KA-IN"))
+	setClock(ds, date(5, 1))
+	if err := ds.SetRuleValidity("D", "KA-IN", true, bounded(date(3, 1), date(4, 1))); err != nil {
+		t.Fatal(err)
+	}
+	assertChecks(t, ds, "D", map[string]bool{"KA-IN": false})
+	if err := ds.SetRuleValidity("D", "KA-IN", true, Validity{}); err != nil {
+		t.Fatal(err)
+	}
+	assertChecks(t, ds, "D", map[string]bool{"KA-IN": true})
+	if _, found := ds.NextValidityChange(); found {
+		t.Error("NextValidityChange found a change after the bounds were cleared")
+	}
+}
+
+func TestExpiring(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"A"}, include("A", "IN"), exclude("A", "KA-IN"), include("A", "US"))
+	addChain(t, ds, []string{"B"}, include("B", "TN-IN"), include("B", "HR-IN"), include("B", "CA-US"))
+	validities := []struct {
+		rule     testRule
+		validity Validity
+	}{
+		{include("A", "IN"), bounded(time.Time{}, date(3, 20))},
+		{exclude("A", "KA-IN"), bounded(date(1, 1), date(3, 5))},
+		{include("A", "US"), bounded(date(3, 2), time.Time{})},
+		{include("B", "TN-IN"), bounded(time.Time{}, date(3, 5))},
+		{include("B", "HR-IN"), bounded(time.Time{}, date(3, 1))},
+		{include("B", "CA-US"), bounded(time.Time{}, date(6, 1))},
+	}
+	for _, v := range validities {
+		if err := ds.SetRuleValidity(v.rule.distributor, v.rule.region, v.rule.isInclude, v.validity); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setClock(ds, date(3, 1))
+
+	tests := []struct {
+		within time.Duration
+		want   []ExpiringRule
+	}{
+		// B's HR-IN ends exactly now, so it has already expired
+		{0, nil},
+		{4 * 24 * time.Hour, []ExpiringRule{
+			{Distributor: "A", Region: "KA-IN", IsInclude: false, ValidUntil: date(3, 5)},
+			{Distributor: "B", Region: "TN-IN", IsInclude: true, ValidUntil: date(3, 5)},
+		}},
+		{30 * 24 * time.Hour, []ExpiringRule{
+			{Distributor: "A", Region: "KA-IN", IsInclude: false, ValidUntil: date(3, 5)},
+			{Distributor: "B", Region: "TN-IN", IsInclude: true, ValidUntil: date(3, 5)},
+			{Distributor: "A", Region: "IN", IsInclude: true, ValidUntil: date(3, 20)},
+		}},
+	}
+	for _, tt := range tests {
+		if got := ds.Expiring(tt.within); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Expiring(%s) = %+v, want %+v", tt.within, got, tt.want)
+		}
+	}
+
+	setClock(ds, date(3, 5))
+	got := ds.Expiring(30 * 24 * time.Hour)
+	want := []ExpiringRule{{Distributor: "A", Region: "IN", IsInclude: true, ValidUntil: date(3, 20)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expiring(30 days) on March 5 = %+v, want %+v", got, want)
+	}
+}
+
+func TestNextValidityChange(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"D"}, include("D", "IN"), exclude("D", "KA-IN"))
+	if err := ds.SetRuleValidity("D", "IN", true, bounded(date(2, 1), date(5, 1))); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.SetRuleValidity("D", "KA-IN", false, bounded(date(3, 1), date(4, 1))); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at    time.Time
+		want  time.Time
+		found bool
+		// checks holds what D can serve at that time, until the change
+		checks map[string]bool
+	}{
+		{date(1, 1), date(2, 1), true, map[string]bool{"IN": false, "KA-IN": false}},
+		{date(2, 1), date(3, 1), true, map[string]bool{"IN": true, "KA-IN": true}},
+		{date(3, 1), date(4, 1), true, map[string]bool{"IN": false, "KA-IN": false, "TN-IN": true}},
+		{date(4, 1), date(5, 1), true, map[string]bool{"IN": true, "KA-IN": true}},
+		{date(5, 1), time.Time{}, false, map[string]bool{"IN": false, "TN-IN": false}},
+	}
+	for _, tt := range tests {
+		setClock(ds, tt.at)
+		got, found := ds.NextValidityChange()
+		if found != tt.found || !got.Equal(tt.want) {
+			t.Errorf("NextValidityChange() at %s = %s, %v; want %s, %v", tt.at.Format("2006-01-02"), got, found, tt.want, tt.found)
+		}
+		assertChecks(t, ds, "D", tt.checks)
+		if found {
+			// Nothing changes until just before the next change
+			setClock(ds, got.Add(-time.Nanosecond))
+			assertChecks(t, ds, "D", tt.checks)
+		}
+	}
+}
+
+func TestValiditySavedWithState(t *testing.T) {
+	for _, name := range []string{"state.json", "state.yaml", "state.gob"} {
+		t.Run(name, func(t *testing.T) {
+			ds := newTestSystem(t)
+			addChain(t, ds, []string{"D"}, include("D", "IN"), exclude("D", "KA-IN"))
+			if err := ds.SetRuleValidity("D", "KA-IN", false, bounded(date(3, 1), date(4, 1))); err != nil {
+				t.Fatal(err)
+			}
+			filename := filepath.Join(t.TempDir(), name)
+			if err := ds.SaveState(filename); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := newTestSystem(t)
+			if err := loaded.LoadState(filename); err != nil {
+				t.Fatal(err)
+			}
+			for at, want := range map[time.Time]bool{date(2, 28): true, date(3, 1): false, date(4, 1): true} {
+				setClock(loaded, at)
+				assertChecks(t, loaded, "D", map[string]bool{"KA-IN": want, "BLR-KA-IN": want})
+			}
+		})
+	}
+}
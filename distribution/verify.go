@@ -0,0 +1,534 @@
+package distribution
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Verify runs every integrity check against the loaded state and returns a
+// description of each problem found. An empty result means the state is valid.
+func (ds *DistributionSystem) Verify() []string {
+	var issues []string
+
+	names := ds.distributorNames()
+	for _, name := range names {
+		if parentName, exists := ds.unresolvedParents[name]; exists {
+			issues = append(issues, fmt.Sprintf("%s: parent %s does not exist", name, parentName))
+		}
+	}
+
+	inCycle := make(map[string]bool)
+	for _, cycle := range ds.parentCycles() {
+		for _, name := range cycle {
+			inCycle[name] = true
+		}
+		issues = append(issues, fmt.Sprintf("parent cycle: %s", strings.Join(cycle, " -> ")))
+	}
+
+	for _, name := range names {
+		dist := ds.distributors[name]
+		for _, region := range sortedKeys(dist.Includes) {
+			if !ds.ValidateRegion(region) {
+				issues = append(issues, fmt.Sprintf("%s: unknown include region %s", name, region))
+			} else if dist.Parent != nil && !inCycle[name] && !dist.Parent.admits(region) {
+				issues = append(issues, fmt.Sprintf("%s: include %s is not permitted by parent %s", name, region, dist.Parent.Name))
+			}
+		}
+		for _, region := range sortedKeys(dist.Excludes) {
+			if !ds.ValidateRegion(region) {
+				issues = append(issues, fmt.Sprintf("%s: unknown exclude region %s", name, region))
+			}
+		}
+	}
+
+	return issues
+}
+
+// parentCycles returns each cycle in the parent graph once, as the list of
+// distributor names along it with the first name repeated at the end
+func (ds *DistributionSystem) parentCycles() [][]string {
+	var cycles [][]string
+	done := make(map[*Distributor]bool)
+	for _, name := range ds.distributorNames() {
+		onPath := make(map[*Distributor]int)
+		var path []*Distributor
+		d := ds.distributors[name]
+		for d != nil && !done[d] {
+			if start, seen := onPath[d]; seen {
+				var cycle []string
+				for _, member := range path[start:] {
+					cycle = append(cycle, member.Name)
+				}
+				cycles = append(cycles, append(cycle, d.Name))
+				break
+			}
+			onPath[d] = len(path)
+			path = append(path, d)
+			d = d.Parent
+		}
+		for _, member := range path {
+			done[member] = true
+		}
+	}
+	return cycles
+}
+
+// DistributorNames returns the names of all distributors in lexical order
+func (ds *DistributionSystem) DistributorNames() []string {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.distributorNames()
+}
+
+func (ds *DistributionSystem) distributorNames() []string {
+	names := make([]string, 0, len(ds.distributors))
+	for name := range ds.distributors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// emptyWithLocations returns a system with no distributors that shares the
+// already loaded location data
+func (ds *DistributionSystem) emptyWithLocations() *DistributionSystem {
+	other := NewDistributionSystem()
+	other.countryIndex = ds.countryIndex
+	other.provinceIndex = ds.provinceIndex
+	other.cityIndex = ds.cityIndex
+	other.subregions = ds.subregions
+	return other
+}
+
+// ValidateDir verifies every JSON or YAML state file in dir against the
+// loaded locations, printing a per-file summary. It reports whether all files
+// passed.
+func (ds *DistributionSystem) ValidateDir(dir string) (bool, error) {
+	var files []string
+	for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return false, err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return false, fmt.Errorf("no state files found in %s", dir)
+	}
+	sort.Strings(files)
+
+	allPassed := true
+	for _, file := range files {
+		other := ds.emptyWithLocations()
+		if err := other.LoadState(file); err != nil {
+			allPassed = false
+			fmt.Printf("FAIL %s: %v\n", file, err)
+			continue
+		}
+		issues := other.Verify()
+		if len(issues) == 0 {
+			fmt.Printf("PASS %s\n", file)
+			continue
+		}
+		allPassed = false
+		fmt.Printf("FAIL %s (%d issues)\n", file, len(issues))
+		for _, issue := range issues {
+			fmt.Printf("    - %s\n", issue)
+		}
+	}
+	return allPassed, nil
+}
+
+// NameCollisions returns the groups of distributor names that differ only in
+// case, each group sorted and the groups ordered by their first name
+func (ds *DistributionSystem) NameCollisions() [][]string {
+	byFolded := make(map[string][]string)
+	for _, name := range ds.distributorNames() {
+		folded := strings.ToLower(name)
+		byFolded[folded] = append(byFolded[folded], name)
+	}
+
+	var collisions [][]string
+	for _, names := range byFolded {
+		if len(names) > 1 {
+			collisions = append(collisions, names)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i][0] < collisions[j][0]
+	})
+	return collisions
+}
+
+// DanglingParents returns the distributors whose stored parent name did not
+// resolve when the state was loaded, mapped to that missing parent name
+func (ds *DistributionSystem) DanglingParents() map[string]string {
+	dangling := make(map[string]string, len(ds.unresolvedParents))
+	for name, parentName := range ds.unresolvedParents {
+		dangling[name] = parentName
+	}
+	return dangling
+}
+
+// FixDanglingParents resolves every dangling parent reference, either by
+// making the distributor a root (newParent empty) or by re-rooting it under
+// newParent. It returns the names of the distributors that were fixed.
+func (ds *DistributionSystem) FixDanglingParents(newParent string) ([]string, error) {
+	var parent *Distributor
+	if newParent != "" {
+		var exists bool
+		parent, exists = ds.distributors[newParent]
+		if !exists {
+			return nil, fmt.Errorf("parent distributor %s does not exist", newParent)
+		}
+	}
+
+	var fixed []string
+	for _, name := range ds.distributorNames() {
+		if _, dangling := ds.unresolvedParents[name]; !dangling {
+			continue
+		}
+		dist := ds.distributors[name]
+		if parent != nil && isAncestorOrSelf(dist, parent) {
+			return fixed, fmt.Errorf("cannot re-root %s under its own descendant %s", name, newParent)
+		}
+		dist.Parent = parent
+		delete(ds.unresolvedParents, name)
+		fixed = append(fixed, name)
+	}
+	return fixed, nil
+}
+
+// isAncestorOrSelf reports whether ancestor appears in d's parent chain,
+// counting d itself
+func isAncestorOrSelf(ancestor, d *Distributor) bool {
+	visited := make(map[*Distributor]bool)
+	for ; d != nil && !visited[d]; d = d.Parent {
+		if d == ancestor {
+			return true
+		}
+		visited[d] = true
+	}
+	return false
+}
+
+// Asymmetry is a child include that can never take effect because its parent
+// excludes a region containing it
+type Asymmetry struct {
+	Parent        string
+	Child         string
+	ParentExclude string
+	ChildInclude  string
+}
+
+// AsymmetryCheck scans every parent-child pair for parent excludes that make
+// one of the child's includes dead
+func (ds *DistributionSystem) AsymmetryCheck() []Asymmetry {
+	var found []Asymmetry
+	for _, name := range ds.distributorNames() {
+		child := ds.distributors[name]
+		if child.Parent == nil {
+			continue
+		}
+		for _, excluded := range sortedKeys(child.Parent.Excludes) {
+			excludedParts := strings.Split(excluded, "-")
+			for _, included := range sortedKeys(child.Includes) {
+				if isSubregion(strings.Split(included, "-"), excludedParts) {
+					found = append(found, Asymmetry{
+						Parent:        child.Parent.Name,
+						Child:         name,
+						ParentExclude: excluded,
+						ChildInclude:  included,
+					})
+				}
+			}
+		}
+	}
+	return found
+}
+
+// SelfContradictions returns, for each distributor, the region codes that
+// appear in both its includes and its excludes
+func (ds *DistributionSystem) SelfContradictions() map[string][]string {
+	found := make(map[string][]string)
+	for name, dist := range ds.distributors {
+		for _, region := range sortedKeys(dist.Includes) {
+			if dist.Excludes[region] {
+				found[name] = append(found[name], region)
+			}
+		}
+	}
+	return found
+}
+
+// ExcludeWarnings reports what adding excludes for regions would leave
+// wrong with a distributor's contract: an exclude outside every one of its
+// includes has no effect, and one covering an include removes all of it.
+// Nothing is changed.
+func (ds *DistributionSystem) ExcludeWarnings(distributorName string, regions []string) ([]string, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	if _, exists := ds.distributors[distributorName]; !exists {
+		return nil, fmt.Errorf("distributor %s does not exist", distributorName)
+	}
+
+	trial := ds.Clone()
+	dist := trial.distributors[distributorName]
+	// liveIncludes returns the includes that still decide their own region
+	liveIncludes := func() map[string]bool {
+		live := make(map[string]bool)
+		for include := range dist.Includes {
+			if _, isInclude, matched := dist.resolution().Decide(dist, include); matched && isInclude {
+				live[include] = true
+			}
+		}
+		return live
+	}
+
+	var warnings []string
+	before := liveIncludes()
+	for _, region := range regions {
+		region = ds.CanonicalRegion(region)
+		if !ds.ValidateRegion(region) {
+			continue
+		}
+		overlaps := false
+		for include := range dist.Includes {
+			if include == region || isStrictSubregion(region, include) || isStrictSubregion(include, region) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			warnings = append(warnings, fmt.Sprintf("exclude %s is outside every include of %s and has no effect", region, distributorName))
+		}
+		dist.Excludes[region] = true
+		dist.indexRule(region)
+	}
+
+	after := liveIncludes()
+	for _, include := range sortedKeys(before) {
+		if !after[include] {
+			rule, _, _ := dist.resolution().Decide(dist, include)
+			warnings = append(warnings, fmt.Sprintf("exclude %s removes all of include %s", rule, include))
+		}
+	}
+	if len(before) > 0 && len(after) == 0 {
+		warnings = append(warnings, fmt.Sprintf("%s would not be permitted anywhere", distributorName))
+	}
+	return warnings, nil
+}
+
+// ResolveContradictions removes one side of every self-contradiction, keeping
+// the include when prefer is "include" and the exclude when it is "exclude".
+// It returns how many contradictions were resolved.
+func (ds *DistributionSystem) ResolveContradictions(prefer string) (int, error) {
+	if prefer != "include" && prefer != "exclude" {
+		return 0, fmt.Errorf("preference must be include or exclude, got %q", prefer)
+	}
+
+	resolved := 0
+	for name, regions := range ds.SelfContradictions() {
+		dist := ds.distributors[name]
+		for _, region := range regions {
+			dist.deleteRule(prefer != "include", region)
+			resolved++
+		}
+	}
+	return resolved, nil
+}
+
+// Normalize drops permission entries stored as false, which hand edits can
+// introduce and which have no effect, along with any predicate, validity or
+// priority kept for a rule the distributor does not have, so that saving
+// yields the canonical form of the state. It returns the number of entries
+// dropped.
+func (ds *DistributionSystem) Normalize() int {
+	removed := 0
+	for _, dist := range ds.distributors {
+		for _, set := range []struct {
+			rules     map[string]bool
+			isInclude bool
+		}{{dist.Includes, true}, {dist.Excludes, false}} {
+			for region, value := range set.rules {
+				if !value {
+					dist.deleteRule(set.isInclude, region)
+					removed++
+				}
+			}
+		}
+		removed += dist.dropOrphanedGating()
+	}
+	return removed
+}
+
+// dropOrphanedGating removes the predicates, validity and priorities kept
+// for includes or excludes the distributor does not have, returning how
+// many were removed
+func (d *Distributor) dropOrphanedGating() int {
+	hasInclude := func(region string) bool { return d.Includes[region] || d.Quarantined[region] }
+	hasExclude := func(region string) bool { return d.Excludes[region] }
+	return dropOrphans(d.IncludeConditions, hasInclude) + dropOrphans(d.IncludeValidity, hasInclude) +
+		dropOrphans(d.IncludePriority, hasInclude) + dropOrphans(d.ExcludeConditions, hasExclude) +
+		dropOrphans(d.ExcludeValidity, hasExclude) + dropOrphans(d.ExcludePriority, hasExclude)
+}
+
+// dropOrphans deletes the entries of gating whose region has no rule,
+// returning how many it deleted
+func dropOrphans[V any](gating map[string]V, hasRule func(string) bool) int {
+	removed := 0
+	for region := range gating {
+		if !hasRule(region) {
+			delete(gating, region)
+			removed++
+		}
+	}
+	return removed
+}
+
+// DeterminismCheck evaluates every distributor against every city and every
+// region named in a rule, comparing HasPermission, run runs times, with a
+// reference evaluation that shares none of its machinery. The reference
+// decides each of the finest loaded locations in the region on its own,
+// scanning the chain's rules in sorted order with isSubregion and ranking
+// the matches by the system's strategy itself, so it relies on neither the
+// rule index, deniedWithin nor the distributors' ResolutionStrategy. It
+// returns one entry per disagreement found.
+func (ds *DistributionSystem) DeterminismCheck(runs int) []string {
+	regionSet := make(map[string]bool)
+	for _, location := range ds.cities() {
+		regionSet[CityKey(location)] = true
+	}
+	for _, dist := range ds.distributors {
+		for region := range dist.Includes {
+			regionSet[region] = true
+		}
+		for region := range dist.Excludes {
+			regionSet[region] = true
+		}
+	}
+	regions := sortedKeys(regionSet)
+	strategy := ds.strategyName()
+	within := locationsWithin(regions, ds.finestLocations())
+
+	var mismatches []string
+	for _, name := range ds.distributorNames() {
+		dist := ds.distributors[name]
+		ds.countScanned(len(regions))
+		decided := make(map[string]bool)
+		for _, region := range regions {
+			reference := referencePermits(dist, strategy, region, within[region], decided)
+			for run := 0; run < runs; run++ {
+				if result := dist.HasPermission(region); result != reference {
+					mismatches = append(mismatches, fmt.Sprintf("%s %s: run %d returned %v, the reference evaluation returns %v",
+						name, region, run+1, result, reference))
+					break
+				}
+			}
+		}
+	}
+	return mismatches
+}
+
+// finestLocations returns the keys of the loaded locations at the finest
+// level loaded, sorted, or nil without location data
+func (ds *DistributionSystem) finestLocations() []string {
+	for _, index := range []map[string]*Location{ds.cityIndex, ds.provinceIndex, ds.countryIndex} {
+		if len(index) > 0 {
+			return sortedKeys(index)
+		}
+	}
+	return nil
+}
+
+// locationsWithin maps each region to the locations inside it
+func locationsWithin(regions, locations []string) map[string][]string {
+	locationParts := make([][]string, len(locations))
+	for i, location := range locations {
+		locationParts[i] = strings.Split(location, "-")
+	}
+	within := make(map[string][]string, len(regions))
+	for _, region := range regions {
+		parts := strings.Split(region, "-")
+		for i, location := range locations {
+			if isSubregion(locationParts[i], parts) {
+				within[region] = append(within[region], location)
+			}
+		}
+	}
+	return within
+}
+
+// referencePermits reports whether d permits every one of the locations
+// inside region, deciding each with referenceAdmits and remembering it in
+// decided. Without loaded locations inside region, region itself and every
+// rule of the chain inside it stand in for them.
+func referencePermits(d *Distributor, strategy, region string, inside []string, decided map[string]bool) bool {
+	if len(inside) == 0 {
+		parts := strings.Split(region, "-")
+		inside = append(inside, region)
+		for dist := d; dist != nil; dist = dist.Parent {
+			for _, rules := range []map[string]bool{dist.Includes, dist.Excludes} {
+				for _, rule := range sortedKeys(rules) {
+					if rules[rule] && rule != region && isSubregion(strings.Split(rule, "-"), parts) {
+						inside = append(inside, rule)
+					}
+				}
+			}
+		}
+	}
+	for _, location := range inside {
+		permitted, seen := decided[location]
+		if !seen {
+			permitted = referenceAdmits(d, strategy, location)
+			decided[location] = permitted
+		}
+		if !permitted {
+			return false
+		}
+	}
+	return true
+}
+
+// referenceAdmits decides a single location for d and its ancestors by
+// scanning their rules, for DeterminismCheck to compare admits against
+func referenceAdmits(d *Distributor, strategy, location string) bool {
+	parts := strings.Split(location, "-")
+	deciding, isInclude, matched := "", false, false
+	// Excludes come first, so an include of the same rank never displaces
+	// one
+	for _, set := range []struct {
+		rules     map[string]bool
+		isInclude bool
+	}{{d.Excludes, false}, {d.Includes, true}} {
+		for _, rule := range sortedKeys(set.rules) {
+			if !set.rules[rule] || !isSubregion(parts, strings.Split(rule, "-")) || !d.ruleApplies(set.isInclude, rule) {
+				continue
+			}
+			if !matched || referenceOutranks(d, strategy, rule, set.isInclude, deciding, isInclude) {
+				deciding, isInclude, matched = rule, set.isInclude, true
+			}
+		}
+	}
+	if !matched || !isInclude {
+		return false
+	}
+	return d.Parent == nil || referenceAdmits(d.Parent, strategy, location)
+}
+
+// referenceOutranks reports whether rule takes over from the deciding rule
+// found so far under the named strategy
+func referenceOutranks(d *Distributor, strategy, rule string, isInclude bool, deciding string, decidingInclude bool) bool {
+	switch strategy {
+	case "excludes-win":
+		return !isInclude && decidingInclude
+	case "priority":
+		if priority, decidingPriority := d.rulePriority(isInclude, rule), d.rulePriority(decidingInclude, deciding); priority != decidingPriority {
+			return priority > decidingPriority
+		}
+	}
+	// Otherwise, and between rules of equal priority, the finer rule wins
+	return len(strings.Split(rule, "-")) > len(strings.Split(deciding, "-"))
+}
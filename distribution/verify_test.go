@@ -0,0 +1,135 @@
+package distribution
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeterminismCheck(t *testing.T) {
+	forEachStrategy(t, func(t *testing.T, ds *DistributionSystem, strategy string) {
+		addChain(t, ds, []string{"P", "C"},
+			include("P", "IN"), include("P", "US"), exclude("P", "KA-IN"), include("P", "BLR-KA-IN"),
+			include("C", "IN"), exclude("C", "MDU-TN-IN"), include("C", "CA-US"))
+		if err := ds.SetRulePriority("P", "KA-IN", false, 5); err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.AddConditionalPermission("C", "HR-IN", false, "tier=basic"); err != nil {
+			t.Fatal(err)
+		}
+		if mismatches := ds.DeterminismCheck(2); len(mismatches) > 0 {
+			t.Errorf("DeterminismCheck() = %v, want no mismatches", mismatches)
+		}
+	})
+}
+
+func TestDeterminismCheckReportsCorruption(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(d *Distributor)
+		// want is a mismatch that must be reported
+		want string
+	}{
+		{
+			// Without the index, checks of IN miss the exclude inside it
+			name:    "rule index lost",
+			corrupt: func(d *Distributor) { d.innerRules = make(map[string]map[string]bool) },
+			want:    "D IN: run 1 returned true, the reference evaluation returns false",
+		},
+		{
+			name:    "distributor strategy out of step with the system",
+			corrupt: func(d *Distributor) { d.strategy = specificityWins{} },
+			want:    "D BLR-KA-IN: run 1 returned true, the reference evaluation returns false",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := newTestSystem(t)
+			addChain(t, ds, []string{"D"}, include("D", "IN"), exclude("D", "KA-IN"), include("D", "BLR-KA-IN"))
+			if mismatches := ds.DeterminismCheck(1); len(mismatches) > 0 {
+				t.Fatalf("DeterminismCheck() before corrupting = %v, want no mismatches", mismatches)
+			}
+			tt.corrupt(ds.distributors["D"])
+			mismatches := ds.DeterminismCheck(1)
+			found := false
+			for _, mismatch := range mismatches {
+				found = found || mismatch == tt.want
+			}
+			if !found {
+				t.Errorf("DeterminismCheck() = [%s], want it to include %q", strings.Join(mismatches, "; "), tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveContradictionsDropsGating(t *testing.T) {
+	for _, prefer := range []string{"include", "exclude"} {
+		t.Run(prefer, func(t *testing.T) {
+			ds := newTestSystem(t)
+			addChain(t, ds, []string{"D"})
+			for _, isInclude := range []bool{true, false} {
+				if err := ds.AddConditionalPermission("D", "KA-IN", isInclude, "tier=premium"); err != nil {
+					t.Fatal(err)
+				}
+				if err := ds.SetRuleValidity("D", "KA-IN", isInclude, bounded(date(3, 1), time.Time{})); err != nil {
+					t.Fatal(err)
+				}
+				if err := ds.SetRulePriority("D", "KA-IN", isInclude, 2); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if resolved, err := ds.ResolveContradictions(prefer); err != nil || resolved != 1 {
+				t.Fatalf("ResolveContradictions(%s) = %d, %v; want 1", prefer, resolved, err)
+			}
+
+			d := ds.distributors["D"]
+			kept, dropped := []int{len(d.Includes), len(d.IncludeConditions), len(d.IncludeValidity), len(d.IncludePriority)},
+				[]int{len(d.Excludes), len(d.ExcludeConditions), len(d.ExcludeValidity), len(d.ExcludePriority)}
+			if prefer == "exclude" {
+				kept, dropped = dropped, kept
+			}
+			if want := []int{1, 1, 1, 1}; !reflect.DeepEqual(kept, want) {
+				t.Errorf("kept side has %v rules, conditions, validities and priorities, want %v", kept, want)
+			}
+			if want := []int{0, 0, 0, 0}; !reflect.DeepEqual(dropped, want) {
+				t.Errorf("dropped side has %v rules, conditions, validities and priorities, want %v", dropped, want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	ds := newTestSystem(t)
+	addChain(t, ds, []string{"D"}, include("D", "IN"), exclude("D", "KA-IN"))
+	d := ds.distributors["D"]
+	// As a hand edit could leave them: a rule stored as false, with its
+	// condition, and gating for rules that do not exist
+	d.Includes["US"] = false
+	d.IncludeConditions["US"] = "tier=premium"
+	d.ExcludeValidity["TN-IN"] = bounded(date(3, 1), time.Time{})
+	d.IncludePriority["KA-IN"] = 4
+	// Gating of a quarantined include and of existing rules is kept
+	d.Quarantined["CA-US"] = true
+	d.IncludePriority["CA-US"] = 1
+	d.ExcludePriority["KA-IN"] = 3
+
+	if removed := ds.Normalize(); removed != 3 {
+		t.Errorf("Normalize() = %d, want 3", removed)
+	}
+	if want := map[string]bool{"IN": true}; !reflect.DeepEqual(d.Includes, want) {
+		t.Errorf("Includes = %v, want %v", d.Includes, want)
+	}
+	if len(d.IncludeConditions) != 0 || len(d.ExcludeValidity) != 0 {
+		t.Errorf("orphaned gating kept: conditions %v, validity %v", d.IncludeConditions, d.ExcludeValidity)
+	}
+	if want := map[string]int{"CA-US": 1}; !reflect.DeepEqual(d.IncludePriority, want) {
+		t.Errorf("IncludePriority = %v, want %v", d.IncludePriority, want)
+	}
+	if want := map[string]int{"KA-IN": 3}; !reflect.DeepEqual(d.ExcludePriority, want) {
+		t.Errorf("ExcludePriority = %v, want %v", d.ExcludePriority, want)
+	}
+	if removed := ds.Normalize(); removed != 0 {
+		t.Errorf("second Normalize() = %d, want 0", removed)
+	}
+}
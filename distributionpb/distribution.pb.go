@@ -0,0 +1,465 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: distribution.proto
+
+package distributionpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PermissionType int32
+
+const (
+	// PERMISSION_TYPE_UNSPECIFIED adds an include, as the HTTP API does when
+	// no type is given
+	PermissionType_PERMISSION_TYPE_UNSPECIFIED PermissionType = 0
+	PermissionType_PERMISSION_TYPE_INCLUDE     PermissionType = 1
+	PermissionType_PERMISSION_TYPE_EXCLUDE     PermissionType = 2
+)
+
+// Enum value maps for PermissionType.
+var (
+	PermissionType_name = map[int32]string{
+		0: "PERMISSION_TYPE_UNSPECIFIED",
+		1: "PERMISSION_TYPE_INCLUDE",
+		2: "PERMISSION_TYPE_EXCLUDE",
+	}
+	PermissionType_value = map[string]int32{
+		"PERMISSION_TYPE_UNSPECIFIED": 0,
+		"PERMISSION_TYPE_INCLUDE":     1,
+		"PERMISSION_TYPE_EXCLUDE":     2,
+	}
+)
+
+func (x PermissionType) Enum() *PermissionType {
+	p := new(PermissionType)
+	*p = x
+	return p
+}
+
+func (x PermissionType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PermissionType) Descriptor() protoreflect.EnumDescriptor {
+	return file_distribution_proto_enumTypes[0].Descriptor()
+}
+
+func (PermissionType) Type() protoreflect.EnumType {
+	return &file_distribution_proto_enumTypes[0]
+}
+
+func (x PermissionType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PermissionType.Descriptor instead.
+func (PermissionType) EnumDescriptor() ([]byte, []int) {
+	return file_distribution_proto_rawDescGZIP(), []int{0}
+}
+
+type CheckPermissionRequest struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Distributor string                 `protobuf:"bytes,1,opt,name=distributor,proto3" json:"distributor,omitempty"`
+	// region is a region code such as CENAI-TN-IN, TN-IN or IN
+	Region        string `protobuf:"bytes,2,opt,name=region,proto3" json:"region,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckPermissionRequest) Reset() {
+	*x = CheckPermissionRequest{}
+	mi := &file_distribution_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckPermissionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckPermissionRequest) ProtoMessage() {}
+
+func (x *CheckPermissionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_distribution_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckPermissionRequest.ProtoReflect.Descriptor instead.
+func (*CheckPermissionRequest) Descriptor() ([]byte, []int) {
+	return file_distribution_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CheckPermissionRequest) GetDistributor() string {
+	if x != nil {
+		return x.Distributor
+	}
+	return ""
+}
+
+func (x *CheckPermissionRequest) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+type CheckPermissionResponse struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Distributor string                 `protobuf:"bytes,1,opt,name=distributor,proto3" json:"distributor,omitempty"`
+	// region is the requested region with aliases and case resolved
+	Region        string `protobuf:"bytes,2,opt,name=region,proto3" json:"region,omitempty"`
+	Allowed       bool   `protobuf:"varint,3,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckPermissionResponse) Reset() {
+	*x = CheckPermissionResponse{}
+	mi := &file_distribution_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckPermissionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckPermissionResponse) ProtoMessage() {}
+
+func (x *CheckPermissionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_distribution_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckPermissionResponse.ProtoReflect.Descriptor instead.
+func (*CheckPermissionResponse) Descriptor() ([]byte, []int) {
+	return file_distribution_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CheckPermissionResponse) GetDistributor() string {
+	if x != nil {
+		return x.Distributor
+	}
+	return ""
+}
+
+func (x *CheckPermissionResponse) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *CheckPermissionResponse) GetAllowed() bool {
+	if x != nil {
+		return x.Allowed
+	}
+	return false
+}
+
+type AddDistributorRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// parent is empty for a top-level distributor
+	Parent        string `protobuf:"bytes,2,opt,name=parent,proto3" json:"parent,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddDistributorRequest) Reset() {
+	*x = AddDistributorRequest{}
+	mi := &file_distribution_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddDistributorRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddDistributorRequest) ProtoMessage() {}
+
+func (x *AddDistributorRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_distribution_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddDistributorRequest.ProtoReflect.Descriptor instead.
+func (*AddDistributorRequest) Descriptor() ([]byte, []int) {
+	return file_distribution_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AddDistributorRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *AddDistributorRequest) GetParent() string {
+	if x != nil {
+		return x.Parent
+	}
+	return ""
+}
+
+type AddDistributorResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddDistributorResponse) Reset() {
+	*x = AddDistributorResponse{}
+	mi := &file_distribution_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddDistributorResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddDistributorResponse) ProtoMessage() {}
+
+func (x *AddDistributorResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_distribution_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddDistributorResponse.ProtoReflect.Descriptor instead.
+func (*AddDistributorResponse) Descriptor() ([]byte, []int) {
+	return file_distribution_proto_rawDescGZIP(), []int{3}
+}
+
+type AddPermissionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Distributor   string                 `protobuf:"bytes,1,opt,name=distributor,proto3" json:"distributor,omitempty"`
+	Region        string                 `protobuf:"bytes,2,opt,name=region,proto3" json:"region,omitempty"`
+	Type          PermissionType         `protobuf:"varint,3,opt,name=type,proto3,enum=distribution.v1.PermissionType" json:"type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddPermissionRequest) Reset() {
+	*x = AddPermissionRequest{}
+	mi := &file_distribution_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddPermissionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddPermissionRequest) ProtoMessage() {}
+
+func (x *AddPermissionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_distribution_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddPermissionRequest.ProtoReflect.Descriptor instead.
+func (*AddPermissionRequest) Descriptor() ([]byte, []int) {
+	return file_distribution_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *AddPermissionRequest) GetDistributor() string {
+	if x != nil {
+		return x.Distributor
+	}
+	return ""
+}
+
+func (x *AddPermissionRequest) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *AddPermissionRequest) GetType() PermissionType {
+	if x != nil {
+		return x.Type
+	}
+	return PermissionType_PERMISSION_TYPE_UNSPECIFIED
+}
+
+type AddPermissionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddPermissionResponse) Reset() {
+	*x = AddPermissionResponse{}
+	mi := &file_distribution_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddPermissionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddPermissionResponse) ProtoMessage() {}
+
+func (x *AddPermissionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_distribution_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddPermissionResponse.ProtoReflect.Descriptor instead.
+func (*AddPermissionResponse) Descriptor() ([]byte, []int) {
+	return file_distribution_proto_rawDescGZIP(), []int{5}
+}
+
+var File_distribution_proto protoreflect.FileDescriptor
+
+const file_distribution_proto_rawDesc = "" +
+	"\n" +
+	"\x12distribution.proto\x12\x0fdistribution.v1\"R\n" +
+	"\x16CheckPermissionRequest\x12 \n" +
+	"\vdistributor\x18\x01 \x01(\tR\vdistributor\x12\x16\n" +
+	"\x06region\x18\x02 \x01(\tR\x06region\"m\n" +
+	"\x17CheckPermissionResponse\x12 \n" +
+	"\vdistributor\x18\x01 \x01(\tR\vdistributor\x12\x16\n" +
+	"\x06region\x18\x02 \x01(\tR\x06region\x12\x18\n" +
+	"\aallowed\x18\x03 \x01(\bR\aallowed\"C\n" +
+	"\x15AddDistributorRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06parent\x18\x02 \x01(\tR\x06parent\"\x18\n" +
+	"\x16AddDistributorResponse\"\x85\x01\n" +
+	"\x14AddPermissionRequest\x12 \n" +
+	"\vdistributor\x18\x01 \x01(\tR\vdistributor\x12\x16\n" +
+	"\x06region\x18\x02 \x01(\tR\x06region\x123\n" +
+	"\x04type\x18\x03 \x01(\x0e2\x1f.distribution.v1.PermissionTypeR\x04type\"\x17\n" +
+	"\x15AddPermissionResponse*k\n" +
+	"\x0ePermissionType\x12\x1f\n" +
+	"\x1bPERMISSION_TYPE_UNSPECIFIED\x10\x00\x12\x1b\n" +
+	"\x17PERMISSION_TYPE_INCLUDE\x10\x01\x12\x1b\n" +
+	"\x17PERMISSION_TYPE_EXCLUDE\x10\x022\xbe\x02\n" +
+	"\x13DistributionService\x12d\n" +
+	"\x0fCheckPermission\x12'.distribution.v1.CheckPermissionRequest\x1a(.distribution.v1.CheckPermissionResponse\x12a\n" +
+	"\x0eAddDistributor\x12&.distribution.v1.AddDistributorRequest\x1a'.distribution.v1.AddDistributorResponse\x12^\n" +
+	"\rAddPermission\x12%.distribution.v1.AddPermissionRequest\x1a&.distribution.v1.AddPermissionResponseB\"Z movie-distrbution/distributionpbb\x06proto3"
+
+var (
+	file_distribution_proto_rawDescOnce sync.Once
+	file_distribution_proto_rawDescData []byte
+)
+
+func file_distribution_proto_rawDescGZIP() []byte {
+	file_distribution_proto_rawDescOnce.Do(func() {
+		file_distribution_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_distribution_proto_rawDesc), len(file_distribution_proto_rawDesc)))
+	})
+	return file_distribution_proto_rawDescData
+}
+
+var file_distribution_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_distribution_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_distribution_proto_goTypes = []any{
+	(PermissionType)(0),             // 0: distribution.v1.PermissionType
+	(*CheckPermissionRequest)(nil),  // 1: distribution.v1.CheckPermissionRequest
+	(*CheckPermissionResponse)(nil), // 2: distribution.v1.CheckPermissionResponse
+	(*AddDistributorRequest)(nil),   // 3: distribution.v1.AddDistributorRequest
+	(*AddDistributorResponse)(nil),  // 4: distribution.v1.AddDistributorResponse
+	(*AddPermissionRequest)(nil),    // 5: distribution.v1.AddPermissionRequest
+	(*AddPermissionResponse)(nil),   // 6: distribution.v1.AddPermissionResponse
+}
+var file_distribution_proto_depIdxs = []int32{
+	0, // 0: distribution.v1.AddPermissionRequest.type:type_name -> distribution.v1.PermissionType
+	1, // 1: distribution.v1.DistributionService.CheckPermission:input_type -> distribution.v1.CheckPermissionRequest
+	3, // 2: distribution.v1.DistributionService.AddDistributor:input_type -> distribution.v1.AddDistributorRequest
+	5, // 3: distribution.v1.DistributionService.AddPermission:input_type -> distribution.v1.AddPermissionRequest
+	2, // 4: distribution.v1.DistributionService.CheckPermission:output_type -> distribution.v1.CheckPermissionResponse
+	4, // 5: distribution.v1.DistributionService.AddDistributor:output_type -> distribution.v1.AddDistributorResponse
+	6, // 6: distribution.v1.DistributionService.AddPermission:output_type -> distribution.v1.AddPermissionResponse
+	4, // [4:7] is the sub-list for method output_type
+	1, // [1:4] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_distribution_proto_init() }
+func file_distribution_proto_init() {
+	if File_distribution_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_distribution_proto_rawDesc), len(file_distribution_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_distribution_proto_goTypes,
+		DependencyIndexes: file_distribution_proto_depIdxs,
+		EnumInfos:         file_distribution_proto_enumTypes,
+		MessageInfos:      file_distribution_proto_msgTypes,
+	}.Build()
+	File_distribution_proto = out.File
+	file_distribution_proto_goTypes = nil
+	file_distribution_proto_depIdxs = nil
+}
@@ -0,0 +1,211 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: distribution.proto
+
+package distributionpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	DistributionService_CheckPermission_FullMethodName = "/distribution.v1.DistributionService/CheckPermission"
+	DistributionService_AddDistributor_FullMethodName  = "/distribution.v1.DistributionService/AddDistributor"
+	DistributionService_AddPermission_FullMethodName   = "/distribution.v1.DistributionService/AddPermission"
+)
+
+// DistributionServiceClient is the client API for DistributionService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// DistributionService checks and changes the permissions of the
+// distributors that serve -cmd=serve -grpc-addr=... holds, the same ones its
+// HTTP endpoints serve. Changes are saved before they are acknowledged.
+type DistributionServiceClient interface {
+	// CheckPermission reports whether a distributor may serve a region
+	CheckPermission(ctx context.Context, in *CheckPermissionRequest, opts ...grpc.CallOption) (*CheckPermissionResponse, error)
+	// AddDistributor creates a distributor, under a parent if one is given
+	AddDistributor(ctx context.Context, in *AddDistributorRequest, opts ...grpc.CallOption) (*AddDistributorResponse, error)
+	// AddPermission adds an include or exclude to a distributor
+	AddPermission(ctx context.Context, in *AddPermissionRequest, opts ...grpc.CallOption) (*AddPermissionResponse, error)
+}
+
+type distributionServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDistributionServiceClient(cc grpc.ClientConnInterface) DistributionServiceClient {
+	return &distributionServiceClient{cc}
+}
+
+func (c *distributionServiceClient) CheckPermission(ctx context.Context, in *CheckPermissionRequest, opts ...grpc.CallOption) (*CheckPermissionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckPermissionResponse)
+	err := c.cc.Invoke(ctx, DistributionService_CheckPermission_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *distributionServiceClient) AddDistributor(ctx context.Context, in *AddDistributorRequest, opts ...grpc.CallOption) (*AddDistributorResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AddDistributorResponse)
+	err := c.cc.Invoke(ctx, DistributionService_AddDistributor_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *distributionServiceClient) AddPermission(ctx context.Context, in *AddPermissionRequest, opts ...grpc.CallOption) (*AddPermissionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AddPermissionResponse)
+	err := c.cc.Invoke(ctx, DistributionService_AddPermission_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DistributionServiceServer is the server API for DistributionService service.
+// All implementations must embed UnimplementedDistributionServiceServer
+// for forward compatibility.
+//
+// DistributionService checks and changes the permissions of the
+// distributors that serve -cmd=serve -grpc-addr=... holds, the same ones its
+// HTTP endpoints serve. Changes are saved before they are acknowledged.
+type DistributionServiceServer interface {
+	// CheckPermission reports whether a distributor may serve a region
+	CheckPermission(context.Context, *CheckPermissionRequest) (*CheckPermissionResponse, error)
+	// AddDistributor creates a distributor, under a parent if one is given
+	AddDistributor(context.Context, *AddDistributorRequest) (*AddDistributorResponse, error)
+	// AddPermission adds an include or exclude to a distributor
+	AddPermission(context.Context, *AddPermissionRequest) (*AddPermissionResponse, error)
+	mustEmbedUnimplementedDistributionServiceServer()
+}
+
+// UnimplementedDistributionServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDistributionServiceServer struct{}
+
+func (UnimplementedDistributionServiceServer) CheckPermission(context.Context, *CheckPermissionRequest) (*CheckPermissionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckPermission not implemented")
+}
+func (UnimplementedDistributionServiceServer) AddDistributor(context.Context, *AddDistributorRequest) (*AddDistributorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddDistributor not implemented")
+}
+func (UnimplementedDistributionServiceServer) AddPermission(context.Context, *AddPermissionRequest) (*AddPermissionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddPermission not implemented")
+}
+func (UnimplementedDistributionServiceServer) mustEmbedUnimplementedDistributionServiceServer() {}
+func (UnimplementedDistributionServiceServer) testEmbeddedByValue()                             {}
+
+// UnsafeDistributionServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DistributionServiceServer will
+// result in compilation errors.
+type UnsafeDistributionServiceServer interface {
+	mustEmbedUnimplementedDistributionServiceServer()
+}
+
+func RegisterDistributionServiceServer(s grpc.ServiceRegistrar, srv DistributionServiceServer) {
+	// If the following call pancis, it indicates UnimplementedDistributionServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&DistributionService_ServiceDesc, srv)
+}
+
+func _DistributionService_CheckPermission_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckPermissionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistributionServiceServer).CheckPermission(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DistributionService_CheckPermission_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistributionServiceServer).CheckPermission(ctx, req.(*CheckPermissionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DistributionService_AddDistributor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddDistributorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistributionServiceServer).AddDistributor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DistributionService_AddDistributor_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistributionServiceServer).AddDistributor(ctx, req.(*AddDistributorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DistributionService_AddPermission_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddPermissionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DistributionServiceServer).AddPermission(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DistributionService_AddPermission_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DistributionServiceServer).AddPermission(ctx, req.(*AddPermissionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// DistributionService_ServiceDesc is the grpc.ServiceDesc for DistributionService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DistributionService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "distribution.v1.DistributionService",
+	HandlerType: (*DistributionServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CheckPermission",
+			Handler:    _DistributionService_CheckPermission_Handler,
+		},
+		{
+			MethodName: "AddDistributor",
+			Handler:    _DistributionService_AddDistributor_Handler,
+		},
+		{
+			MethodName: "AddPermission",
+			Handler:    _DistributionService_AddPermission_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "distribution.proto",
+}
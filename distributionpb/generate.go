@@ -0,0 +1,6 @@
+// Package distributionpb holds the gRPC API that serve offers with
+// -grpc-addr: the DistributionService defined in distribution.proto, and
+// the messages, server interface and client generated from it.
+package distributionpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative distribution.proto
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"movie-distrbution/distribution"
+)
+
+// selfDryRunCommands check their changes without making them under
+// -dry-run and print their own plan; every other command changes the state
+// in memory and reportDryRun describes the difference
+var selfDryRunCommands = map[string]bool{
+	"move-distributor": true,
+	"apply":            true,
+	"import":           true,
+	"undo":             true,
+}
+
+// reportDryRun prints how the state now differs from the snapshot before
+// and the strategy it used, in the form the audit command uses
+func reportDryRun(system *distribution.DistributionSystem, before auditSnapshot, strategy string) error {
+	changes, err := changesSince(system, before)
+	if err != nil {
+		return err
+	}
+	strategyChanged := system.Strategy() != strategy
+	if len(changes) == 0 && !strategyChanged {
+		fmt.Println("Dry run: the state would not change")
+		return nil
+	}
+	fmt.Println("Dry run: the state would change as follows (nothing was saved):")
+	if strategyChanged {
+		fmt.Printf("  strategy: %s -> %s\n", strategy, system.Strategy())
+	}
+	for _, change := range changes {
+		fmt.Printf("  %s: %s\n", change.Distributor, describeAuditChange(change))
+	}
+	return nil
+}
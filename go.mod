@@ -1,3 +1,32 @@
 module movie-distrbution
 
-go 1.21.6
+go 1.25.0
+
+require (
+	golang.org/x/sys v0.43.0
+	golang.org/x/term v0.42.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/fsnotify/fsnotify v1.9.0
+
+require github.com/mattn/go-sqlite3 v1.14.33
+
+require go.etcd.io/bbolt v1.4.3
+
+require github.com/jackc/pgx/v5 v5.9.2
+
+require (
+	google.golang.org/grpc v1.82.1
+	google.golang.org/protobuf v1.36.11
+)
+
+require (
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/jackc/puddle/v2 v2.2.2 // indirect
+	golang.org/x/net v0.53.0 // indirect
+	golang.org/x/sync v0.20.0 // indirect
+	golang.org/x/text v0.36.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260414002931-afd174a4e478 // indirect
+)
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"movie-distrbution/distribution"
+	"movie-distrbution/distributionpb"
+)
+
+// grpcService serves the gRPC DistributionService from the same system as
+// the HTTP endpoints, so changes made through either are seen by both and
+// are saved, locked and audited alike
+type grpcService struct {
+	distributionpb.UnimplementedDistributionServiceServer
+	server *server
+}
+
+// newGRPCServer returns a gRPC server offering the DistributionService of s
+func (s *server) newGRPCServer() *grpc.Server {
+	grpcServer := grpc.NewServer()
+	distributionpb.RegisterDistributionServiceServer(grpcServer, &grpcService{server: s})
+	return grpcServer
+}
+
+func (g *grpcService) CheckPermission(ctx context.Context, req *distributionpb.CheckPermissionRequest) (*distributionpb.CheckPermissionResponse, error) {
+	if req.GetDistributor() == "" || req.GetRegion() == "" {
+		return nil, status.Error(codes.InvalidArgument, "distributor and region are required")
+	}
+	allowed, region, err := g.server.check(req.GetDistributor(), req.GetRegion())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &distributionpb.CheckPermissionResponse{Distributor: req.GetDistributor(), Region: region, Allowed: allowed}, nil
+}
+
+func (g *grpcService) AddDistributor(ctx context.Context, req *distributionpb.AddDistributorRequest) (*distributionpb.AddDistributorResponse, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "distributor name is required")
+	}
+	err := g.apply(distributionpb.DistributionService_AddDistributor_FullMethodName, func(system *distribution.DistributionSystem) error {
+		return system.AddDistributor(req.GetName(), req.GetParent())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &distributionpb.AddDistributorResponse{}, nil
+}
+
+func (g *grpcService) AddPermission(ctx context.Context, req *distributionpb.AddPermissionRequest) (*distributionpb.AddPermissionResponse, error) {
+	var isInclude bool
+	switch req.GetType() {
+	case distributionpb.PermissionType_PERMISSION_TYPE_UNSPECIFIED, distributionpb.PermissionType_PERMISSION_TYPE_INCLUDE:
+		isInclude = true
+	case distributionpb.PermissionType_PERMISSION_TYPE_EXCLUDE:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown permission type %d", req.GetType())
+	}
+	if req.GetDistributor() == "" || req.GetRegion() == "" {
+		return nil, status.Error(codes.InvalidArgument, "distributor and region are required")
+	}
+	err := g.apply(distributionpb.DistributionService_AddPermission_FullMethodName, func(system *distribution.DistributionSystem) error {
+		return system.AddPermission(req.GetDistributor(), req.GetRegion(), isInclude)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &distributionpb.AddPermissionResponse{}, nil
+}
+
+// apply makes change through server.apply, audited as the RPC's full method
+// name, and turns a failure into a gRPC status
+func (g *grpcService) apply(method string, change func(*distribution.DistributionSystem) error) error {
+	httpStatus, err := g.server.apply(method, change)
+	if err == nil {
+		return nil
+	}
+	return status.Error(grpcCode(httpStatus), err.Error())
+}
+
+// grpcCode maps the HTTP status server.apply reports to the nearest gRPC
+// status code
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusForbidden:
+		return codes.FailedPrecondition
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
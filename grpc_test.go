@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"movie-distrbution/distribution"
+	"movie-distrbution/distributionpb"
+)
+
+const testLocations = "distribution/testdata/locations.csv"
+
+// startGRPC serves a system with the test locations and no distributors over
+// gRPC on a local port, saving to a state file in a temporary directory, and
+// returns a client for it along with the state file
+func startGRPC(t *testing.T) (distributionpb.DistributionServiceClient, string) {
+	t.Helper()
+	system := distribution.NewDistributionSystem()
+	if err := system.LoadLocationData(testLocations, true); err != nil {
+		t.Fatal(err)
+	}
+	dataFile := filepath.Join(t.TempDir(), "distributors.json")
+	opts := &options{storage: "file", dataFile: dataFile, store: distribution.NewFileStore(dataFile)}
+	s := &server{system: system, opts: opts, metrics: newServerMetrics()}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := s.newGRPCServer()
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return distributionpb.NewDistributionServiceClient(conn), dataFile
+}
+
+func TestGRPCChangesAndChecks(t *testing.T) {
+	client, dataFile := startGRPC(t)
+	ctx := context.Background()
+
+	if _, err := client.AddDistributor(ctx, &distributionpb.AddDistributorRequest{Name: "P"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.AddDistributor(ctx, &distributionpb.AddDistributorRequest{Name: "C", Parent: "P"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []*distributionpb.AddPermissionRequest{
+		{Distributor: "P", Region: "IN"},
+		{Distributor: "P", Region: "KA-IN", Type: distributionpb.PermissionType_PERMISSION_TYPE_EXCLUDE},
+		{Distributor: "C", Region: "TN-IN", Type: distributionpb.PermissionType_PERMISSION_TYPE_INCLUDE},
+	} {
+		if _, err := client.AddPermission(ctx, req); err != nil {
+			t.Fatalf("AddPermission(%v): %v", req, err)
+		}
+	}
+
+	for region, want := range map[string]bool{"cenai-tn-in": true, "BLR-KA-IN": false, "US": false} {
+		resp, err := client.CheckPermission(ctx, &distributionpb.CheckPermissionRequest{Distributor: "C", Region: region})
+		if err != nil {
+			t.Fatalf("CheckPermission(C, %s): %v", region, err)
+		}
+		if resp.GetAllowed() != want {
+			t.Errorf("CheckPermission(C, %s) = %v, want %v", region, resp.GetAllowed(), want)
+		}
+	}
+
+	// Every change was saved before it was acknowledged
+	saved := distribution.NewDistributionSystem()
+	if err := saved.LoadLocationData(testLocations, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := saved.LoadState(dataFile); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, err := saved.CheckPermission("C", "CENAI-TN-IN"); err != nil || !allowed {
+		t.Errorf("saved CheckPermission(C, CENAI-TN-IN) = %v, %v; want true", allowed, err)
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	client, _ := startGRPC(t)
+	ctx := context.Background()
+	if _, err := client.AddDistributor(ctx, &distributionpb.AddDistributorRequest{Name: "P"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"check without a region", func() error {
+			_, err := client.CheckPermission(ctx, &distributionpb.CheckPermissionRequest{Distributor: "P"})
+			return err
+		}},
+		{"check of an unknown distributor", func() error {
+			_, err := client.CheckPermission(ctx, &distributionpb.CheckPermissionRequest{Distributor: "X", Region: "IN"})
+			return err
+		}},
+		{"duplicate distributor", func() error {
+			_, err := client.AddDistributor(ctx, &distributionpb.AddDistributorRequest{Name: "P"})
+			return err
+		}},
+		{"unknown permission type", func() error {
+			_, err := client.AddPermission(ctx, &distributionpb.AddPermissionRequest{Distributor: "P", Region: "IN", Type: 7})
+			return err
+		}},
+		{"unknown region", func() error {
+			_, err := client.AddPermission(ctx, &distributionpb.AddPermissionRequest{Distributor: "P", Region: "XX"})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		if code := status.Code(tt.call()); code != codes.InvalidArgument {
+			t.Errorf("%s: code = %v, want %v", tt.name, code, codes.InvalidArgument)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "net/http"
+
+// handleHealth serves GET /healthz for liveness probes: 200 while the
+// system is loaded, and 503 while SIGHUP or -watch reloads it or after the
+// last reload failed, with that error
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	switch {
+	case s.reloading:
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "reloading"})
+	case s.loadErr != nil:
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "load failed", "error": s.loadErr.Error()})
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// handleReady serves GET /readyz for readiness probes: 200 once the
+// locations and the distributors are both populated and 503 until then, with
+// how many of each are loaded
+func (s *server) handleReady(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	locations, distributors := s.system.LocationCount(), len(s.system.DistributorNames())
+	status := http.StatusOK
+	if locations == 0 || distributors == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, map[string]int{"locations": locations, "distributors": distributors})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockPollInterval is how often a busy state lock is retried until the
+// -lock-timeout runs out
+const lockPollInterval = 50 * time.Millisecond
+
+// stateLock is an advisory lock serializing CLI invocations on one state
+// file. It is taken on a separate NAME.lock file because saving replaces the
+// state file itself, which would leave a lock on it behind on the old file.
+type stateLock struct {
+	file *os.File
+}
+
+// acquireStateLock locks the state file at path, exclusively for commands
+// that save it and shared for those that only read it, so readers run
+// together but never see a half-finished update. A lock held by another
+// process is waited for up to timeout; a zero timeout fails at once.
+func acquireStateLock(path string, exclusive bool, timeout time.Duration) (*stateLock, error) {
+	lockPath := path + ".lock"
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLockFile(file, exclusive)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("locking %s: %w", lockPath, err)
+		}
+		if locked {
+			return &stateLock{file: file}, nil
+		}
+		if !time.Now().Before(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("%s is locked by another invocation; gave up after %v (see -lock-timeout, -no-lock)", path, timeout)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// release unlocks the state file. The lock file is left in place: removing
+// it could let two processes lock different files of the same name. A nil
+// lock, taken while locking is off, releases nothing.
+func (l *stateLock) release() {
+	if l == nil {
+		return
+	}
+	unlockFile(l.file)
+	l.file.Close()
+}
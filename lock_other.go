@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package main
+
+import "os"
+
+// tryLockFile always succeeds: this platform has no advisory file locks, so
+// concurrent invocations are not serialized
+func tryLockFile(file *os.File, exclusive bool) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(file *os.File) {}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// setupLogging makes the default slog logger write errors, warnings and
+// notices to stderr at level and above, as "plain" lines such as
+// "Warning: ..." (the default), as "text" key=value records or as "json"
+// records whose fields, such as operation, distributor and region, can be
+// filtered on
+func setupLogging(level, format string) error {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown log level %q (available: debug, info, warn, error)", level)
+	}
+	options := &slog.HandlerOptions{Level: minLevel}
+	var handler slog.Handler
+	switch format {
+	case "", "plain":
+		handler = &plainHandler{w: os.Stderr, level: minLevel, mu: &sync.Mutex{}}
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, options)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		return fmt.Errorf("unknown log format %q (available: plain, text, json)", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// plainHandler writes only each record's level and message, which carries
+// the details itself, the way errors and warnings were always printed
+type plainHandler struct {
+	w     io.Writer
+	level slog.Level
+	mu    *sync.Mutex
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *plainHandler) Handle(_ context.Context, record slog.Record) error {
+	label := "Error"
+	switch {
+	case record.Level < slog.LevelInfo:
+		label = "Debug"
+	case record.Level < slog.LevelWarn:
+		label = "Info"
+	case record.Level < slog.LevelError:
+		label = "Warning"
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := fmt.Fprintf(h.w, "%s: %s\n", label, strings.TrimSpace(record.Message))
+	return err
+}
+
+func (h *plainHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *plainHandler) WithGroup(string) slog.Handler { return h }
+
+// commandAttrs returns the fields describing the command opts runs, for log
+// records about it
+func commandAttrs(opts *options) []any {
+	attrs := []any{"operation", opts.command}
+	if opts.distributorName != "" {
+		attrs = append(attrs, "distributor", opts.distributorName)
+	}
+	if opts.region != "" {
+		attrs = append(attrs, "region", opts.region)
+	}
+	return attrs
+}
@@ -1,420 +1,311 @@
 package main
 
 import (
-	"encoding/csv"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
+	"log/slog"
 	"os"
 	"strings"
-)
-
-// Location represents a geographical location with both codes and names
-type Location struct {
-	CityCode     string
-	ProvinceCode string
-	CountryCode  string
-	CityName     string
-	ProvinceName string
-	CountryName  string
-}
-
-// DistributorData represents the data to be persisted
-type DistributorData struct {
-	Name       string
-	ParentName string
-	Includes   map[string]bool
-	Excludes   map[string]bool
-}
-
-// Distributor represents a distribution entity with its permissions
-type Distributor struct {
-	Name      string
-	Parent    *Distributor
-	Includes  map[string]bool
-	Excludes  map[string]bool
-	Locations map[string]*Location // Maps location codes to full location info
-}
-
-func NewDistributor(name string, parent *Distributor) *Distributor {
-	return &Distributor{
-		Name:      name,
-		Parent:    parent,
-		Includes:  make(map[string]bool),
-		Excludes:  make(map[string]bool),
-		Locations: make(map[string]*Location),
-	}
-}
+	"time"
 
-// DistributionSystem manages all distributors
-type DistributionSystem struct {
-	distributors map[string]*Distributor
-	locations    map[string]*Location
-}
+	"movie-distrbution/distribution"
+)
 
-// NewDistributionSystem creates a new system instance
-func NewDistributionSystem() *DistributionSystem {
-	return &DistributionSystem{
-		distributors: make(map[string]*Distributor),
-		locations:    make(map[string]*Location),
+func main() {
+	var opts options
+	fs := newFlagSet(os.Args[0], &opts)
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "help" || args[0] == "completion") {
+		var err error
+		if args[0] == "help" {
+			err = runHelp(fs, args[1:])
+		} else if len(args) != 2 {
+			err = errors.New("usage: completion bash|zsh")
+		} else {
+			err = writeCompletion(os.Stdout, fs, args[1], os.Args[0])
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		return
 	}
-}
-
-// LoadLocationData loads geographical data from CSV
-func (ds *DistributionSystem) LoadLocationData(filename string) error {
-	file, err := os.Open(filename)
+	args, err := resolveSubcommand(args)
 	if err != nil {
-		return err
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	// Skip header
-	_, err = reader.Read()
+	// Config file defaults are set first so the command line overrides them
+	defaults, err := loadConfig(configPath(args))
+	if err == nil {
+		err = applyConfig(fs, defaults)
+	}
 	if err != nil {
-		return err
+		fmt.Fprintf(os.Stderr, "Error: loading config: %v\n", err)
+		os.Exit(exitUsage)
 	}
-
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
 		}
+		os.Exit(exitUsage)
+	}
+	// Flags such as -data may also come before the subcommand
+	if opts.command == "" && fs.NArg() > 0 {
+		rest, err := resolveSubcommand(fs.Args())
 		if err != nil {
-			return err
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
 		}
-
-		if len(record) >= 6 {
-			location := &Location{
-				CityCode:     record[0],
-				ProvinceCode: record[1],
-				CountryCode:  record[2],
-				CityName:     record[3],
-				ProvinceName: record[4],
-				CountryName:  record[5],
+		if err := fs.Parse(rest); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return
 			}
-
-			cityKey := fmt.Sprintf("%s-%s-%s", location.CityCode, location.ProvinceCode, location.CountryCode)
-			provinceKey := fmt.Sprintf("%s-%s", location.ProvinceCode, location.CountryCode)
-			countryKey := location.CountryCode
-
-			ds.locations[cityKey] = location
-			ds.locations[provinceKey] = location
-			ds.locations[countryKey] = location
+			os.Exit(exitUsage)
 		}
 	}
-	return nil
-}
-
-// LoadState loads distributor data from the JSON file
-func (ds *DistributionSystem) LoadState(filename string) error {
-	file, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0644)
-	if err != nil {
-		return err
+	opts.defaults = defaults
+	if err := setupLogging(opts.logLevel, opts.logFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
 	}
-	defer file.Close()
-
-	stat, err := file.Stat()
-	if err != nil {
-		return err
+	// Missing arguments are reported before any data is loaded. Without a
+	// command the usage goes to stderr, as only an explicit help is a success.
+	if opts.command == "" {
+		writeUsage(os.Stderr)
+		slog.Error("no command given (see help)")
+		os.Exit(exitUsage)
 	}
-
-	if stat.Size() == 0 {
-		return nil
+	if err := checkRequired(fs, opts.command); err != nil {
+		slog.Error(err.Error(), "operation", opts.command)
+		os.Exit(exitUsage)
 	}
 
-	var distributorsData map[string]DistributorData
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&distributorsData); err != nil {
-		return err
+	err = run(&opts)
+	if err == nil {
+		return
 	}
-
-	// First pass: create all distributors
-	for name, data := range distributorsData {
-		dist := NewDistributor(name, nil)
-		dist.Includes = data.Includes
-		dist.Excludes = data.Excludes
-		dist.Locations = ds.locations
-		ds.distributors[name] = dist
+	// A denial or failed verification has already been reported as the
+	// command's result, so only the exit code tells it apart
+	if !errors.Is(err, errDenied) && !errors.Is(err, errCheckFailed) {
+		slog.Error(err.Error(), commandAttrs(&opts)...)
 	}
+	os.Exit(exitCode(err))
+}
 
-	// Second pass: set up parent relationships
-	for name, data := range distributorsData {
-		if data.ParentName != "" {
-			if parent, exists := ds.distributors[data.ParentName]; exists {
-				ds.distributors[name].Parent = parent
-			}
+// run loads the data, executes the command selected by opts and saves the
+// state if the command may have changed it
+func run(opts *options) error {
+	if err := checkStorage(opts); err != nil {
+		return err
+	}
+	var lock *stateLock
+	if !opts.noLock && opts.statePath() != "" {
+		// A bundle holds the state file, so the bundle is what is locked.
+		// A database server has no file to lock.
+		// serve saves every change it accepts, so it locks like a writer.
+		lockPath := opts.statePath()
+		if opts.bundlePath != "" && opts.command != "bundle" {
+			lockPath = opts.bundlePath
 		}
+		// With -watch it shares the file with other invocations instead and
+		// locks it only while loading and for each save.
+		exclusive := !readOnlyCommands[opts.command] || (opts.command == "serve" && !opts.watch)
+		var err error
+		if lock, err = acquireStateLock(lockPath, exclusive, opts.lockTimeout); err != nil {
+			return err
+		}
+		defer func() { lock.release() }()
 	}
 
-	return nil
-}
-
-// SaveState saves distributor data to the JSON file
-func (ds *DistributionSystem) SaveState(filename string) error {
-	distributorsData := make(map[string]DistributorData)
-
-	for name, dist := range ds.distributors {
-		var parentName string
-		if dist.Parent != nil {
-			parentName = dist.Parent.Name
+	if opts.bundlePath != "" && opts.command != "bundle" {
+		if opts.watch {
+			return usageErrorf("-watch cannot be combined with -bundle")
 		}
-
-		distributorsData[name] = DistributorData{
-			Name:       dist.Name,
-			ParentName: parentName,
-			Includes:   dist.Includes,
-			Excludes:   dist.Excludes,
+		dir, err := os.MkdirTemp("", "distribution-bundle-")
+		if err != nil {
+			return fmt.Errorf("extracting bundle: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		opts.csvFile, opts.dataFile, err = distribution.ExtractBundle(opts.bundlePath, dir)
+		if err != nil {
+			return fmt.Errorf("extracting bundle: %w", err)
 		}
 	}
 
-	file, err := os.Create(filename)
+	store, err := openStore(opts)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "    ")
-	return encoder.Encode(distributorsData)
-}
+	defer store.Close()
+	opts.store = store
 
-func (d *Distributor) AddPermission(permission string, isInclude bool) error {
-	if d.Parent != nil {
-		// Verify permission is valid with respect to parent
-		if !d.Parent.HasPermission(permission) {
-			return fmt.Errorf("parent distributor does not have permission for: %s", permission)
-		}
-	}
-
-	if isInclude {
-		d.Includes[permission] = true
-	} else {
-		d.Excludes[permission] = true
+	csvFiles, err := locationFiles(opts)
+	if err != nil {
+		return fmt.Errorf("loading location data: %w", err)
 	}
-	return nil
-}
+	opts.csvFiles = csvFiles
 
-// HasPermission checks if distribution is allowed in the given region
-func (d *Distributor) HasPermission(region string) bool {
-	parts := strings.Split(region, "-")
-
-	// Check excludes first
-	for excluded := range d.Excludes {
-		excludedParts := strings.Split(excluded, "-")
-		if isSubregion(parts, excludedParts) {
-			return false
+	// Initialize data and distributors from csv and json file
+	timer := newPhaseTimer(opts.timing)
+	// Cached results hold for the current time only, so -at bypasses them.
+	// They are keyed by the state file, which a database server has not.
+	if (opts.command == "check" || opts.command == "check-batch") && opts.cacheFile != "" && !opts.noCache && opts.at == "" && opts.statePath() != "" {
+		cache, err := openPermissionCache(opts.cacheFile, append(csvFiles, opts.statePath(), opts.aliasFile)...)
+		if err != nil {
+			return fmt.Errorf("opening cache: %w", err)
 		}
-	}
-
-	// Check includes
-	for included := range d.Includes {
-		includedParts := strings.Split(included, "-")
-		if isSubregion(parts, includedParts) {
-			// Check parent permissions if exists
-			if d.Parent != nil {
-				return d.Parent.HasPermission(region)
-			}
-			return true
+		// A cached result has no trace to explain it
+		if result, hit := cache.lookup(opts.distributorName, opts.region); hit && opts.command == "check" && !opts.explain {
+			timer.done("cache")
+			timer.report(0)
+			return printCheck(newOutputStyle(opts.noColor), opts, &result.Location, result.Allowed, nil)
 		}
+		opts.cache = cache
+		timer.done("cache")
 	}
-
-	return false
-}
-
-func isSubregion(region1, region2 []string) bool {
-	// If region2 is a country code
-	if len(region2) == 1 {
-		return region1[len(region1)-1] == region2[0]
-	}
-
-	// If region2 is a province-country code
-	if len(region2) == 2 {
-		return len(region1) >= 2 &&
-			region1[len(region1)-2] == region2[0] &&
-			region1[len(region1)-1] == region2[1]
+	system, err := loadLocations(opts)
+	if err != nil {
+		return err
 	}
+	timer.done("load-locations")
 
-	// If region2 is a city-province-country code
-	if len(region2) == 3 {
-		return len(region1) == 3 &&
-			region1[0] == region2[0] &&
-			region1[1] == region2[1] &&
-			region1[2] == region2[2]
+	// Load existing distributor data
+	if err := system.Load(opts.store); err != nil {
+		return fmt.Errorf("loading distributor data: %w", err)
 	}
-
-	return false
-}
-
-// AddDistributor adds a new distributor to the system
-func (ds *DistributionSystem) AddDistributor(name string, parentName string) error {
-	if _, exists := ds.distributors[name]; exists {
-		return fmt.Errorf("distributor %s already exists", name)
+	timer.done("load-state")
+	if opts.command == "serve" && opts.watch {
+		lock.release()
+		lock = nil
 	}
 
-	var parent *Distributor
-	if parentName != "" {
-		var exists bool
-		parent, exists = ds.distributors[parentName]
-		if !exists {
-			return fmt.Errorf("parent distributor %s does not exist", parentName)
+	if opts.at != "" {
+		at, err := parseTimeFlag(opts.at)
+		if err != nil {
+			return err
 		}
+		system.SetClock(func() time.Time { return at })
 	}
-
-	distributor := NewDistributor(name, parent)
-	distributor.Locations = ds.locations
-	ds.distributors[name] = distributor
-	return nil
-}
-
-// AddPermission adds a permission for a distributor
-func (ds *DistributionSystem) AddPermission(distributorName, region string, isInclude bool) error {
-	distributor, exists := ds.distributors[distributorName]
-	if !exists {
-		return fmt.Errorf("distributor %s does not exist", distributorName)
+	if opts.cache != nil {
+		if next, changes := system.NextValidityChange(); changes {
+			opts.cache.expireAt(next)
+		}
 	}
 
-	if !ds.ValidateRegion(region) {
-		return fmt.Errorf("invalid region code: %s", region)
+	// -strategy takes effect here, so a dry run compares with the saved one
+	strategy := system.Strategy()
+	if opts.strategy != "" {
+		if err := system.SetStrategy(opts.strategy); err != nil {
+			return err
+		}
 	}
-
-	return distributor.AddPermission(region, isInclude)
-}
-
-// CheckPermission checks if a distributor has permission for a region
-func (ds *DistributionSystem) CheckPermission(distributorName, region string) (bool, error) {
-	distributor, exists := ds.distributors[distributorName]
-	if !exists {
-		return false, fmt.Errorf("distributor %s does not exist", distributorName)
+	if opts.quarantine {
+		if quarantined := system.QuarantineViolations(); quarantined > 0 && !opts.terse {
+			fmt.Printf("Quarantined %d includes that exceed their parent's permissions\n", quarantined)
+		}
 	}
 
-	if !ds.ValidateRegion(region) {
-		return false, fmt.Errorf("invalid region code: %s", region)
+	if opts.only != "" {
+		if err := system.PruneTo(strings.Split(opts.only, ",")); err != nil {
+			return err
+		}
 	}
 
-	return distributor.HasPermission(region), nil
-}
-
-// ValidateRegion checks if a region code exists
-func (ds *DistributionSystem) ValidateRegion(region string) bool {
-	_, exists := ds.locations[region]
-	return exists
-}
-
-// ListDistributors prints all distributors and their permissions
-func (ds *DistributionSystem) ListDistributors() {
-	fmt.Println("Registered Distributors:")
-	for name, dist := range ds.distributors {
-		parentName := "none"
-		if dist.Parent != nil {
-			parentName = dist.Parent.Name
-		}
-		fmt.Printf("- %s (Parent: %s)\n", name, parentName)
-		fmt.Println("  Includes:")
-		for region := range dist.Includes {
-			fmt.Printf("    - %s\n", region)
+	// Script and shell lines are audited one by one as they run; a dry run
+	// is not audited at all
+	audit := openAuditLog(opts)
+	var before auditSnapshot
+	if audit != nil && !opts.dryRun && !readOnlyCommands[opts.command] && opts.command != "run-script" && opts.command != "shell" {
+		if before, err = takeAuditSnapshot(system); err != nil {
+			return err
 		}
-		fmt.Println("  Excludes:")
-		for region := range dist.Excludes {
-			fmt.Printf("    - %s\n", region)
+	}
+	dryRun := opts.dryRun && !readOnlyCommands[opts.command]
+	if dryRun && opts.command == "serve" {
+		return usageErrorf("serve cannot be combined with -dry-run")
+	}
+	var dryRunBefore auditSnapshot
+	if dryRun && !selfDryRunCommands[opts.command] {
+		if dryRunBefore, err = takeAuditSnapshot(system); err != nil {
+			return err
 		}
-		fmt.Println()
 	}
-}
 
-func main() {
-	// Command line flags
-	csvFile := flag.String("csv", "cities.csv", "Path to the locations CSV file")
-	dataFile := flag.String("data", "distributors.json", "Path to the distributors data file")
-	command := flag.String("cmd", "", "Command to execute (add-distributor, add-permission, check, list)")
-	distributorName := flag.String("distributor", "", "Distributor name")
-	parentName := flag.String("parent", "", "Parent distributor name (for add-distributor)")
-	region := flag.String("region", "", "Region code")
-	permissionType := flag.String("type", "include", "Permission type (include/exclude)")
-
-	flag.Parse()
-
-	// Initialize data and distributors from csv and json file
-	system := NewDistributionSystem()
-	err := system.LoadLocationData(*csvFile)
+	err = execute(system, opts)
+	timer.done("command")
+	timer.report(system.RegionsScanned())
 	if err != nil {
-		fmt.Printf("Error loading location data: %v\n", err)
-		return
+		return err
 	}
 
-	// Load existing distributor data
-	err = system.LoadState(*dataFile)
-	if err != nil {
-		fmt.Printf("Error loading distributor data: %v\n", err)
-		return
+	// Save state after successful command execution in json file
+	if readOnlyCommands[opts.command] {
+		return nil
 	}
-
-	var cmdErr error
-	switch *command {
-	case "list":
-		system.ListDistributors()
-		return
-
-	case "add-distributor":
-		if *distributorName == "" {
-			fmt.Println("Error: distributor name is required")
-			return
-		}
-		cmdErr = system.AddDistributor(*distributorName, *parentName)
-		if cmdErr == nil {
-			fmt.Printf("Successfully added distributor: %s\n", *distributorName)
+	if dryRun {
+		if dryRunBefore == nil {
+			return nil
 		}
-
-	case "add-permission":
-		if *distributorName == "" || *region == "" {
-			fmt.Println("Error: distributor name and region are required")
-			return
+		return reportDryRun(system, dryRunBefore, strategy)
+	}
+	if opts.only != "" {
+		fmt.Println("State not saved: -only loaded a subset of distributors")
+		return nil
+	}
+	if err := system.Save(opts.store); err != nil {
+		return fmt.Errorf("saving state: %w", err)
+	}
+	if err := saveLocations(system, opts); err != nil {
+		return fmt.Errorf("saving locations: %w", err)
+	}
+	if before != nil {
+		if err := audit.record(system, before, auditEntry{Command: opts.command, Args: os.Args[1:], Undone: opts.undone}); err != nil {
+			return fmt.Errorf("writing audit log: %w", err)
 		}
-		isInclude := *permissionType == "include"
-		cmdErr = system.AddPermission(*distributorName, *region, isInclude)
-		if cmdErr == nil {
-			fmt.Printf("Successfully added %s permission for %s to %s\n",
-				*permissionType, *region, *distributorName)
+	}
+	if opts.bundlePath != "" {
+		if err := distribution.WriteBundle(opts.bundlePath, opts.csvFile, opts.dataFile); err != nil {
+			return fmt.Errorf("updating bundle: %w", err)
 		}
+	}
+	return nil
+}
 
-	case "check":
-		if *distributorName == "" || *region == "" {
-			fmt.Println("Error: distributor name and region are required")
-			return
-		}
-		hasPermission, err := system.CheckPermission(*distributorName, *region)
-		if err != nil {
-			fmt.Printf("Error checking permission: %v\n", err)
-			return
+// loadLocations creates a system holding the aliases and locations CSVs
+// that opts names, without any distributors yet
+func loadLocations(opts *options) (*distribution.DistributionSystem, error) {
+	system := distribution.NewDistributionSystem()
+	system.SetCaseSensitiveNames(opts.caseSensitive)
+	if err := system.SetBackups(opts.backups); err != nil {
+		return nil, err
+	}
+	if opts.aliasFile != "" {
+		if err := system.LoadAliases(opts.aliasFile); err != nil {
+			return nil, fmt.Errorf("loading aliases: %w", err)
 		}
-		location := system.locations[*region]
-		fmt.Printf("Permission check for %s:\n", *distributorName)
-		fmt.Printf("Region: %s (%s, %s, %s)\n",
-			*region, location.CityName, location.ProvinceName, location.CountryName)
-		fmt.Printf("Result: %v\n", hasPermission)
-
-	default:
-		fmt.Println("Usage:")
-		fmt.Println("1. Add distributor:")
-		fmt.Println("   go run main.go -cmd=add-distributor -distributor=DIST1 [-parent=PARENTDIST]")
-		fmt.Println("\n2. Add permission:")
-		fmt.Println("   go run main.go -cmd=add-permission -distributor=DIST1 -region=REGION-CODE -type=include/exclude")
-		fmt.Println("\n3. Check permission:")
-		fmt.Println("   go run main.go -cmd=check -distributor=DIST1 -region=REGION-CODE")
-		fmt.Println("\n4. List all distributors:")
-		fmt.Println("   go run main.go -cmd=list")
 	}
-
-	if cmdErr != nil {
-		fmt.Printf("Error: %v\n", cmdErr)
-		return
+	loadOptions := distribution.LoadOptions{BufferSize: opts.csvBuffer, Level: opts.indexLevel, Cache: opts.locationCache}
+	if opts.progress {
+		loadOptions.Progress = loadProgress()
 	}
-
-	// Save state after successful command execution in json file
-	if *command != "check" && *command != "list" {
-		if err := system.SaveState(*dataFile); err != nil {
-			fmt.Printf("Error saving state: %v\n", err)
+	if err := system.SetLoadOptions(loadOptions); err != nil {
+		return nil, err
+	}
+	if len(opts.csvFiles) == 0 {
+		if err := loadStoredLocations(system, opts); err != nil {
+			return nil, fmt.Errorf("loading location data: %w", err)
 		}
+		return system, nil
+	}
+	conflicts, err := system.LoadLocationFiles(opts.csvFiles, opts.csvHasHeader)
+	if err != nil {
+		return nil, fmt.Errorf("loading location data: %w", err)
+	}
+	for _, conflict := range conflicts {
+		slog.Warn("conflicting location data: "+conflict, "operation", "load-locations")
 	}
+	return system, nil
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkLatencyBuckets are the upper bounds, in seconds, of the permission
+// check latency histogram
+var checkLatencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// serverMetrics counts what serve does, for /metrics. It is written in the
+// Prometheus text format by hand so serve needs no client library.
+type serverMetrics struct {
+	checksAllowed atomic.Int64
+	checksDenied  atomic.Int64
+	checksFailed  atomic.Int64
+	saves         atomic.Int64
+	saveErrors    atomic.Int64
+	reloadErrors  atomic.Int64
+
+	latencyMu  sync.Mutex
+	latency    []int64 // per bucket, not cumulative; the last is +Inf
+	latencySum float64
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{latency: make([]int64, len(checkLatencyBuckets)+1)}
+}
+
+// observeCheck records one permission check and how long it took; err is
+// set when the check could not be answered
+func (m *serverMetrics) observeCheck(allowed bool, err error, elapsed time.Duration) {
+	switch {
+	case err != nil:
+		m.checksFailed.Add(1)
+	case allowed:
+		m.checksAllowed.Add(1)
+	default:
+		m.checksDenied.Add(1)
+	}
+
+	seconds := elapsed.Seconds()
+	bucket := len(checkLatencyBuckets)
+	for i, bound := range checkLatencyBuckets {
+		if seconds <= bound {
+			bucket = i
+			break
+		}
+	}
+	m.latencyMu.Lock()
+	m.latency[bucket]++
+	m.latencySum += seconds
+	m.latencyMu.Unlock()
+}
+
+// observeSave records an attempt to save the state file
+func (m *serverMetrics) observeSave(err error) {
+	m.saves.Add(1)
+	if err != nil {
+		m.saveErrors.Add(1)
+	}
+}
+
+// write writes every metric in the Prometheus text exposition format, along
+// with the gauges given, which are read at scrape time
+func (m *serverMetrics) write(w io.Writer, distributors, locations int) {
+	fmt.Fprintln(w, "# HELP distribution_permission_checks_total Permission checks answered over HTTP, by result.")
+	fmt.Fprintln(w, "# TYPE distribution_permission_checks_total counter")
+	fmt.Fprintf(w, "distribution_permission_checks_total{result=\"allowed\"} %d\n", m.checksAllowed.Load())
+	fmt.Fprintf(w, "distribution_permission_checks_total{result=\"denied\"} %d\n", m.checksDenied.Load())
+	fmt.Fprintf(w, "distribution_permission_checks_total{result=\"error\"} %d\n", m.checksFailed.Load())
+
+	m.latencyMu.Lock()
+	counts := append([]int64(nil), m.latency...)
+	sum := m.latencySum
+	m.latencyMu.Unlock()
+	fmt.Fprintln(w, "# HELP distribution_permission_check_duration_seconds Time taken to answer a permission check.")
+	fmt.Fprintln(w, "# TYPE distribution_permission_check_duration_seconds histogram")
+	var cumulative int64
+	for i, bound := range checkLatencyBuckets {
+		cumulative += counts[i]
+		fmt.Fprintf(w, "distribution_permission_check_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	cumulative += counts[len(checkLatencyBuckets)]
+	fmt.Fprintf(w, "distribution_permission_check_duration_seconds_bucket{le=\"+Inf\"} %d\n", cumulative)
+	fmt.Fprintf(w, "distribution_permission_check_duration_seconds_sum %s\n", strconv.FormatFloat(sum, 'g', -1, 64))
+	fmt.Fprintf(w, "distribution_permission_check_duration_seconds_count %d\n", cumulative)
+
+	fmt.Fprintln(w, "# HELP distribution_distributors Distributors currently loaded.")
+	fmt.Fprintln(w, "# TYPE distribution_distributors gauge")
+	fmt.Fprintf(w, "distribution_distributors %d\n", distributors)
+	fmt.Fprintln(w, "# HELP distribution_locations Locations currently indexed.")
+	fmt.Fprintln(w, "# TYPE distribution_locations gauge")
+	fmt.Fprintf(w, "distribution_locations %d\n", locations)
+
+	fmt.Fprintln(w, "# HELP distribution_state_saves_total Attempts to save the state file after a change.")
+	fmt.Fprintln(w, "# TYPE distribution_state_saves_total counter")
+	fmt.Fprintf(w, "distribution_state_saves_total %d\n", m.saves.Load())
+	fmt.Fprintln(w, "# HELP distribution_state_save_errors_total Failed attempts to save the state file.")
+	fmt.Fprintln(w, "# TYPE distribution_state_save_errors_total counter")
+	fmt.Fprintf(w, "distribution_state_save_errors_total %d\n", m.saveErrors.Load())
+	fmt.Fprintln(w, "# HELP distribution_reload_errors_total Failed reloads of the state file on SIGHUP.")
+	fmt.Fprintln(w, "# TYPE distribution_reload_errors_total counter")
+	fmt.Fprintf(w, "distribution_reload_errors_total %d\n", m.reloadErrors.Load())
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"movie-distrbution/distribution"
+)
+
+// writeOverlapMatrix renders an overlap matrix as CSV (the default) or JSON
+func writeOverlapMatrix(w io.Writer, format string, names []string, matrix [][]int) error {
+	switch format {
+	case "", "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(append([]string{""}, names...)); err != nil {
+			return err
+		}
+		for i, row := range matrix {
+			record := []string{names[i]}
+			for _, count := range row {
+				record = append(record, strconv.Itoa(count))
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(struct {
+			Distributors []string
+			Matrix       [][]int
+		}{names, matrix})
+	default:
+		return usageErrorf("unsupported format %s", format)
+	}
+}
+
+// writePermissionDiff writes a permission diff as "json", or as "csv" with
+// one region per row and the side it falls on
+func writePermissionDiff(w io.Writer, format string, diff *distribution.PermissionDiff) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(diff)
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"Region", "Side"}); err != nil {
+			return err
+		}
+		sides := []struct {
+			name    string
+			regions []string
+		}{{diff.Distributor, diff.OnlyDistributor}, {diff.Against, diff.OnlyAgainst}, {"both", diff.Both}}
+		for _, side := range sides {
+			for _, region := range side.regions {
+				if err := writer.Write([]string{region, side.name}); err != nil {
+					return err
+				}
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return usageErrorf("unsupported format %s", format)
+	}
+}
+
+// writeLocations writes locations in the given format: "text" (or empty)
+// groups them by country as printLocationsByCountry does, and "csv" writes the
+// six columns of the locations CSV with its header. "ndjson" is written by
+// streamEffectiveRegions instead.
+func writeLocations(w io.Writer, format string, locations []*distribution.Location, codesOnly bool) error {
+	switch format {
+	case "", "text":
+		printLocationsByCountry(w, locations, codesOnly)
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		header := []string{"City Code", "Province Code", "Country Code", "City Name", "Province Name", "Country Name"}
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+		for _, location := range locations {
+			if err := writer.Write([]string{
+				location.CityCode, location.ProvinceCode, location.CountryCode,
+				location.CityName, location.ProvinceName, location.CountryName,
+			}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return usageErrorf("unsupported format %s", format)
+	}
+}
+
+// errEnoughResults stops a walk once -max-results entries have been written
+var errEnoughResults = errors.New("enough results")
+
+// streamEffectiveRegions writes the cities a distributor can serve to w as
+// ndjson, one JSON object per line as each location is reached, for
+// streaming consumers. Standard output is unbuffered, so every line is
+// written through as it is encoded. At most limit's maximum are written, and
+// none for -count-only.
+func streamEffectiveRegions(w io.Writer, system *distribution.DistributionSystem, distributorName string, limit resultLimit) error {
+	if limit.countOnly {
+		return nil
+	}
+	encoder := json.NewEncoder(w)
+	written := 0
+	err := system.WalkEffectiveRegions(distributorName, func(location *distribution.Location) error {
+		if limit.max > 0 && written == limit.max {
+			return errEnoughResults
+		}
+		written++
+		return encoder.Encode(location)
+	})
+	if errors.Is(err, errEnoughResults) {
+		return nil
+	}
+	return err
+}
+
+// streamWhoCan writes the distributors that can serve region to w as
+// ndjson, one JSON object per line as each distributor is checked, like
+// streamEffectiveRegions. At most limit's maximum are written, and none for
+// -count-only.
+func streamWhoCan(w io.Writer, system *distribution.DistributionSystem, region string, limit resultLimit) error {
+	if limit.countOnly {
+		return nil
+	}
+	encoder := json.NewEncoder(w)
+	written := 0
+	err := system.WalkWhoCan(region, func(name string) error {
+		if limit.max > 0 && written == limit.max {
+			return errEnoughResults
+		}
+		written++
+		return encoder.Encode(map[string]string{"distributor": name})
+	})
+	if errors.Is(err, errEnoughResults) {
+		return nil
+	}
+	return err
+}
+
+// writeDistributors writes distributor records as an indented JSON array or
+// as CSV with one row per distributor, its rule sets joined by spaces. Text
+// output is left to ListDistributors.
+func writeDistributors(w io.Writer, format string, records []distribution.DistributorData) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(records)
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"Name", "Parent", "Includes", "Excludes", "Max Children", "Quarantined"}); err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := writer.Write([]string{
+				record.Name, record.ParentName,
+				strings.Join(sortedKeys(record.Includes), " "),
+				strings.Join(sortedKeys(record.Excludes), " "),
+				strconv.Itoa(record.MaxChildren),
+				strings.Join(sortedKeys(record.Quarantined), " "),
+			}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return usageErrorf("unsupported format %s", format)
+	}
+}
+
+// writeRegionCoverage writes province or country coverage as "text" (or
+// empty), "csv" or "ndjson", like writeLocations and
+// streamEffectiveRegions do for cities. Coverage is only known once every
+// city has been checked, so it is written at the end.
+func writeRegionCoverage(w io.Writer, format string, coverage []distribution.RegionCoverage, codesOnly bool) error {
+	switch format {
+	case "", "text":
+		for _, rc := range coverage {
+			if codesOnly {
+				fmt.Fprintln(w, rc.Region)
+				continue
+			}
+			cities := fmt.Sprintf("%d of %d cities", rc.Covered, rc.Total)
+			if rc.Covered == rc.Total {
+				cities = fmt.Sprintf("all %d cities", rc.Total)
+			}
+			fmt.Fprintf(w, "  - %s (%s): %s\n", rc.Region, rc.Name, cities)
+		}
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"Region", "Name", "Covered", "Total"}); err != nil {
+			return err
+		}
+		for _, rc := range coverage {
+			if err := writer.Write([]string{rc.Region, rc.Name, strconv.Itoa(rc.Covered), strconv.Itoa(rc.Total)}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, rc := range coverage {
+			if err := encoder.Encode(rc); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return usageErrorf("unsupported format %s", format)
+	}
+}
+
+// printLocationsByCountry lists sorted locations grouped under a heading per
+// country. With codesOnly, just the city keys are printed, one per line.
+func printLocationsByCountry(w io.Writer, locations []*distribution.Location, codesOnly bool) {
+	for i, location := range locations {
+		if codesOnly {
+			fmt.Fprintln(w, distribution.CityKey(location))
+			continue
+		}
+		if i == 0 || locations[i-1].CountryCode != location.CountryCode {
+			count := 0
+			for _, other := range locations[i:] {
+				if other.CountryCode != location.CountryCode {
+					break
+				}
+				count++
+			}
+			fmt.Fprintf(w, "%s (%s): %d\n", location.CountryCode, location.CountryName, count)
+		}
+		fmt.Fprintf(w, "  - %s (%s, %s)\n", distribution.CityKey(location), location.CityName, location.ProvinceName)
+	}
+}
+
+// resultLimit caps how many entries an enumeration command prints
+type resultLimit struct {
+	max       int // 0 means unlimited
+	countOnly bool
+}
+
+// shown returns how many of total entries should be printed
+func (l resultLimit) shown(total int) int {
+	if l.countOnly {
+		return 0
+	}
+	if l.max > 0 && total > l.max {
+		return l.max
+	}
+	return total
+}
+
+// footer prints the total for -count-only, or how many entries were cut off
+func (l resultLimit) footer(w io.Writer, total int) {
+	if l.countOnly {
+		fmt.Fprintln(w, total)
+		return
+	}
+	if hidden := total - l.shown(total); hidden > 0 {
+		fmt.Fprintf(w, "... and %d more\n", hidden)
+	}
+}
+
+// sortedProvinceCoverage orders province coverage from the most to the least
+// covered, breaking ties by province code
+func sortedProvinceCoverage(coverage map[string]distribution.ProvinceCoverage) []distribution.ProvinceCoverage {
+	sorted := make([]distribution.ProvinceCoverage, 0, len(coverage))
+	for _, pc := range coverage {
+		sorted = append(sorted, pc)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Ratio() != sorted[j].Ratio() {
+			return sorted[i].Ratio() > sorted[j].Ratio()
+		}
+		return sorted[i].Province < sorted[j].Province
+	})
+	return sorted
+}
+
+// locationKeys returns the city keys of locations, keeping their order
+func locationKeys(locations []*distribution.Location) []string {
+	keys := make([]string, len(locations))
+	for i, location := range locations {
+		keys[i] = distribution.CityKey(location)
+	}
+	return keys
+}
+
+// sortedKeys returns the keys of a map in lexical order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+
+	"movie-distrbution/distribution"
+)
+
+// handleReplacePermissions serves PUT /distributors/{name}/permissions with
+// {"includes": [...], "excludes": [...]}, replacing all of the distributor's
+// rules at once. Sending the same body again leaves the state as it is, and
+// a body with any invalid region or include outside the parent changes
+// nothing.
+func (s *server) handleReplacePermissions(w http.ResponseWriter, r *http.Request, name string) {
+	var body struct {
+		Includes []string `json:"includes"`
+		Excludes []string `json:"excludes"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	s.update(w, r, http.StatusOK, func(system *distribution.DistributionSystem) error {
+		return system.ReplacePermissions(name, body.Includes, body.Excludes)
+	})
+}
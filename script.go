@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"movie-distrbution/distribution"
+)
+
+// runScript executes the CLI-style command lines in filename one after the
+// other against system. Each line holds a command name followed by its flags
+// (for example "add-distributor -distributor=DIST1"); blank lines and lines
+// starting with '#' are skipped and a line reading "save" writes the state
+// file immediately. Every line is attempted and reported with its line
+// number; the returned error summarizes the failed lines, if any.
+func runScript(system *distribution.DistributionSystem, filename string, base *options) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	lineNum, executed, failed := 0, 0, 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		executed++
+		err := runScriptLine(system, line, base)
+		if err == errDenied {
+			fmt.Printf("line %d: denied\n", lineNum)
+			continue
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("line %d: error: %v\n", lineNum, err)
+			continue
+		}
+		fmt.Printf("line %d: ok\n", lineNum)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d script lines failed", failed, executed)
+	}
+	return nil
+}
+
+// runScriptLine parses and executes a single script line. The locations and
+// state files always come from the invocation running the script, so a line
+// cannot switch to a different data set midway.
+func runScriptLine(system *distribution.DistributionSystem, line string, base *options) error {
+	args, err := splitScriptLine(line)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 && args[0] == "save" {
+		if base.dryRun {
+			fmt.Println("Dry run: not saving")
+			return nil
+		}
+		if base.only != "" {
+			return errors.New("cannot save: -only loaded a subset of distributors")
+		}
+		return system.Save(base.store)
+	}
+	if args, err = resolveSubcommand(args); err != nil {
+		return err
+	}
+
+	var opts options
+	fs := newFlagSet("run-script", &opts)
+	fs.SetOutput(io.Discard)
+	if err := applyConfig(fs, base.defaults); err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageErrorf("unexpected argument %q", fs.Arg(0))
+	}
+	if opts.command == "run-script" || opts.command == "shell" {
+		return usageErrorf("%s cannot be nested", opts.command)
+	}
+	opts.csvFile = base.csvFile
+	opts.csvFiles = base.csvFiles
+	opts.dataFile = base.dataFile
+	opts.storage = base.storage
+	opts.dbPath = base.dbPath
+	opts.store = base.store
+	opts.noColor = base.noColor
+	opts.defaults = base.defaults
+
+	// A line's own -dry-run runs on a copy, since the state the script or
+	// shell saves at the end must not include it
+	if opts.dryRun && !readOnlyCommands[opts.command] && !selfDryRunCommands[opts.command] {
+		before, err := takeAuditSnapshot(system)
+		if err != nil {
+			return err
+		}
+		trial := system.Clone()
+		if err := execute(trial, &opts); err != nil {
+			return err
+		}
+		return reportDryRun(trial, before, system.Strategy())
+	}
+
+	audit := openAuditLog(base)
+	if audit == nil || readOnlyCommands[opts.command] || base.only != "" || base.dryRun {
+		return execute(system, &opts)
+	}
+	before, err := takeAuditSnapshot(system)
+	if err != nil {
+		return err
+	}
+	if err := execute(system, &opts); err != nil {
+		return err
+	}
+	if err := audit.record(system, before, auditEntry{Command: opts.command, Args: args, Undone: opts.undone}); err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	return nil
+}
+
+// splitScriptLine splits a script line into arguments on whitespace, keeping
+// single- or double-quoted text together so values may contain spaces
+func splitScriptLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"movie-distrbution/distribution"
+)
+
+// server exposes a loaded system over HTTP. Requests share the system under
+// a read-write lock; every successful change is saved to the state file
+// before it is acknowledged.
+type server struct {
+	mu     sync.RWMutex
+	system *distribution.DistributionSystem
+	opts   *options
+
+	// reloading is set while SIGHUP replaces the system and loadErr holds
+	// the error of the last reload, if it failed; both turn /healthz red
+	reloading bool
+	loadErr   error
+
+	// stamp identifies the state file as last loaded or saved, so -watch
+	// can tell changes by other invocations from its own saves
+	stamp fileStamp
+
+	metrics *serverMetrics
+}
+
+// serve answers HTTP requests on opts.addr, and gRPC ones on opts.grpcAddr if
+// set, until interrupted. SIGHUP reloads the state file, as does any change
+// to it or to the locations under -watch.
+func serve(system *distribution.DistributionSystem, opts *options) error {
+	s := &server{system: system, opts: opts, metrics: newServerMetrics()}
+	s.stamp, _ = statFile(opts.statePath())
+	if opts.watch {
+		watcher, err := s.watch()
+		if err != nil {
+			return fmt.Errorf("watching files: %w", err)
+		}
+		defer watcher.Close()
+	}
+	httpServer := &http.Server{Addr: opts.addr, Handler: s.routes()}
+	var grpcServer *grpc.Server
+	if opts.grpcAddr != "" {
+		listener, err := net.Listen("tcp", opts.grpcAddr)
+		if err != nil {
+			return fmt.Errorf("listening for gRPC: %w", err)
+		}
+		grpcServer = s.newGRPCServer()
+		defer grpcServer.Stop()
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				slog.Error(fmt.Sprintf("serving gRPC: %v", err), "operation", "serve")
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				s.reload(false)
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			httpServer.Shutdown(ctx)
+			cancel()
+			if grpcServer != nil {
+				grpcServer.GracefulStop()
+			}
+			return
+		}
+	}()
+
+	fmt.Printf("Serving %s on %s\n", opts.stateName(), opts.addr)
+	if grpcServer != nil {
+		fmt.Printf("Serving gRPC on %s\n", opts.grpcAddr)
+	}
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/distributors", s.handleDistributors)
+	mux.HandleFunc("/distributors/", s.handleDistributor)
+	return mux
+}
+
+// reload replaces the system with a fresh load of the state file, keeping
+// the location data unless locations is set. On failure the previous system
+// keeps serving and the error is logged and returned.
+func (s *server) reload(locations bool) error {
+	s.mu.Lock()
+	s.reloading = true
+	current := s.system
+	s.mu.Unlock()
+
+	var fresh *distribution.DistributionSystem
+	var stamp fileStamp
+	// Without -watch serve holds the lock on the state file all along
+	lock, err := s.lockState(false)
+	if err == nil {
+		fresh, stamp, err = s.load(current, locations)
+		lock.release()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reloading = false
+	s.loadErr = err
+	if err != nil {
+		s.metrics.reloadErrors.Add(1)
+		slog.Error(fmt.Sprintf("reloading %s: %v", s.opts.stateName(), err), "operation", "reload", "file", s.opts.stateName())
+		return err
+	}
+	s.system = fresh
+	s.stamp = stamp
+	return nil
+}
+
+// load reads the state file into a new system sharing the locations of
+// current, or with the locations read afresh when locations is set
+func (s *server) load(current *distribution.DistributionSystem, locations bool) (*distribution.DistributionSystem, fileStamp, error) {
+	var stamp fileStamp
+	var err error
+	// A database server has no file to stamp
+	if path := s.opts.statePath(); path != "" {
+		if stamp, err = statFile(path); err != nil {
+			return nil, stamp, err
+		}
+	}
+	if locations {
+		if current, err = loadLocations(s.opts); err != nil {
+			return nil, stamp, err
+		}
+	}
+	fresh, err := current.LoadBaselineFrom(s.opts.store)
+	if err != nil {
+		return nil, stamp, err
+	}
+	fresh.SetCaseSensitiveNames(s.opts.caseSensitive)
+	if s.opts.strategy != "" {
+		if err := fresh.SetStrategy(s.opts.strategy); err != nil {
+			return nil, stamp, err
+		}
+	}
+	return fresh, stamp, nil
+}
+
+// handleMetrics serves the counters and gauges of serverMetrics in the
+// Prometheus text format
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	s.mu.RLock()
+	distributors, locations := len(s.system.DistributorNames()), s.system.LocationCount()
+	s.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.write(w, distributors, locations)
+}
+
+// handleDistributors serves /distributors: GET lists the names and POST
+// creates a distributor from {"name": ..., "parent": ...}
+func (s *server) handleDistributors(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		writeJSON(w, http.StatusOK, s.system.DistributorNames())
+	case http.MethodPost:
+		var body struct {
+			Name   string `json:"name"`
+			Parent string `json:"parent"`
+		}
+		if !decodeBody(w, r, &body) {
+			return
+		}
+		if body.Name == "" {
+			writeError(w, http.StatusBadRequest, errors.New("distributor name is required"))
+			return
+		}
+		s.update(w, r, http.StatusCreated, func(system *distribution.DistributionSystem) error {
+			return system.AddDistributor(body.Name, body.Parent)
+		})
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleDistributor serves /distributors/{name}/permissions and
+// /distributors/{name}/check
+func (s *server) handleDistributor(w http.ResponseWriter, r *http.Request) {
+	name, action, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/distributors/"), "/")
+	if !found || name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "check":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		region := r.URL.Query().Get("region")
+		if region == "" {
+			writeError(w, http.StatusBadRequest, errors.New("region is required"))
+			return
+		}
+		allowed, region, err := s.check(name, region)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"distributor": name, "region": region, "allowed": allowed})
+
+	case "permissions":
+		s.handlePermissions(w, r, name)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handlePermissions adds one rule with POST {"region": ..., "type":
+// "include"|"exclude"}; PUT is left to handleReplacePermissions
+func (s *server) handlePermissions(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodPost:
+		var body struct {
+			Region string `json:"region"`
+			Type   string `json:"type"`
+		}
+		if !decodeBody(w, r, &body) {
+			return
+		}
+		if body.Type == "" {
+			body.Type = "include"
+		}
+		if body.Region == "" || (body.Type != "include" && body.Type != "exclude") {
+			writeError(w, http.StatusBadRequest, errors.New("region and a type of include or exclude are required"))
+			return
+		}
+		s.update(w, r, http.StatusCreated, func(system *distribution.DistributionSystem) error {
+			return system.AddPermission(name, body.Region, body.Type == "include")
+		})
+	case http.MethodPut:
+		s.handleReplacePermissions(w, r, name)
+	default:
+		methodNotAllowed(w, http.MethodPost, http.MethodPut)
+	}
+}
+
+// check reports whether the distributor may serve region, along with the
+// region's canonical code, and counts the check in the metrics
+func (s *server) check(distributor, region string) (bool, string, error) {
+	start := time.Now()
+	s.mu.RLock()
+	allowed, err := s.system.CheckPermission(distributor, region)
+	region = s.system.CanonicalRegion(region)
+	s.mu.RUnlock()
+	s.metrics.observeCheck(allowed, err, time.Since(start))
+	return allowed, region, err
+}
+
+// update applies change through apply and answers with status and
+// {"status": "ok"}, or with the error apply reports
+func (s *server) update(w http.ResponseWriter, r *http.Request, status int, change func(*distribution.DistributionSystem) error) {
+	if errStatus, err := s.apply(r.Method+" "+r.URL.Path, change); err != nil {
+		writeError(w, errStatus, err)
+		return
+	}
+	writeJSON(w, status, map[string]string{"status": "ok"})
+}
+
+// apply makes change under the write lock, saves the state and records the
+// change in the -audit-log, if any, as operation. On failure it returns the
+// HTTP status that describes the error. A change that fails to save is not
+// rolled back in memory, so the error tells the client the server and the
+// stored state now disagree.
+func (s *server) apply(operation string, change func(*distribution.DistributionSystem) error) (int, error) {
+	if s.opts.only != "" {
+		return http.StatusForbidden, errors.New("read-only: -only loaded a subset of distributors")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Under -watch another invocation may have saved the state since it was
+	// last loaded; the change is made to that state, not the one served
+	lock, err := s.lockState(true)
+	if err != nil {
+		return http.StatusServiceUnavailable, err
+	}
+	defer lock.release()
+	if s.opts.watch {
+		if stamp, _ := statFile(s.opts.statePath()); stamp != s.stamp {
+			fresh, stamp, err := s.load(s.system, false)
+			if err != nil {
+				return http.StatusInternalServerError, fmt.Errorf("reloading state: %w", err)
+			}
+			s.system, s.stamp = fresh, stamp
+		}
+	}
+
+	audit := openAuditLog(s.opts)
+	var before auditSnapshot
+	if audit != nil {
+		var err error
+		if before, err = takeAuditSnapshot(s.system); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	if err := change(s.system); err != nil {
+		return http.StatusBadRequest, err
+	}
+	err = s.system.Save(s.opts.store)
+	s.metrics.observeSave(err)
+	s.stamp, _ = statFile(s.opts.statePath())
+	if err != nil {
+		slog.Error(fmt.Sprintf("saving state after %s: %v", operation, err), "operation", operation, "file", s.opts.stateName())
+		return http.StatusInternalServerError, fmt.Errorf("saving state: %w", err)
+	}
+	slog.Info("state changed by "+operation, "operation", operation, "file", s.opts.stateName())
+	if audit != nil {
+		if err := audit.record(s.system, before, auditEntry{Command: operation}); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("change saved, but writing audit log: %w", err)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %w", err))
+		return false
+	}
+	return true
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
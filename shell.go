@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"movie-distrbution/distribution"
+)
+
+const shellPrompt = "distribution> "
+
+// runShell reads command lines interactively and executes them against
+// system, which stays loaded between them. Lines use the run-script syntax;
+// "help" prints the usage, "help COMMAND" that command's, and "exit", "quit" or end of input leaves the
+// shell. On a terminal, lines can be edited and recalled with the arrow keys
+// and Tab completes distributor names after -distributor= and -parent=.
+func runShell(system *distribution.DistributionSystem, base *options) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if !runShellLine(system, scanner.Text(), base) {
+				return nil
+			}
+		}
+		return scanner.Err()
+	}
+
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, shellPrompt)
+	terminal.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return completeDistributor(system, line, pos)
+	}
+	for {
+		// Only line editing needs raw mode; commands print normally
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		line, err := terminal.ReadLine()
+		term.Restore(fd, state)
+		if err == io.EOF {
+			fmt.Println()
+			return nil
+		}
+		if err != nil && !errors.Is(err, term.ErrPasteIndicator) {
+			return err
+		}
+		if !runShellLine(system, line, base) {
+			return nil
+		}
+	}
+}
+
+// runShellLine executes one shell line, printing any error, and returns false
+// when the line asks to leave the shell
+func runShellLine(system *distribution.DistributionSystem, line string, base *options) bool {
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "" || strings.HasPrefix(line, "#"):
+		return true
+	case line == "exit" || line == "quit":
+		return false
+	case line == "help" || strings.HasPrefix(line, "help "):
+		var opts options
+		if err := runHelp(newFlagSet("shell", &opts), strings.Fields(line)[1:]); err != nil {
+			slog.Error(err.Error(), "operation", "help")
+		}
+		return true
+	}
+	if err := runScriptLine(system, line, base); err != nil && err != errCheckFailed && err != errDenied {
+		slog.Error(err.Error(), "operation", "shell", "line", line)
+	}
+	return true
+}
+
+// completeDistributor completes the distributor name being typed at pos when
+// it follows -distributor= or -parent=. A unique match is completed in full;
+// otherwise the name is extended to the longest prefix all matches share.
+func completeDistributor(system *distribution.DistributionSystem, line string, pos int) (string, int, bool) {
+	start := strings.LastIndexAny(line[:pos], " \t") + 1
+	word := line[start:pos]
+	var prefix string
+	for _, flagName := range []string{"-distributor=", "-parent=", "--distributor=", "--parent="} {
+		if strings.HasPrefix(word, flagName) {
+			prefix = flagName
+			break
+		}
+	}
+	if prefix == "" {
+		return "", 0, false
+	}
+
+	partial := word[len(prefix):]
+	completion := ""
+	matched := false
+	for _, name := range system.DistributorNames() {
+		if !strings.HasPrefix(name, partial) {
+			continue
+		}
+		if !matched {
+			completion, matched = name, true
+			continue
+		}
+		for !strings.HasPrefix(name, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if !matched || completion == partial {
+		return "", 0, false
+	}
+	completed := line[:start] + prefix + completion
+	return completed + line[pos:], len(completed), true
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"movie-distrbution/distribution"
+	"movie-distrbution/distribution/boltstore"
+	"movie-distrbution/distribution/pgstore"
+	"movie-distrbution/distribution/sqlitestore"
+)
+
+// storageKinds lists the values -storage accepts
+var storageKinds = []string{"file", "sqlite", "bolt", "postgres"}
+
+// checkStorage reports flags that do not go with the -storage chosen. It
+// runs before anything is locked, since the lock is named after -db.
+func checkStorage(opts *options) error {
+	switch opts.storage {
+	case "file":
+		if opts.dbPath != "" {
+			return usageErrorf("-db needs -storage=sqlite, bolt or postgres")
+		}
+		return nil
+	case "sqlite", "bolt", "postgres":
+		if opts.dbPath == "" {
+			return usageErrorf("-storage=%s needs -db", opts.storage)
+		}
+		// Bundles and backups are made of state files
+		switch {
+		case opts.bundlePath != "" || opts.command == "bundle":
+			return usageErrorf("bundles hold a state file and cannot be used with -storage=%s", opts.storage)
+		case opts.backups > 0:
+			return usageErrorf("-backups keeps copies of a state file and cannot be used with -storage=%s", opts.storage)
+		case opts.watch && opts.storage == "postgres":
+			return usageErrorf("-watch follows changes to a file and cannot be used with -storage=%s", opts.storage)
+		}
+		return nil
+	}
+	return usageErrorf("unknown -storage %q, want one of %v", opts.storage, storageKinds)
+}
+
+// openStore opens the store -storage selects for the state: the -data file,
+// or the -db database
+func openStore(opts *options) (distribution.Store, error) {
+	var store distribution.Store
+	var err error
+	switch opts.storage {
+	case "sqlite":
+		store, err = sqlitestore.Open(opts.dbPath)
+	case "bolt":
+		// bbolt takes its own lock on the file for each load and save, on
+		// top of the state lock
+		store, err = boltstore.Open(opts.dbPath, opts.lockTimeout)
+	case "postgres":
+		store, err = pgstore.Open(context.Background(), opts.dbPath)
+	default:
+		return &distribution.FileStore{Path: opts.dataFile, Backups: opts.backups}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	return store, nil
+}
+
+// statePath returns the file the state is kept in, which is what gets
+// locked, watched and keys the permission cache. It is empty for a database
+// server, whose writers rely on its row versions instead of a lock.
+func (opts *options) statePath() string {
+	switch opts.storage {
+	case "file":
+		return opts.dataFile
+	case "postgres":
+		return ""
+	}
+	return opts.dbPath
+}
+
+// stateName names where the state is kept in messages. A database server is
+// named by its store, since -db may hold a password.
+func (opts *options) stateName() string {
+	if path := opts.statePath(); path != "" || opts.store == nil {
+		return path
+	}
+	return fmt.Sprint(opts.store)
+}
+
+// locationFiles resolves -csv like distribution.LocationFiles, except that a
+// store holding locations stands in for CSVs that do not exist, in which
+// case no files are returned
+func locationFiles(opts *options) ([]string, error) {
+	files, err := distribution.LocationFiles(opts.csvFile)
+	if _, ok := opts.store.(distribution.LocationStore); ok && errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return files, err
+}
+
+// loadStoredLocations indexes the locations kept in the store into system
+func loadStoredLocations(system *distribution.DistributionSystem, opts *options) error {
+	store, ok := opts.store.(distribution.LocationStore)
+	if !ok {
+		return errors.New("no locations CSV given")
+	}
+	locations, err := store.LoadLocations()
+	if err != nil {
+		return err
+	}
+	if len(locations) == 0 {
+		return fmt.Errorf("%s does not exist and %s holds no locations", opts.csvFile, opts.statePath())
+	}
+	system.AddLocations(locations)
+	return nil
+}
+
+// saveLocations keeps the locations loaded from the CSVs in the store too,
+// if it can hold them, so later invocations need not have the CSVs
+func saveLocations(system *distribution.DistributionSystem, opts *options) error {
+	store, ok := opts.store.(distribution.LocationStore)
+	if !ok || len(opts.csvFiles) == 0 {
+		return nil
+	}
+	return store.SaveLocations(system.LocationRecords())
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	colorGreen = "\033[32m"
+	colorRed   = "\033[31m"
+	colorReset = "\033[0m"
+	// defaultWidth is used when the terminal width cannot be determined
+	defaultWidth = 80
+)
+
+// outputStyle controls how human-facing output is decorated for the terminal
+type outputStyle struct {
+	color bool
+	width int
+}
+
+// newOutputStyle enables color only when stdout is a terminal and neither
+// -no-color nor the NO_COLOR convention disables it
+func newOutputStyle(noColor bool) outputStyle {
+	fd := int(os.Stdout.Fd())
+	style := outputStyle{width: defaultWidth}
+	if term.IsTerminal(fd) {
+		style.color = !noColor && os.Getenv("NO_COLOR") == ""
+		if width, _, err := term.GetSize(fd); err == nil && width > 0 {
+			style.width = width
+		}
+	} else if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		style.width = columns
+	}
+	return style
+}
+
+// verdict renders a permission result, green when allowed and red when denied
+func (s outputStyle) verdict(allowed bool) string {
+	return s.highlight(allowed, strconv.FormatBool(allowed))
+}
+
+// outcome renders a permission result as the word allowed or denied
+func (s outputStyle) outcome(allowed bool) string {
+	if allowed {
+		return s.highlight(true, "allowed")
+	}
+	return s.highlight(false, "denied")
+}
+
+// highlight colors text green for a positive result and red for a negative one
+func (s outputStyle) highlight(allowed bool, text string) string {
+	if !s.color {
+		return text
+	}
+	if allowed {
+		return colorGreen + text + colorReset
+	}
+	return colorRed + text + colorReset
+}
+
+// wrapList joins items with commas after prefix, breaking lines so they fit
+// the terminal width. Continuation lines are indented to align with the
+// first item.
+func (s outputStyle) wrapList(prefix string, items []string) string {
+	var b strings.Builder
+	indent := strings.Repeat(" ", len(prefix))
+	b.WriteString(prefix)
+	lineLen := len(prefix)
+	for i, item := range items {
+		if i > 0 {
+			b.WriteString(",")
+			lineLen++
+			if lineLen+1+len(item) > s.width {
+				b.WriteString("\n" + indent)
+				lineLen = len(indent)
+			} else {
+				b.WriteString(" ")
+				lineLen++
+			}
+		}
+		b.WriteString(item)
+		lineLen += len(item)
+	}
+	return b.String()
+}
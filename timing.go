@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// phaseTimer measures consecutive phases of a CLI run for the -timing flag
+type phaseTimer struct {
+	enabled bool
+	last    time.Time
+	phases  []string
+	elapsed []time.Duration
+}
+
+func newPhaseTimer(enabled bool) *phaseTimer {
+	return &phaseTimer{enabled: enabled, last: time.Now()}
+}
+
+// done records the time since the previous phase ended under name
+func (t *phaseTimer) done(name string) {
+	now := time.Now()
+	t.phases = append(t.phases, name)
+	t.elapsed = append(t.elapsed, now.Sub(t.last))
+	t.last = now
+}
+
+// report writes the phase breakdown to stderr, including the enumeration
+// throughput of the final phase when any regions were scanned
+func (t *phaseTimer) report(regionsScanned int64) {
+	if !t.enabled {
+		return
+	}
+	for i, name := range t.phases {
+		fmt.Fprintf(os.Stderr, "timing: %-15s %v\n", name, t.elapsed[i].Round(time.Microsecond))
+		if i == len(t.phases)-1 && regionsScanned > 0 {
+			rate := float64(regionsScanned) / t.elapsed[i].Seconds()
+			fmt.Fprintf(os.Stderr, "timing: %-15s %d regions (%.0f regions/s)\n", "", regionsScanned, rate)
+		}
+	}
+}
+
+// loadProgress reports how far the locations CSVs have been read for the
+// -progress flag. On a terminal the report is rewritten in place; otherwise
+// only the total for each file is printed.
+func loadProgress() func(file string, read, size int64, rows int) {
+	live := term.IsTerminal(int(os.Stderr.Fd()))
+	return func(file string, read, size int64, rows int) {
+		done := read >= size
+		if !live && !done {
+			return
+		}
+		percent := 100.0
+		if size > 0 {
+			percent = float64(read) * 100 / float64(size)
+		}
+		line := fmt.Sprintf("loading %s: %5.1f%% (%d rows)", file, percent, rows)
+		if !live {
+			fmt.Fprintln(os.Stderr, line)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "\r%s", line)
+		if done {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
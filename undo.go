@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"movie-distrbution/distribution"
+)
+
+// undo reverts the last steps changes recorded in the audit log at path,
+// newest first, and returns the entries it reverted. Entries already
+// reverted by an earlier undo are passed over, so repeated undos keep
+// walking back through the history. Each change is only reverted if the
+// distributor still has the record the change left behind; anything changed
+// outside the audit log since then stops the undo before it modifies
+// anything. With dryRun the entries are checked and returned but the system
+// is left unchanged.
+func undo(system *distribution.DistributionSystem, path string, steps int, dryRun bool) ([]auditEntry, error) {
+	if steps < 1 {
+		return nil, usageErrorf("steps must be at least 1, got %d", steps)
+	}
+	entries, err := readAuditLog(path, "", time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []auditEntry
+	skip := 0
+	for i := len(entries) - 1; i >= 0 && len(selected) < steps; i-- {
+		switch entry := entries[i]; {
+		case entry.Undone > 0:
+			skip += entry.Undone
+		case skip > 0:
+			skip--
+		default:
+			selected = append(selected, entry)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("nothing to undo")
+	}
+	if len(selected) < steps {
+		return nil, fmt.Errorf("only %d changes can be undone", len(selected))
+	}
+
+	// Revert on a copy so a conflict part way leaves the system untouched
+	staged := system.Clone()
+	for _, entry := range selected {
+		current, err := takeAuditSnapshot(staged)
+		if err != nil {
+			return nil, err
+		}
+		records := make(map[string]*distribution.DistributorData)
+		for _, change := range entry.Changes {
+			var expected []byte
+			if change.After != nil {
+				if expected, err = json.Marshal(change.After); err != nil {
+					return nil, err
+				}
+			}
+			if string(current[change.Distributor]) != string(expected) {
+				return nil, fmt.Errorf("cannot undo %s from %s: %s has changed since",
+					entry.Command, entry.Time.Format(time.RFC3339), change.Distributor)
+			}
+			records[change.Distributor] = change.Before
+		}
+		if err := staged.RestoreRecords(records); err != nil {
+			return nil, fmt.Errorf("cannot undo %s from %s: %w", entry.Command, entry.Time.Format(time.RFC3339), err)
+		}
+	}
+	if dryRun {
+		return selected, nil
+	}
+
+	// Copy the reverted records of every touched distributor back
+	staging := make(map[string]distribution.DistributorData)
+	for _, record := range staged.Records() {
+		staging[record.Name] = record
+	}
+	records := make(map[string]*distribution.DistributorData)
+	for _, entry := range selected {
+		for _, change := range entry.Changes {
+			if record, exists := staging[change.Distributor]; exists {
+				records[change.Distributor] = &record
+			} else {
+				records[change.Distributor] = nil
+			}
+		}
+	}
+	return selected, system.RestoreRecords(records)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDelay is how long -watch waits after the last change to a file
+// before reloading it, so a file being written is read once it is complete
+const watchDelay = 200 * time.Millisecond
+
+// fileStamp identifies one version of a file on disk
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// statFile returns the stamp of the file at path
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// lockState takes the lock on the state file for one load or save under
+// -watch. Otherwise serve holds the lock from start to end, or locking is
+// off, and the nil lock returned releases nothing.
+func (s *server) lockState(exclusive bool) (*stateLock, error) {
+	if !s.opts.watch || s.opts.noLock {
+		return nil, nil
+	}
+	return acquireStateLock(s.opts.statePath(), exclusive, s.opts.lockTimeout)
+}
+
+// watch reloads the state file whenever it changes on disk, unless the
+// change is a save of the server's own, and reloads the locations as well
+// when a locations CSV or the aliases file changes. The directories holding
+// the files are watched rather than the files, because saving replaces the
+// state file with a new one.
+func (s *server) watch() (*fsnotify.Watcher, error) {
+	// Whether a change to each watched file also reloads the locations
+	watched := make(map[string]bool)
+	files := append([]string{s.opts.statePath()}, s.opts.csvFiles...)
+	if s.opts.aliasFile != "" {
+		files = append(files, s.opts.aliasFile)
+	}
+	for i, file := range files {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		watched[path] = i > 0
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	dirs := make(map[string]bool)
+	for path := range watched {
+		dirs[filepath.Dir(path)] = true
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+	}
+
+	go func() {
+		var fire <-chan time.Time
+		locations := false
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				isLocations, ok := watched[filepath.Clean(event.Name)]
+				if !ok || event.Op == fsnotify.Chmod {
+					continue
+				}
+				locations = locations || isLocations
+				fire = time.After(watchDelay)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("watching files: "+err.Error(), "operation", "watch")
+			case <-fire:
+				fire = nil
+				if (locations || s.stateChanged()) && s.reload(locations) == nil {
+					slog.Info("reloaded "+describeReload(s.opts.statePath(), locations), "operation", "watch", "file", s.opts.statePath())
+				}
+				locations = false
+			}
+		}
+	}()
+	return watcher, nil
+}
+
+// stateChanged reports whether the state file differs from the one last
+// loaded or saved
+func (s *server) stateChanged() bool {
+	stamp, err := statFile(s.opts.statePath())
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return err == nil && stamp != s.stamp
+}
+
+func describeReload(dataFile string, locations bool) string {
+	if locations {
+		return "the locations and " + dataFile
+	}
+	return dataFile
+}